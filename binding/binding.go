@@ -0,0 +1,158 @@
+// Package binding parses and checks the port and bind address of the site
+// before they reach Hosted Web Core, which reports bad values only as an
+// opaque activation failure.
+package binding
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Wildcard binds the site to every address of the machine
+const Wildcard = "*"
+
+// ParsePort parses the PORT environment variable
+func ParsePort(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("Missing PORT environment variable")
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("PORT must be a number, got %q", value)
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("PORT must be between 1 and 65535, got %d", port)
+	}
+	return port, nil
+}
+
+// ParseAddress parses a bind address: *, an IPv4 address or an IPv6
+// address, with or without brackets. It returns the address as IIS expects
+// it in bindingInformation, with IPv6 addresses in brackets.
+func ParseAddress(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == Wildcard {
+		return Wildcard, nil
+	}
+
+	if _, port, err := net.SplitHostPort(value); err == nil && isNumber(port) {
+		return "", fmt.Errorf("bind address %q must not include a port; set PORT instead", value)
+	}
+
+	literal := value
+	bracketed := strings.HasPrefix(value, "[") || strings.HasSuffix(value, "]")
+	if bracketed {
+		if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+			return "", fmt.Errorf("bind address %q has unbalanced brackets", value)
+		}
+		literal = value[1 : len(value)-1]
+	}
+
+	addr, err := netip.ParseAddr(literal)
+	if err != nil {
+		if isHostname(literal) {
+			return "", fmt.Errorf("bind address %q is a host name; use *, an IPv4 or an IPv6 address", value)
+		}
+		return "", fmt.Errorf("bind address %q is not *, an IPv4 or an IPv6 address", value)
+	}
+	if addr.Zone() != "" {
+		return "", fmt.Errorf("bind address %q has a zone, which IIS bindings do not support", value)
+	}
+
+	if addr.Is4() {
+		if bracketed {
+			return "", fmt.Errorf("bind address %q is an IPv4 address and must not be in brackets", value)
+		}
+		return addr.String(), nil
+	}
+	return "[" + addr.String() + "]", nil
+}
+
+// ParseAddresses parses a list of bind addresses separated by commas,
+// semicolons or spaces, so that a site can be bound to specific addresses of
+// both families. An empty list binds to every address.
+func ParseAddresses(value string) ([]string, error) {
+	var addresses []string
+	seen := map[string]bool{}
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' || r == ' ' }) {
+		address, err := ParseAddress(field)
+		if err != nil {
+			return nil, err
+		}
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+		addresses = append(addresses, address)
+	}
+
+	if len(addresses) == 0 {
+		return []string{Wildcard}, nil
+	}
+	if len(addresses) > 1 && seen[Wildcard] {
+		return nil, fmt.Errorf("bind address * already covers every address and cannot be listed with others")
+	}
+	return addresses, nil
+}
+
+func isNumber(value string) bool {
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
+
+// isHostname reports whether value looks like a DNS name. A name whose last
+// label is numeric is a mistyped IPv4 address rather than a host name.
+func isHostname(value string) bool {
+	if value == "" || len(value) > 253 {
+		return false
+	}
+	labels := strings.Split(strings.TrimSuffix(value, "."), ".")
+	if isNumber(labels[len(labels)-1]) {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// BindingInformation formats an address from ParseAddress and a port as the
+// bindingInformation of an IIS site binding
+func BindingInformation(address string, port int) string {
+	return fmt.Sprintf("%s:%d:", address, port)
+}
+
+// CheckAvailable checks that port can be bound on an address from
+// ParseAddress by briefly listening on it
+func CheckAvailable(address string, port int) error {
+	host := strings.Trim(address, "[]")
+	if address == Wildcard {
+		host = ""
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		switch {
+		case isAddrInUse(err):
+			return fmt.Errorf("port %d is already in use on %s", port, address)
+		case isAddrNotAvailable(err):
+			return fmt.Errorf("bind address %s is not an address of this machine", address)
+		case isAccessDenied(err):
+			return fmt.Errorf("port %d on %s is reserved or needs elevated permissions", port, address)
+		}
+		return fmt.Errorf("cannot bind port %d on %s: %v", port, address, err)
+	}
+	return listener.Close()
+}
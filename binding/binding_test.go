@@ -0,0 +1,134 @@
+package binding_test
+
+import (
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/binding"
+)
+
+var _ = Describe("ParsePort", func() {
+	DescribeTable("accepts ports",
+		func(value string, expected int) {
+			Expect(binding.ParsePort(value)).To(Equal(expected))
+		},
+		Entry("the lowest port", "1", 1),
+		Entry("a common port", "8080", 8080),
+		Entry("the highest port", "65535", 65535),
+		Entry("surrounding space", " 8080 ", 8080),
+	)
+
+	DescribeTable("rejects",
+		func(value, message string) {
+			_, err := binding.ParsePort(value)
+			Expect(err).To(MatchError(message))
+		},
+		Entry("an empty value", "", "Missing PORT environment variable"),
+		Entry("zero", "0", "PORT must be between 1 and 65535, got 0"),
+		Entry("a negative port", "-1", "PORT must be between 1 and 65535, got -1"),
+		Entry("a port out of range", "70000", "PORT must be between 1 and 65535, got 70000"),
+		Entry("a name", "http", `PORT must be a number, got "http"`),
+		Entry("an address", "127.0.0.1:8080", `PORT must be a number, got "127.0.0.1:8080"`),
+	)
+})
+
+var _ = Describe("ParseAddress", func() {
+	DescribeTable("accepts addresses",
+		func(value, expected string) {
+			Expect(binding.ParseAddress(value)).To(Equal(expected))
+		},
+		Entry("nothing", "", "*"),
+		Entry("the wildcard", "*", "*"),
+		Entry("IPv4 loopback", "127.0.0.1", "127.0.0.1"),
+		Entry("IPv4 any", "0.0.0.0", "0.0.0.0"),
+		Entry("IPv6 loopback", "::1", "[::1]"),
+		Entry("IPv6 loopback in brackets", "[::1]", "[::1]"),
+		Entry("IPv6 any", "::", "[::]"),
+		Entry("a long IPv6 address", "2001:0db8:0000:0000:0000:0000:0000:0001", "[2001:db8::1]"),
+		Entry("an IPv4-mapped IPv6 address", "::ffff:10.0.0.1", "[::ffff:10.0.0.1]"),
+		Entry("surrounding space", " 10.0.0.1 ", "10.0.0.1"),
+	)
+
+	DescribeTable("rejects",
+		func(value, message string) {
+			_, err := binding.ParseAddress(value)
+			Expect(err).To(MatchError(message))
+		},
+		Entry("a host name", "localhost", `bind address "localhost" is a host name; use *, an IPv4 or an IPv6 address`),
+		Entry("a qualified host name", "app.example.com", `bind address "app.example.com" is a host name; use *, an IPv4 or an IPv6 address`),
+		Entry("an IPv4 address with a port", "127.0.0.1:8080", `bind address "127.0.0.1:8080" must not include a port; set PORT instead`),
+		Entry("a host name with a port", "localhost:8080", `bind address "localhost:8080" must not include a port; set PORT instead`),
+		Entry("an IPv6 address with a port", "[::1]:8080", `bind address "[::1]:8080" must not include a port; set PORT instead`),
+		Entry("an IPv4 address in brackets", "[127.0.0.1]", `bind address "[127.0.0.1]" is an IPv4 address and must not be in brackets`),
+		Entry("a missing bracket", "[::1", `bind address "[::1" has unbalanced brackets`),
+		Entry("an IPv6 address with a zone", "fe80::1%eth0", `bind address "fe80::1%eth0" has a zone, which IIS bindings do not support`),
+		Entry("an IPv4 address out of range", "256.0.0.1", `bind address "256.0.0.1" is not *, an IPv4 or an IPv6 address`),
+		Entry("a truncated IPv4 address", "10.0.1", `bind address "10.0.1" is not *, an IPv4 or an IPv6 address`),
+		Entry("a malformed IPv6 address", "::1::2", `bind address "::1::2" is not *, an IPv4 or an IPv6 address`),
+		Entry("a URL", "http://127.0.0.1", `bind address "http://127.0.0.1" is not *, an IPv4 or an IPv6 address`),
+	)
+})
+
+var _ = Describe("ParseAddresses", func() {
+	DescribeTable("accepts lists",
+		func(value string, expected []string) {
+			Expect(binding.ParseAddresses(value)).To(Equal(expected))
+		},
+		Entry("nothing", "", []string{"*"}),
+		Entry("the wildcard", "*", []string{"*"}),
+		Entry("one address", "10.0.0.5", []string{"10.0.0.5"}),
+		Entry("both families", "10.0.0.5,[fd00::1]", []string{"10.0.0.5", "[fd00::1]"}),
+		Entry("unbracketed IPv6", "10.0.0.5, fd00::1", []string{"10.0.0.5", "[fd00::1]"}),
+		Entry("semicolons and spaces", "127.0.0.1; ::1 10.0.0.5", []string{"127.0.0.1", "[::1]", "10.0.0.5"}),
+		Entry("duplicates", "::1,[::1],0:0:0:0:0:0:0:1", []string{"[::1]"}),
+		Entry("trailing separators", "10.0.0.5,", []string{"10.0.0.5"}),
+	)
+
+	DescribeTable("rejects",
+		func(value, message string) {
+			_, err := binding.ParseAddresses(value)
+			Expect(err).To(MatchError(message))
+		},
+		Entry("an invalid entry", "10.0.0.5,localhost", `bind address "localhost" is a host name; use *, an IPv4 or an IPv6 address`),
+		Entry("the wildcard with others", "*,[fd00::1]", "bind address * already covers every address and cannot be listed with others"),
+	)
+})
+
+var _ = Describe("BindingInformation", func() {
+	DescribeTable("formats IIS binding information",
+		func(address, expected string) {
+			Expect(binding.BindingInformation(address, 8080)).To(Equal(expected))
+		},
+		Entry("the wildcard", "*", "*:8080:"),
+		Entry("an IPv4 address", "127.0.0.1", "127.0.0.1:8080:"),
+		Entry("an IPv6 address", "[::1]", "[::1]:8080:"),
+	)
+})
+
+var _ = Describe("CheckAvailable", func() {
+	It("succeeds for a free port", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		port := listener.Addr().(*net.TCPAddr).Port
+		Expect(listener.Close()).To(Succeed())
+
+		Expect(binding.CheckAvailable("127.0.0.1", port)).To(Succeed())
+	})
+
+	It("reports a port that is in use", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		Expect(binding.CheckAvailable("127.0.0.1", port)).To(MatchError(fmt.Sprintf("port %d is already in use on 127.0.0.1", port)))
+		Expect(binding.CheckAvailable("*", port)).To(MatchError(fmt.Sprintf("port %d is already in use on *", port)))
+	})
+
+	It("reports an address that is not on this machine", func() {
+		Expect(binding.CheckAvailable("192.0.2.1", 8080)).To(MatchError("bind address 192.0.2.1 is not an address of this machine"))
+	})
+})
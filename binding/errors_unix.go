@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package binding
+
+import (
+	"errors"
+	"syscall"
+)
+
+func isAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+func isAddrNotAvailable(err error) bool {
+	return errors.Is(err, syscall.EADDRNOTAVAIL)
+}
+
+func isAccessDenied(err error) bool {
+	return errors.Is(err, syscall.EACCES)
+}
@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package binding
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Winsock error codes, which syscall does not name
+const (
+	wsaeacces        = syscall.Errno(10013)
+	wsaeaddrinuse    = syscall.Errno(10048)
+	wsaeaddrnotavail = syscall.Errno(10049)
+)
+
+func isAddrInUse(err error) bool {
+	return errors.Is(err, wsaeaddrinuse)
+}
+
+func isAddrNotAvailable(err error) bool {
+	return errors.Is(err, wsaeaddrnotavail)
+}
+
+// isAccessDenied also covers ports in a range excluded by Hyper-V or
+// another service, which Windows reports as access denied
+func isAccessDenied(err error) bool {
+	return errors.Is(err, wsaeacces)
+}
@@ -0,0 +1,281 @@
+// Package configwatch watches the app's config files while hwc runs and
+// validates every change, optionally restoring the last file that passed.
+// It polls rather than relying on file system notifications, which are not
+// delivered for every kind of edit made over cf ssh.
+package configwatch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/hwc/logger"
+)
+
+// Mode is what the watcher does with a change that fails validation
+type Mode string
+
+const (
+	// ModeLog logs the findings
+	ModeLog Mode = "log"
+	// ModeStrict logs the findings and restores the last good file
+	ModeStrict Mode = "strict"
+)
+
+// Config configures the watcher
+type Config struct {
+	Mode Mode
+	// Interval between polls of the files
+	Interval time.Duration
+	// Debounce is how long a file has to stay unchanged before it is
+	// validated, so that a file is not validated half written
+	Debounce time.Duration
+}
+
+// ConfigFromEnv reads HWC_CONFIG_WATCH (off, log or strict),
+// HWC_CONFIG_WATCH_INTERVAL and HWC_CONFIG_WATCH_DEBOUNCE. It returns false
+// when watching is off.
+func ConfigFromEnv() (Config, bool, error) {
+	config := Config{Interval: 2 * time.Second, Debounce: time.Second}
+
+	switch value := strings.ToLower(os.Getenv("HWC_CONFIG_WATCH")); value {
+	case "", "off":
+		return config, false, nil
+	case string(ModeLog), string(ModeStrict):
+		config.Mode = Mode(value)
+	default:
+		return config, false, fmt.Errorf("HWC_CONFIG_WATCH must be off, log or strict, got %q", value)
+	}
+
+	if value := os.Getenv("HWC_CONFIG_WATCH_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return config, false, fmt.Errorf("HWC_CONFIG_WATCH_INTERVAL must be a positive duration such as 2s, got %q", value)
+		}
+		config.Interval = interval
+	}
+
+	if value := os.Getenv("HWC_CONFIG_WATCH_DEBOUNCE"); value != "" {
+		debounce, err := time.ParseDuration(value)
+		if err != nil || debounce < 0 {
+			return config, false, fmt.Errorf("HWC_CONFIG_WATCH_DEBOUNCE must be a duration such as 1s, got %q", value)
+		}
+		config.Debounce = debounce
+	}
+
+	return config, true, nil
+}
+
+// Validator validates the file at path, writing warnings to writer. An
+// error, or a warning that the last good file did not have, fails
+// validation.
+type Validator func(path string, writer io.Writer) error
+
+// Change describes a validated change to a file
+type Change struct {
+	Path string
+	// Findings are the new warnings and the error of the validator
+	Findings []string
+	// Removed is set when the file was deleted
+	Removed bool
+	// Restored is set when the last good file was put back
+	Restored bool
+	// RestoreErr is set when putting back the last good file failed
+	RestoreErr error
+}
+
+// Valid reports whether the change passed validation
+func (c Change) Valid() bool {
+	return !c.Removed && len(c.Findings) == 0
+}
+
+type file struct {
+	// data as last seen, nil when the file does not exist
+	data []byte
+	// good is the last content that passed validation
+	good []byte
+	// known are the warnings of the good content
+	known map[string]bool
+	// changed is when data was last seen to change, zero once validated
+	changed time.Time
+	// invalid is set while the file holds a change that failed validation
+	invalid bool
+}
+
+// Watcher polls a set of files
+type Watcher struct {
+	config   Config
+	validate Validator
+	files    map[string]*file
+	paths    []string
+}
+
+// New watches paths, taking their current content as good. Warnings about
+// the current content are not reported again for later changes.
+func New(paths []string, validate Validator, config Config) (*Watcher, error) {
+	w := &Watcher{config: config, validate: validate, files: map[string]*file{}}
+	for _, path := range paths {
+		data, err := read(path)
+		if err != nil {
+			return nil, err
+		}
+
+		f := &file{data: data, good: data, known: map[string]bool{}}
+		if data != nil {
+			warnings, _ := w.run(path)
+			for _, warning := range warnings {
+				f.known[warning] = true
+			}
+		}
+		w.paths = append(w.paths, path)
+		w.files[path] = f
+	}
+	return w, nil
+}
+
+// run validates path, returning its warnings one per line
+func (w *Watcher) run(path string) ([]string, error) {
+	var buffer bytes.Buffer
+	err := w.validate(path, &buffer)
+
+	var warnings []string
+	for _, line := range strings.Split(buffer.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			warnings = append(warnings, line)
+		}
+	}
+	return warnings, err
+}
+
+func read(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err == nil && data == nil {
+		data = []byte{}
+	}
+	return data, err
+}
+
+// Run polls the files every interval until ctx is done, logging each change.
+// A file that cannot be read, e.g. while an editor holds it open, is logged
+// and read again at the next poll.
+func (w *Watcher) Run(ctx context.Context, log *logger.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.config.Interval):
+		}
+
+		changes, err := w.Poll(time.Now())
+		if err != nil {
+			log.Warnf("config_watch_read_failed", logger.Fields{"error": err.Error()},
+				"HWC could not read a watched config file, retrying: %v", err)
+		}
+		for _, change := range changes {
+			change.Log(log)
+		}
+	}
+}
+
+// Poll reads the files and validates those that have changed and then
+// stayed unchanged for the debounce period. Files that cannot be read are
+// left as they were and reported in the error.
+func (w *Watcher) Poll(now time.Time) ([]Change, error) {
+	var changes []Change
+	var errs []error
+	for _, path := range w.paths {
+		f := w.files[path]
+		data, err := read(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if !sameContent(data, f.data) {
+			f.data = data
+			f.changed = now
+			continue
+		}
+		if f.changed.IsZero() || now.Sub(f.changed) < w.config.Debounce {
+			continue
+		}
+		f.changed = time.Time{}
+
+		if sameContent(data, f.good) && !f.invalid {
+			continue
+		}
+		changes = append(changes, w.check(path, f))
+	}
+	return changes, errors.Join(errs...)
+}
+
+func (w *Watcher) check(path string, f *file) Change {
+	change := Change{Path: path, Removed: f.data == nil}
+
+	var warnings []string
+	if !change.Removed {
+		var err error
+		warnings, err = w.run(path)
+		for _, warning := range warnings {
+			if !f.known[warning] {
+				change.Findings = append(change.Findings, warning)
+			}
+		}
+		if err != nil {
+			change.Findings = append(change.Findings, err.Error())
+		}
+	}
+
+	if change.Valid() {
+		f.good = f.data
+		f.invalid = false
+		f.known = map[string]bool{}
+		for _, warning := range warnings {
+			f.known[warning] = true
+		}
+		return change
+	}
+	f.invalid = true
+
+	if w.config.Mode == ModeStrict && f.good != nil {
+		change.RestoreErr = restore(path, f.good)
+		if change.RestoreErr == nil {
+			change.Restored = true
+			f.data = f.good
+			f.invalid = false
+		}
+	}
+	return change
+}
+
+// restore writes data through a temporary file so that IIS never sees a
+// partially restored file
+func restore(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp := path + ".hwc-restore"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// sameContent tells a missing file (nil) from an empty one
+func sameContent(a, b []byte) bool {
+	return (a == nil) == (b == nil) && bytes.Equal(a, b)
+}
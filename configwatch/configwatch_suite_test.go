@@ -0,0 +1,13 @@
+package configwatch_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestConfigwatch(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Configwatch Suite")
+}
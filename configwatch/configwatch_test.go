@@ -0,0 +1,308 @@
+package configwatch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"code.cloudfoundry.org/hwc/configwatch"
+	"code.cloudfoundry.org/hwc/logger"
+)
+
+// validate fails files containing "broken" and warns about "deprecated"
+func validate(path string, writer io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(data), "deprecated") {
+		fmt.Fprintf(writer, "Warning: %s uses a deprecated setting\n", filepath.Base(path))
+	}
+	if strings.Contains(string(data), "broken") {
+		return errors.New("XML syntax error on line 1")
+	}
+	return nil
+}
+
+var _ = Describe("Watcher", func() {
+	var (
+		dir     string
+		path    string
+		config  configwatch.Config
+		watcher *configwatch.Watcher
+		start   time.Time
+	)
+
+	write := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	content := func() string {
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	poll := func(after time.Duration) []configwatch.Change {
+		changes, err := watcher.Poll(start.Add(after))
+		Expect(err).NotTo(HaveOccurred())
+		return changes
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		path = filepath.Join(dir, "Web.config")
+		write("<configuration />")
+		config = configwatch.Config{Mode: configwatch.ModeLog, Interval: time.Second, Debounce: time.Second}
+		start = time.Now()
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		watcher, err = configwatch.New([]string{path}, validate, config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reports nothing while files are unchanged", func() {
+		Expect(poll(0)).To(BeEmpty())
+		Expect(poll(5 * time.Second)).To(BeEmpty())
+	})
+
+	It("validates a change once it has settled", func() {
+		write("<configuration><appSettings /></configuration>")
+		Expect(poll(0)).To(BeEmpty())
+		Expect(poll(500 * time.Millisecond)).To(BeEmpty())
+
+		changes := poll(time.Second)
+		Expect(changes).To(Equal([]configwatch.Change{{Path: path}}))
+		Expect(changes[0].Valid()).To(BeTrue())
+
+		Expect(poll(10 * time.Second)).To(BeEmpty())
+	})
+
+	It("waits again when a file changes during the debounce period", func() {
+		write("<configuration>")
+		Expect(poll(0)).To(BeEmpty())
+		write("<configuration><appSettings /></configuration>")
+		Expect(poll(900 * time.Millisecond)).To(BeEmpty())
+		Expect(poll(1500 * time.Millisecond)).To(BeEmpty())
+
+		Expect(poll(2 * time.Second)).To(Equal([]configwatch.Change{{Path: path}}))
+	})
+
+	It("ignores a change that is reverted before it settles", func() {
+		write("<configuration broken>")
+		Expect(poll(0)).To(BeEmpty())
+		write("<configuration />")
+		Expect(poll(100 * time.Millisecond)).To(BeEmpty())
+		Expect(poll(2 * time.Second)).To(BeEmpty())
+	})
+
+	It("reports warnings and errors as findings and keeps the change", func() {
+		write("<configuration deprecated broken>")
+		poll(0)
+
+		changes := poll(time.Second)
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].Valid()).To(BeFalse())
+		Expect(changes[0].Findings).To(Equal([]string{
+			"Warning: Web.config uses a deprecated setting",
+			"XML syntax error on line 1",
+		}))
+		Expect(changes[0].Restored).To(BeFalse())
+		Expect(content()).To(Equal("<configuration deprecated broken>"))
+	})
+
+	Context("when the file already had warnings", func() {
+		BeforeEach(func() {
+			write("<configuration deprecated />")
+		})
+
+		It("only reports new findings", func() {
+			write("<configuration deprecated><appSettings /></configuration>")
+			poll(0)
+			Expect(poll(time.Second)).To(Equal([]configwatch.Change{{Path: path}}))
+
+			write("<configuration deprecated broken>")
+			poll(2 * time.Second)
+			changes := poll(3 * time.Second)
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Findings).To(Equal([]string{"XML syntax error on line 1"}))
+		})
+	})
+
+	It("reports a removed file", func() {
+		Expect(os.Remove(path)).To(Succeed())
+		poll(0)
+
+		changes := poll(time.Second)
+		Expect(changes).To(Equal([]configwatch.Change{{Path: path, Removed: true}}))
+	})
+
+	Context("in strict mode", func() {
+		BeforeEach(func() {
+			config.Mode = configwatch.ModeStrict
+		})
+
+		It("restores the last good file", func() {
+			write("<configuration><appSettings /></configuration>")
+			poll(0)
+			Expect(poll(time.Second)[0].Valid()).To(BeTrue())
+
+			write("<configuration broken>")
+			poll(2 * time.Second)
+			changes := poll(3 * time.Second)
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Restored).To(BeTrue())
+			Expect(content()).To(Equal("<configuration><appSettings /></configuration>"))
+
+			Expect(poll(10 * time.Second)).To(BeEmpty())
+			entries, err := os.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("restores a removed file", func() {
+			Expect(os.Remove(path)).To(Succeed())
+			poll(0)
+
+			changes := poll(time.Second)
+			Expect(changes).To(Equal([]configwatch.Change{{Path: path, Removed: true, Restored: true}}))
+			Expect(content()).To(Equal("<configuration />"))
+		})
+
+		It("cannot restore a file that did not exist at first", func() {
+			Expect(os.Remove(path)).To(Succeed())
+			watcher, _ = configwatch.New([]string{path}, validate, config)
+
+			write("<configuration broken>")
+			poll(0)
+			changes := poll(time.Second)
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Restored).To(BeFalse())
+			Expect(content()).To(Equal("<configuration broken>"))
+		})
+	})
+
+	It("runs until the context is done, logging changes", func() {
+		config.Interval = 10 * time.Millisecond
+		config.Debounce = 0
+		watcher, _ = configwatch.New([]string{path}, validate, config)
+
+		out := gbytes.NewBuffer()
+		errOut := gbytes.NewBuffer()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			watcher.Run(ctx, logger.New(out, errOut))
+			close(done)
+		}()
+
+		write("<configuration deprecated />")
+		Eventually(errOut).Should(gbytes.Say("Web.config: Warning: Web.config uses a deprecated setting\n"))
+		Eventually(errOut).Should(gbytes.Say("HWC found 1 problem\\(s\\) in change to Web.config\n"))
+
+		write("<configuration />")
+		Eventually(out).Should(gbytes.Say("HWC validated change to Web.config\n"))
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("keeps running when a file cannot be read", func() {
+		config.Interval = 10 * time.Millisecond
+		config.Debounce = 0
+		watcher, _ = configwatch.New([]string{path}, validate, config)
+
+		out := gbytes.NewBuffer()
+		errOut := gbytes.NewBuffer()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go watcher.Run(ctx, logger.New(out, errOut))
+
+		// reading a directory fails, much as reading a file locked by an
+		// editor does on Windows
+		Expect(os.Remove(path)).To(Succeed())
+		Expect(os.Mkdir(path, 0755)).To(Succeed())
+		Eventually(errOut).Should(gbytes.Say("HWC could not read a watched config file, retrying: "))
+
+		Expect(os.Remove(path)).To(Succeed())
+		write("<configuration deprecated />")
+		Eventually(errOut).Should(gbytes.Say("HWC found 1 problem\\(s\\) in change to Web.config\n"))
+	})
+
+	It("reports files it cannot read and polls the others", func() {
+		other := filepath.Join(dir, "connectionStrings.config")
+		Expect(os.WriteFile(other, []byte("<connectionStrings />"), 0644)).To(Succeed())
+		watcher, _ = configwatch.New([]string{other, path}, validate, config)
+		Expect(os.Remove(other)).To(Succeed())
+		Expect(os.Mkdir(other, 0755)).To(Succeed())
+
+		write("<configuration broken>")
+		_, err := watcher.Poll(start)
+		Expect(err).To(MatchError(ContainSubstring("connectionStrings.config")))
+		changes, err := watcher.Poll(start.Add(2 * time.Second))
+		Expect(err).To(HaveOccurred())
+		Expect(changes).To(HaveLen(1))
+		Expect(changes[0].Path).To(Equal(path))
+	})
+})
+
+var _ = Describe("ConfigFromEnv", func() {
+	BeforeEach(func() {
+		for _, name := range []string{"HWC_CONFIG_WATCH", "HWC_CONFIG_WATCH_INTERVAL", "HWC_CONFIG_WATCH_DEBOUNCE"} {
+			value, set := os.LookupEnv(name)
+			DeferCleanup(func() {
+				if set {
+					os.Setenv(name, value)
+				} else {
+					os.Unsetenv(name)
+				}
+			})
+			os.Unsetenv(name)
+		}
+	})
+
+	It("is off by default", func() {
+		_, enabled, err := configwatch.ConfigFromEnv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeFalse())
+
+		os.Setenv("HWC_CONFIG_WATCH", "off")
+		_, enabled, err = configwatch.ConfigFromEnv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeFalse())
+	})
+
+	It("reads the mode and timings", func() {
+		os.Setenv("HWC_CONFIG_WATCH", "Strict")
+		os.Setenv("HWC_CONFIG_WATCH_INTERVAL", "5s")
+		os.Setenv("HWC_CONFIG_WATCH_DEBOUNCE", "0s")
+
+		config, enabled, err := configwatch.ConfigFromEnv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeTrue())
+		Expect(config).To(Equal(configwatch.Config{Mode: configwatch.ModeStrict, Interval: 5 * time.Second}))
+	})
+
+	DescribeTable("rejects invalid values",
+		func(name, value, message string) {
+			os.Setenv("HWC_CONFIG_WATCH", "log")
+			os.Setenv(name, value)
+			_, _, err := configwatch.ConfigFromEnv()
+			Expect(err).To(MatchError(message))
+		},
+		Entry("mode", "HWC_CONFIG_WATCH", "restore", `HWC_CONFIG_WATCH must be off, log or strict, got "restore"`),
+		Entry("interval", "HWC_CONFIG_WATCH_INTERVAL", "0s", `HWC_CONFIG_WATCH_INTERVAL must be a positive duration such as 2s, got "0s"`),
+		Entry("debounce", "HWC_CONFIG_WATCH_DEBOUNCE", "soon", `HWC_CONFIG_WATCH_DEBOUNCE must be a duration such as 1s, got "soon"`),
+	)
+})
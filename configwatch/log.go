@@ -0,0 +1,36 @@
+package configwatch
+
+import (
+	"path/filepath"
+
+	"code.cloudfoundry.org/hwc/logger"
+)
+
+// Log writes the change to log
+func (c Change) Log(log *logger.Logger) {
+	name := filepath.Base(c.Path)
+	fields := logger.Fields{"path": c.Path}
+
+	if c.Valid() {
+		log.Infof("config_changed", fields, "HWC validated change to %s", name)
+		return
+	}
+
+	for _, finding := range c.Findings {
+		log.Warnf("config_change_finding", logger.Fields{"path": c.Path, "finding": finding}, "%s: %s", name, finding)
+	}
+	if c.Removed {
+		log.Warnf("config_removed", fields, "HWC: %s was removed", name)
+	}
+
+	switch {
+	case c.Restored:
+		log.Warnf("config_restored", fields, "HWC restored the last good %s", name)
+	case c.RestoreErr != nil:
+		fields["error"] = c.RestoreErr.Error()
+		log.Errorf("config_restore_failed", fields, "HWC could not restore the last good %s: %v", name, c.RestoreErr)
+	case !c.Removed:
+		fields["findings"] = len(c.Findings)
+		log.Warnf("config_change_invalid", fields, "HWC found %d problem(s) in change to %s", len(c.Findings), name)
+	}
+}
@@ -0,0 +1,172 @@
+// Package health serves /healthz and /readyz on a side listener so that
+// platform health checks and sidecars can tell whether the site is serving.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/hwc/probe"
+)
+
+// Config configures the health listener
+type Config struct {
+	// Port the health listener listens on
+	Port int
+	// Path of the site that is probed, relative to the context path
+	Path string
+	// Timeout of each probe
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads HWC_HEALTH_PORT, HWC_HEALTH_CHECK_PATH and
+// HWC_HEALTH_CHECK_TIMEOUT. It returns false when HWC_HEALTH_PORT is unset.
+func ConfigFromEnv() (Config, bool, error) {
+	config := Config{Path: "/", Timeout: 5 * time.Second}
+
+	value := os.Getenv("HWC_HEALTH_PORT")
+	if value == "" {
+		return config, false, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return config, false, fmt.Errorf("HWC_HEALTH_PORT must be a port number, got %q", value)
+	}
+	config.Port = port
+
+	if path := os.Getenv("HWC_HEALTH_CHECK_PATH"); path != "" {
+		if !strings.HasPrefix(path, "/") {
+			return config, false, fmt.Errorf("HWC_HEALTH_CHECK_PATH must start with /, got %q", path)
+		}
+		config.Path = path
+	}
+
+	if value := os.Getenv("HWC_HEALTH_CHECK_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return config, false, fmt.Errorf("HWC_HEALTH_CHECK_TIMEOUT must be a positive duration such as 5s, got %q", value)
+		}
+		config.Timeout = timeout
+	}
+
+	return config, true, nil
+}
+
+// Server answers /healthz with the result of probing the site and /readyz
+// with the same once the site has been marked ready
+type Server struct {
+	prober        *probe.Prober
+	ready         atomic.Bool
+	warmupFailure atomic.Value
+}
+
+func New(prober *probe.Prober) *Server {
+	return &Server{prober: prober}
+}
+
+// SetReady marks the site as ready, e.g. after a successful warm-up request
+func (s *Server) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// SetWarmupFailure records why warm-up failed. The site is then never ready,
+// and /readyz reports the failure.
+func (s *Server) SetWarmupFailure(failure string) {
+	s.warmupFailure.Store(failure)
+}
+
+func (s *Server) WarmupFailure() string {
+	failure, _ := s.warmupFailure.Load().(string)
+	return failure
+}
+
+type response struct {
+	Status     string `json:"status"`
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Warmup     string `json:"warmup,omitempty"`
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, r, false)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, r, true)
+	})
+	return mux
+}
+
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, readiness bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body response
+	status := http.StatusOK
+
+	if readiness && s.WarmupFailure() != "" {
+		body = response{Status: "warmup_failed", URL: s.prober.URL, Warmup: s.WarmupFailure()}
+		status = http.StatusServiceUnavailable
+	} else if readiness && !s.Ready() {
+		body = response{Status: "starting", URL: s.prober.URL}
+		status = http.StatusServiceUnavailable
+	} else {
+		result := s.prober.Probe(r.Context())
+		body = response{
+			Status:     "ok",
+			URL:        result.URL,
+			StatusCode: result.StatusCode,
+			DurationMs: result.Duration.Milliseconds(),
+		}
+		if result.Err != nil {
+			body.Error = result.Err.Error()
+		}
+		if !result.Healthy() {
+			body.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// WaitUntilHealthy probes the site every interval until it answers, then
+// marks the server ready. It returns the successful result, or the last one
+// when ctx is done first.
+func (s *Server) WaitUntilHealthy(ctx context.Context, interval time.Duration) probe.Result {
+	for {
+		result := s.prober.Probe(ctx)
+		if result.Healthy() {
+			s.SetReady(true)
+			return result
+		}
+
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(interval):
+		}
+	}
+}
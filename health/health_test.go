@@ -0,0 +1,191 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/health"
+	"code.cloudfoundry.org/hwc/probe"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		site       *httptest.Server
+		siteStatus atomic.Int32
+		server     *health.Server
+		listener   *httptest.Server
+	)
+
+	get := func(path string) (int, map[string]interface{}) {
+		resp, err := http.Get(listener.URL + path)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+
+		var body map[string]interface{}
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		return resp.StatusCode, body
+	}
+
+	BeforeEach(func() {
+		siteStatus.Store(http.StatusOK)
+		site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(int(siteStatus.Load()))
+		}))
+		server = health.New(probe.New(site.URL+"/", time.Second))
+		listener = httptest.NewServer(server.Handler())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		site.Close()
+	})
+
+	Describe("/healthz", func() {
+		It("is ok while the site serves", func() {
+			status, body := get("/healthz")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body["status"]).To(Equal("ok"))
+			Expect(body["url"]).To(Equal(site.URL + "/"))
+			Expect(body["status_code"]).To(Equal(float64(200)))
+		})
+
+		It("is unavailable when the site fails", func() {
+			siteStatus.Store(http.StatusInternalServerError)
+			status, body := get("/healthz")
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+			Expect(body["status"]).To(Equal("unavailable"))
+		})
+
+		It("is unavailable when the site is down", func() {
+			site.Close()
+			status, body := get("/healthz")
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+			Expect(body["error"]).ToNot(BeEmpty())
+		})
+
+		It("rejects other methods", func() {
+			resp, err := http.Post(listener.URL+"/healthz", "text/plain", nil)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	Describe("/readyz", func() {
+		It("is starting until the site is marked ready", func() {
+			status, body := get("/readyz")
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+			Expect(body["status"]).To(Equal("starting"))
+
+			server.SetReady(true)
+			status, body = get("/readyz")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body["status"]).To(Equal("ok"))
+		})
+
+		It("stays unavailable and reports a failed warm-up", func() {
+			server.SetWarmupFailure("1 of 1 warm-up request(s) failed: /: 500 Internal Server Error")
+			server.SetReady(true)
+
+			status, body := get("/readyz")
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+			Expect(body["status"]).To(Equal("warmup_failed"))
+			Expect(body["warmup"]).To(Equal("1 of 1 warm-up request(s) failed: /: 500 Internal Server Error"))
+
+			status, body = get("/healthz")
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).ToNot(HaveKey("warmup"))
+		})
+
+		It("is unavailable when a ready site fails", func() {
+			server.SetReady(true)
+			siteStatus.Store(http.StatusServiceUnavailable)
+			status, _ := get("/readyz")
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+
+	Describe("WaitUntilHealthy", func() {
+		It("marks the server ready once the site answers", func() {
+			siteStatus.Store(http.StatusServiceUnavailable)
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				siteStatus.Store(http.StatusOK)
+			}()
+
+			result := server.WaitUntilHealthy(context.Background(), 10*time.Millisecond)
+			Expect(result.Healthy()).To(BeTrue())
+			Expect(server.Ready()).To(BeTrue())
+		})
+
+		It("gives up when the context is done", func() {
+			siteStatus.Store(http.StatusServiceUnavailable)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			result := server.WaitUntilHealthy(ctx, 10*time.Millisecond)
+			Expect(result.Healthy()).To(BeFalse())
+			Expect(server.Ready()).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("ConfigFromEnv", func() {
+	AfterEach(func() {
+		for _, name := range []string{"HWC_HEALTH_PORT", "HWC_HEALTH_CHECK_PATH", "HWC_HEALTH_CHECK_TIMEOUT"} {
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+	})
+
+	It("is disabled without HWC_HEALTH_PORT", func() {
+		_, enabled, err := health.ConfigFromEnv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(enabled).To(BeFalse())
+	})
+
+	It("reads the port, path and timeout", func() {
+		Expect(os.Setenv("HWC_HEALTH_PORT", "8081")).To(Succeed())
+		Expect(os.Setenv("HWC_HEALTH_CHECK_PATH", "/status")).To(Succeed())
+		Expect(os.Setenv("HWC_HEALTH_CHECK_TIMEOUT", "2s")).To(Succeed())
+
+		config, enabled, err := health.ConfigFromEnv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(enabled).To(BeTrue())
+		Expect(config).To(Equal(health.Config{Port: 8081, Path: "/status", Timeout: 2 * time.Second}))
+	})
+
+	It("defaults the path and timeout", func() {
+		Expect(os.Setenv("HWC_HEALTH_PORT", "8081")).To(Succeed())
+
+		config, _, err := health.ConfigFromEnv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config).To(Equal(health.Config{Port: 8081, Path: "/", Timeout: 5 * time.Second}))
+	})
+
+	It("rejects invalid values", func() {
+		Expect(os.Setenv("HWC_HEALTH_PORT", "http")).To(Succeed())
+		_, _, err := health.ConfigFromEnv()
+		Expect(err).To(MatchError(`HWC_HEALTH_PORT must be a port number, got "http"`))
+
+		Expect(os.Setenv("HWC_HEALTH_PORT", "8081")).To(Succeed())
+		Expect(os.Setenv("HWC_HEALTH_CHECK_TIMEOUT", "-1s")).To(Succeed())
+		_, _, err = health.ConfigFromEnv()
+		Expect(err).To(MatchError(`HWC_HEALTH_CHECK_TIMEOUT must be a positive duration such as 5s, got "-1s"`))
+	})
+
+	It("rejects a path that does not start with /", func() {
+		Expect(os.Setenv("HWC_HEALTH_PORT", "8081")).To(Succeed())
+		Expect(os.Setenv("HWC_HEALTH_CHECK_PATH", "status")).To(Succeed())
+		_, _, err := health.ConfigFromEnv()
+		Expect(err).To(MatchError(`HWC_HEALTH_CHECK_PATH must start with /, got "status"`))
+	})
+})
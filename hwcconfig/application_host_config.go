@@ -1,14 +1,22 @@
 package hwcconfig
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"text/template"
+
+	"code.cloudfoundry.org/hwc/binding"
+	"code.cloudfoundry.org/hwc/logger"
+	"code.cloudfoundry.org/hwc/nativemodule"
 )
 
 // TODO: refactor into object - make immutable
+// Modules marked Optional are omitted from the generated config when their
+// image is not installed, e.g. on Windows Server Core.
 var baselineNativeModules = [...]map[string]string{
 	{"Name": "UriCacheModule", "Image": `%windir%\System32\inetsrv\cachuri.dll`},
 	{"Name": "FileCacheModule", "Image": `%windir%\System32\inetsrv\cachfile.dll`},
@@ -23,25 +31,53 @@ var baselineNativeModules = [...]map[string]string{
 	{"Name": "RequestFilteringModule", "Image": `%windir%\System32\inetsrv\modrqflt.dll`},
 	{"Name": "CustomErrorModule", "Image": `%windir%\System32\inetsrv\custerr.dll`},
 	{"Name": "HttpLoggingModule", "Image": `%windir%\System32\inetsrv\loghttp.dll`},
-	{"Name": "RequestMonitorModule", "Image": `%windir%\System32\inetsrv\iisreqs.dll`},
+	{"Name": "RequestMonitorModule", "Image": `%windir%\System32\inetsrv\iisreqs.dll`, "Optional": "true"},
 	{"Name": "IsapiModule", "Image": `%windir%\System32\inetsrv\isapi.dll`},
 	{"Name": "IsapiFilterModule", "Image": `%windir%\System32\inetsrv\filter.dll`},
 	{"Name": "ConfigurationValidationModule", "Image": `%windir%\System32\inetsrv\validcfg.dll`},
 	{"Name": "ManagedEngineV4.0_32bit", "Image": `%windir%\Microsoft.NET\Framework\v4.0.30319\webengine4.dll`, "PreCondition": "integratedMode,runtimeVersionv4.0,bitness32"},
 	{"Name": "ManagedEngineV4.0_64bit", "Image": `%windir%\Microsoft.NET\Framework64\v4.0.30319\webengine4.dll`, "PreCondition": "integratedMode,runtimeVersionv4.0,bitness64"},
-	{"Name": "CustomLoggingModule", "Image": `%windir%\System32\inetsrv\logcust.dll`},
-	{"Name": "TracingModule", "Image": `%windir%\System32\inetsrv\iisetw.dll`},
-	{"Name": "FailedRequestsTracingModule", "Image": `%windir%\System32\inetsrv\iisfreb.dll`},
-	{"Name": "WebSocketModule", "Image": `%windir%\System32\inetsrv\iiswsock.dll`},
-	{"Name": "DynamicCompressionModule", "Image": `%windir%\System32\inetsrv\compdyn.dll`},
-	{"Name": "HttpRedirectionModule", "Image": `%windir%\System32\inetsrv\redirect.dll`},
-	{"Name": "CertificateMappingAuthenticationModule", "Image": `%windir%\System32\inetsrv\authcert.dll`},
-	{"Name": "UrlAuthorizationModule", "Image": `%windir%\System32\inetsrv\urlauthz.dll`},
-	{"Name": "WindowsAuthenticationModule", "Image": `%windir%\System32\inetsrv\authsspi.dll`},
-	{"Name": "DigestAuthenticationModule", "Image": `%windir%\System32\inetsrv\authmd5.dll`},
-	{"Name": "IISCertificateMappingAuthenticationModule", "Image": `%windir%\System32\inetsrv\authmap.dll`},
-	{"Name": "IpRestrictionModule", "Image": `%windir%\System32\inetsrv\iprestr.dll`},
-	{"Name": "DynamicIpRestrictionModule", "Image": `%windir%\System32\inetsrv\diprestr.dll`},
+	{"Name": "CustomLoggingModule", "Image": `%windir%\System32\inetsrv\logcust.dll`, "Optional": "true"},
+	{"Name": "TracingModule", "Image": `%windir%\System32\inetsrv\iisetw.dll`, "Optional": "true"},
+	{"Name": "FailedRequestsTracingModule", "Image": `%windir%\System32\inetsrv\iisfreb.dll`, "Optional": "true"},
+	{"Name": "WebSocketModule", "Image": `%windir%\System32\inetsrv\iiswsock.dll`, "Optional": "true"},
+	{"Name": "DynamicCompressionModule", "Image": `%windir%\System32\inetsrv\compdyn.dll`, "Optional": "true"},
+	{"Name": "HttpRedirectionModule", "Image": `%windir%\System32\inetsrv\redirect.dll`, "Optional": "true"},
+	{"Name": "CertificateMappingAuthenticationModule", "Image": `%windir%\System32\inetsrv\authcert.dll`, "Optional": "true"},
+	{"Name": "UrlAuthorizationModule", "Image": `%windir%\System32\inetsrv\urlauthz.dll`, "Optional": "true"},
+	{"Name": "WindowsAuthenticationModule", "Image": `%windir%\System32\inetsrv\authsspi.dll`, "Optional": "true"},
+	{"Name": "DigestAuthenticationModule", "Image": `%windir%\System32\inetsrv\authmd5.dll`, "Optional": "true"},
+	{"Name": "IISCertificateMappingAuthenticationModule", "Image": `%windir%\System32\inetsrv\authmap.dll`, "Optional": "true"},
+	{"Name": "IpRestrictionModule", "Image": `%windir%\System32\inetsrv\iprestr.dll`, "Optional": "true"},
+	{"Name": "DynamicIpRestrictionModule", "Image": `%windir%\System32\inetsrv\diprestr.dll`, "Optional": "true"},
+}
+
+// baselineModulesConf lists the global modules enabled for the site
+var baselineModulesConf = [...]string{
+	"HttpCacheModule",
+	"StaticCompressionModule",
+	"DynamicCompressionModule",
+	"DefaultDocumentModule",
+	"DirectoryListingModule",
+	"IsapiFilterModule",
+	"ProtocolSupportModule",
+	"StaticFileModule",
+	"AnonymousAuthenticationModule",
+	"WindowsAuthenticationModule",
+	"RequestFilteringModule",
+	"CustomErrorModule",
+	"IsapiModule",
+	"HttpLoggingModule",
+	"ConfigurationValidationModule",
+	"CustomLoggingModule",
+	"FailedRequestsTracingModule",
+	"WebSocketModule",
+	"HttpRedirectionModule",
+	"CertificateMappingAuthenticationModule",
+	"UrlAuthorizationModule",
+	"DigestAuthenticationModule",
+	"IISCertificateMappingAuthenticationModule",
+	"IpRestrictionModule",
 }
 
 func (c *HwcConfig) generateApplicationHostConfig() error {
@@ -51,6 +87,19 @@ func (c *HwcConfig) generateApplicationHostConfig() error {
 
 	var modulesConf []map[string]string
 
+	machine, err := nativemodule.Machine(runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+
+	var manifest nativemodule.Manifest
+	if manifestPath := os.Getenv("HWC_NATIVE_MODULES_MANIFEST"); manifestPath != "" {
+		manifest, err = nativemodule.LoadManifest(manifestPath)
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, imageDirectory := range filepath.SplitList(os.Getenv("HWC_NATIVE_MODULES")) {
 
 		directoryContents, err := os.ReadDir(imageDirectory)
@@ -58,6 +107,9 @@ func (c *HwcConfig) generateApplicationHostConfig() error {
 			return err
 		}
 
+		// files found in the module subdirectories, and those that were PE images
+		candidates, images := 0, 0
+
 		for _, subDirectoryFileInfo := range directoryContents {
 			name := subDirectoryFileInfo.Name()
 			subDirectoryPath := filepath.Join(imageDirectory, name)
@@ -67,43 +119,125 @@ func (c *HwcConfig) generateApplicationHostConfig() error {
 			}
 
 			for _, subDirectoryItem := range subDirectoryContents {
+				if nativemodule.IsChecksumFile(subDirectoryItem.Name()) {
+					continue
+				}
+
 				image := filepath.Join(subDirectoryPath, subDirectoryItem.Name())
+				if info, err := os.Stat(image); err == nil && info.IsDir() {
+					logger.Infof("native_module_skipped", logger.Fields{"module": image}, "HWC skipping native module: %s is a directory", image)
+					continue
+				}
+
+				candidates++
+				err := nativemodule.CheckImage(image, machine)
+				if errors.Is(err, nativemodule.ErrNotPEImage) {
+					logger.Infof("native_module_skipped", logger.Fields{"module": image}, "HWC skipping native module: %s is not a PE image", image)
+					continue
+				} else if err != nil {
+					return fmt.Errorf("HWC refusing to load native module %v", err)
+				}
+
+				err = nativemodule.VerifyChecksum(image, manifest)
+				if err != nil {
+					return err
+				}
+				images++
+
 				module := map[string]string{"Name": name, "Image": image}
 				userDefinedNativeModules = append(userDefinedNativeModules, module)
 				modulesConf = append(modulesConf, map[string]string{"Name": name})
-				fmt.Printf("HWC loading native module: %s\n", image)
+				logger.Infof("native_module_loading", logger.Fields{"module": image}, "HWC loading native module: %s", image)
 			}
 		}
 
+		if candidates > 0 && images == 0 {
+			return fmt.Errorf("HWC_NATIVE_MODULES: %s contains no PE images to load as native modules", imageDirectory)
+		}
+
 		if len(modulesConf) == 0 {
 			return fmt.Errorf("HWC_NATIVE_MODULES does not match required directory structure. See hwc README for detailed instructions.")
 		}
 	}
 
+	var globalModules []map[string]string
+	omitted := map[string]bool{}
+
 	for _, v := range baselineNativeModules {
 		imagePath := os.ExpandEnv(strings.Replace(v["Image"], `%windir%`, `${windir}`, -1))
 		_, err := os.Stat(imagePath)
 		if os.IsNotExist(err) {
+			if v["Optional"] == "true" {
+				omitted[v["Name"]] = true
+				c.OmittedModules = append(c.OmittedModules, v["Name"])
+				logger.Infof("native_module_omitted", logger.Fields{"module": v["Name"], "image": imagePath}, "HWC omitting optional native module %s: %s not found", v["Name"], imagePath)
+				continue
+			}
 			missing = append(missing, imagePath)
 		} else if err != nil {
 			return err
 		}
 
+		globalModules = append(globalModules, v)
 	}
 
 	if len(missing) > 0 {
 		return fmt.Errorf("Missing required DLLs:\n%s", strings.Join(missing, ",\n"))
 	}
 
-	rewrite := false
-	rewritePath := filepath.Join(os.Getenv("WINDIR"), "system32", "inetsrv", "rewrite.dll")
-	_, err := os.Stat(rewritePath)
-	if err == nil {
-		userDefinedNativeModules = append(userDefinedNativeModules, map[string]string{"Name": "RewriteModule", "Image": `%windir%\system32\inetsrv\rewrite.dll`})
-		rewrite = true
-	} else if !os.IsNotExist(err) {
+	if omitted["WebSocketModule"] {
+		if c.WebSocket.explicit && c.WebSocket.Enabled {
+			return fmt.Errorf("HWC_WEBSOCKETS=true requires WebSocketModule, but %s is not installed", `%windir%\System32\inetsrv\iiswsock.dll`)
+		}
+		c.WebSocket.Enabled = false
+	}
+
+	if omitted["WindowsAuthenticationModule"] {
+		if c.Authentication.Windows.explicit && c.Authentication.Windows.Enabled {
+			return fmt.Errorf("HWC_WINDOWS_AUTH requires WindowsAuthenticationModule, but %s is not installed", `%windir%\System32\inetsrv\authsspi.dll`)
+		}
+		c.Authentication.Windows.Enabled = false
+		if !c.Authentication.Anonymous.Enabled {
+			return fmt.Errorf("HWC_ANONYMOUS_AUTH=false requires windows authentication, but %s is not installed", `%windir%\System32\inetsrv\authsspi.dll`)
+		}
+	}
+
+	if omitted["IpRestrictionModule"] && c.IPSecurity.Enabled() {
+		return fmt.Errorf("HWC_IP_ALLOW and HWC_IP_DENY require IpRestrictionModule, but %s is not installed", `%windir%\System32\inetsrv\iprestr.dll`)
+	}
+	if omitted["DynamicIpRestrictionModule"] && c.IPSecurity.Dynamic.Enabled() {
+		return fmt.Errorf("HWC_IP_MAX_CONCURRENT_REQUESTS and HWC_IP_MAX_REQUESTS require DynamicIpRestrictionModule, but %s is not installed", `%windir%\System32\inetsrv\diprestr.dll`)
+	}
+
+	for _, name := range baselineModulesConf {
+		if !omitted[name] {
+			modulesConf = append(modulesConf, map[string]string{"Name": name})
+		}
+	}
+	if c.IPSecurity.Dynamic.Enabled() {
+		modulesConf = append(modulesConf, map[string]string{"Name": "DynamicIpRestrictionModule"})
+	}
+
+	detectedModules, err := detectOptionalModules()
+	if err != nil {
 		return err
 	}
+	for _, m := range detectedModules {
+		userDefinedNativeModules = append(userDefinedNativeModules, map[string]string{"Name": m.Name, "Image": m.Image})
+		c.OptionalModules = append(c.OptionalModules, m.Name)
+	}
+
+	if c.Redirect.Enabled() && !c.isOptionalModuleEnabled("RewriteModule") {
+		return c.Redirect.requirementError("RewriteModule", `%windir%\system32\inetsrv\rewrite.dll`)
+	}
+
+	if c.ForwardedFor.TrustedProxies != "" {
+		if c.isOptionalModuleEnabled("RewriteModule") {
+			c.ForwardedFor.RewriteRemoteAddr = true
+		} else {
+			logger.Warnf("forwarded_for_rewrite_skipped", logger.Fields{"module": "RewriteModule"}, "Warning: HWC_TRUSTED_PROXIES needs RewriteModule to set REMOTE_ADDR, but URL Rewrite is not installed")
+		}
+	}
 
 	file, err := os.Create(c.ApplicationHostConfigPath)
 	if err != nil {
@@ -112,20 +246,20 @@ func (c *HwcConfig) generateApplicationHostConfig() error {
 	defer file.Close()
 
 	type templateInput struct {
-		Config        *HwcConfig
-		GlobalModules []map[string]string
-		ModulesConf   []map[string]string
-		Rewrite       bool
+		Config          *HwcConfig
+		GlobalModules   []map[string]string
+		ModulesConf     []map[string]string
+		OptionalModules []optionalModule
 	}
 
 	t := templateInput{
-		Config:        c,
-		GlobalModules: append(baselineNativeModules[:], userDefinedNativeModules...),
-		ModulesConf:   modulesConf,
-		Rewrite:       rewrite,
+		Config:          c,
+		GlobalModules:   append(globalModules, userDefinedNativeModules...),
+		ModulesConf:     modulesConf,
+		OptionalModules: detectedModules,
 	}
 
-	var tmpl = template.Must(template.New("applicationhost").Parse(applicationHostConfigTemplate))
+	var tmpl = template.Must(template.New("applicationhost").Funcs(template.FuncMap{"bindingInformation": binding.BindingInformation}).Parse(applicationHostConfigTemplate))
 	if err := tmpl.Execute(file, t); err != nil {
 		return err
 	}
@@ -177,6 +311,9 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
         </sectionGroup>
         <section name="authorization" overrideModeDefault="Allow" />
         <section name="ipSecurity" overrideModeDefault="Deny" />
+        {{- if .Config.IPSecurity.Dynamic.Enabled }}
+        <section name="dynamicIpSecurity" overrideModeDefault="Deny" />
+        {{- end }}
         <section name="isapiCgiRestriction" allowDefinition="AppHostOnly" overrideModeDefault="Deny" />
         <section name="requestFiltering" overrideModeDefault="Allow" />
       </sectionGroup>
@@ -198,17 +335,9 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
         <section name="backup" overrideModeDefault="Deny" allowDefinition="MachineToApplication" />
       </sectionGroup>
       <section name="webSocket" overrideModeDefault="Deny" />
-			{{if .Rewrite}}
-			<sectionGroup name="rewrite">
-				<section name="rules" overrideModeDefault="Allow" />
-				<section name="globalRules" overrideModeDefault="Deny" allowDefinition="AppHostOnly" />
-				<section name="outboundRules" overrideModeDefault="Allow" />
-				<section name="providers" overrideModeDefault="Allow" />
-				<section name="rewriteMaps" overrideModeDefault="Allow" />
-				<section name="allowedServerVariables" overrideModeDefault="Allow" />
-			</sectionGroup>
-			{{end}}
+      {{- range .OptionalModules}}{{.SectionSchema}}{{end}}
     </sectionGroup>
+    {{- range .OptionalModules}}{{.RootSectionSchema}}{{end}}
   </configSections>
 
 
@@ -224,7 +353,15 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
 
     <sites>
       <siteDefaults>
+        {{- if .Config.ForwardedFor.Enabled }}
+        <logFile logFormat="W3C" directory="{{.Config.TempDirectory}}\LogFiles">
+          <customFields>
+            <add logFieldName="X-Forwarded-For" sourceName="X-Forwarded-For" sourceType="RequestHeader" />
+          </customFields>
+        </logFile>
+        {{- else }}
         <logFile logFormat="W3C" directory="{{.Config.TempDirectory}}\LogFiles" />
+        {{- end }}
         <traceFailedRequestsLogging enabled="false" />
       </siteDefaults>
       <applicationDefaults applicationPool="AppPool{{.Config.Port}}" />
@@ -233,10 +370,15 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
         {{ range .Config.Applications }}
         <application path="{{.Path}}" applicationPool="AppPool{{$.Config.Port}}">
           <virtualDirectory path="/" physicalPath="{{.PhysicalPath}}" />
+          {{- range .VirtualDirectories }}
+          <virtualDirectory path="{{.Path}}" physicalPath="{{.PhysicalPath}}" />
+          {{- end }}
         </application>
         {{ end }}
         <bindings>
-          <binding protocol="http" bindingInformation="{{.Config.BindAddress}}:{{.Config.Port}}:" />
+          {{ range .Config.BindAddresses }}
+          <binding protocol="http" bindingInformation="{{bindingInformation . $.Config.Port}}" />
+          {{ end }}
         </bindings>
       </site>
     </sites>
@@ -342,7 +484,7 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
 
       <authentication>
 
-        <anonymousAuthentication enabled="true" userName="IUSR" />
+        <anonymousAuthentication enabled="{{.Config.Authentication.Anonymous.Enabled}}" userName="{{.Config.Authentication.Anonymous.UserName}}" />
 
         <basicAuthentication />
 
@@ -352,10 +494,13 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
 
         <iisClientCertificateMappingAuthentication />
 
-        <windowsAuthentication authPersistNonNTLM="true" authPersistSingleRequest="true" enabled="true">
+        <windowsAuthentication authPersistNonNTLM="true" authPersistSingleRequest="true" enabled="{{.Config.Authentication.Windows.Enabled}}"{{if .Config.Authentication.Windows.UseKernelMode}} useKernelMode="{{.Config.Authentication.Windows.UseKernelMode}}"{{end}}>
           <providers>
-            <add value="Negotiate" />
+            {{- range .Config.Authentication.Windows.Providers }}
+            <add value="{{.}}" />
+            {{- end }}
           </providers>
+          <extendedProtection tokenChecking="{{.Config.Authentication.Windows.TokenChecking}}" />
         </windowsAuthentication>
       </authentication>
 
@@ -363,7 +508,29 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
         <add accessType="Allow" users="*" />
       </authorization>
 
+      {{- with .Config.IPSecurity }}
+      {{- if .Enabled }}
+      <ipSecurity allowUnlisted="{{.AllowUnlisted}}"{{if $.Config.ForwardedFor.Enabled}} enableProxyMode="true"{{end}}>
+        {{- range .Rules }}
+        <add ipAddress="{{.Address}}" subnetMask="{{.SubnetMask}}" allowed="{{.Allowed}}" />
+        {{- end }}
+      </ipSecurity>
+      {{- else if $.Config.ForwardedFor.Enabled }}
+      <ipSecurity enableProxyMode="true" />
+      {{- else }}
       <ipSecurity />
+      {{- end }}
+      {{- if .Dynamic.Enabled }}
+      <dynamicIpSecurity>
+        {{- if .Dynamic.MaxConcurrentRequests }}
+        <denyByConcurrentRequests enabled="true" maxConcurrentRequests="{{.Dynamic.MaxConcurrentRequests}}" />
+        {{- end }}
+        {{- if .Dynamic.MaxRequests }}
+        <denyByRequestRate enabled="true" maxRequests="{{.Dynamic.MaxRequests}}" requestIntervalInMilliseconds="{{.Dynamic.RequestIntervalMs}}" />
+        {{- end }}
+      </dynamicIpSecurity>
+      {{- end }}
+      {{- end }}
 
       <isapiCgiRestriction>
         <add path="%windir%\system32\inetsrv\asp.dll" allowed="true" groupId="ASP" description="Active Server Pages" />
@@ -440,6 +607,9 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
           <add segment="App_Data" />
           <add segment="App_Browsers" />
           <add segment=".iishost" />
+          {{- range .Config.HiddenSegments }}
+          <add segment="{{.}}" />
+          {{- end }}
         </hiddenSegments>
       </requestFiltering>
 
@@ -882,6 +1052,54 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
     <urlCompression />
 
     <validation />
+    {{- if or .Config.ForwardedFor.RewriteRemoteAddr .Config.Redirect.Enabled }}
+
+    <rewrite>
+      {{- if .Config.ForwardedFor.RewriteRemoteAddr }}
+      <allowedServerVariables>
+        <add name="REMOTE_ADDR" />
+      </allowedServerVariables>
+      {{- end }}
+      <globalRules>
+        {{- if .Config.ForwardedFor.RewriteRemoteAddr }}
+        <rule name="hwc-forwarded-for" stopProcessing="false">
+          <match url=".*" />
+          <conditions logicalGrouping="MatchAll" trackAllCaptures="false">
+            <add input="{REMOTE_ADDR}" pattern="{{.Config.ForwardedFor.TrustedProxies}}" />
+            <add input="{HTTP_X_FORWARDED_FOR}" pattern="{{.Config.ForwardedFor.ClientAddress}}" />
+          </conditions>
+          <serverVariables>
+            <set name="REMOTE_ADDR" value="{C:1}" />
+          </serverVariables>
+          <action type="None" />
+        </rule>
+        {{- end }}
+        {{- with .Config.Redirect }}
+        {{- if .CanonicalHost }}
+        <rule name="hwc-canonical-host" stopProcessing="true">
+          <match url=".*" />
+          <conditions logicalGrouping="MatchAll" trackAllCaptures="false">
+            <add input="{HTTP_HOST}" pattern="{{.CanonicalHostPattern}}" negate="true" />
+            <add input="{HTTP_X_FORWARDED_PROTO}" pattern="^(https?)$" />
+          </conditions>
+          <action type="Redirect" url="{{if .ForceHTTPS}}https{{else}}{C:1}{{end}}://{{.CanonicalHost}}{REQUEST_URI}" appendQueryString="false" redirectType="Permanent" />
+        </rule>
+        {{- end }}
+        {{- if .ForceHTTPS }}
+        <rule name="hwc-force-https" stopProcessing="true">
+          <match url=".*" />
+          <conditions logicalGrouping="MatchAll" trackAllCaptures="false">
+            <add input="{HTTP_X_FORWARDED_PROTO}" pattern="^http$" />
+          </conditions>
+          <action type="Redirect" url="https://{HTTP_HOST}{REQUEST_URI}" appendQueryString="false" redirectType="Permanent" />
+        </rule>
+        {{- end }}
+        {{- end }}
+      </globalRules>
+    </rewrite>
+    {{- end }}
+
+    <webSocket enabled="{{.Config.WebSocket.Enabled}}"{{if .Config.WebSocket.PingInterval}} pingInterval="{{.Config.WebSocket.PingInterval}}"{{end}}{{if .Config.WebSocket.ReceiveBufferLimit}} receiveBufferLimit="{{.Config.WebSocket.ReceiveBufferLimit}}"{{end}} />
 
   </system.webServer>
 
@@ -891,21 +1109,6 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
       {{range .ModulesConf}}
       <add name="{{ index . "Name" }}" lockItem="true" />
 	  {{end}}
-      <add name="HttpCacheModule" lockItem="true" />
-      <add name="StaticCompressionModule" lockItem="true" />
-      <add name="DynamicCompressionModule" lockItem="true" />
-      <add name="DefaultDocumentModule" lockItem="true" />
-      <add name="DirectoryListingModule" lockItem="true" />
-      <add name="IsapiFilterModule" lockItem="true" />
-      <add name="ProtocolSupportModule" lockItem="true" />
-      <add name="StaticFileModule" lockItem="true" />
-      <add name="AnonymousAuthenticationModule" lockItem="true" />
-      <add name="WindowsAuthenticationModule" lockItem="true" />
-      <add name="RequestFilteringModule" lockItem="true" />
-      <add name="CustomErrorModule" lockItem="true" />
-      <add name="IsapiModule" lockItem="true" />
-      <add name="HttpLoggingModule" lockItem="true" />
-      <add name="ConfigurationValidationModule" lockItem="true" />
       <add name="OutputCache" type="System.Web.Caching.OutputCacheModule" preCondition="managedHandler" />
       <add name="Session" type="System.Web.SessionState.SessionStateModule" preCondition="managedHandler" />
       <add name="WindowsAuthentication" type="System.Web.Security.WindowsAuthenticationModule" preCondition="managedHandler" />
@@ -921,18 +1124,9 @@ const applicationHostConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
       <add name="ServiceModel-4.0" type="System.ServiceModel.Activation.ServiceHttpModule, System.ServiceModel.Activation, Version=4.0.0.0, Culture=neutral, PublicKeyToken=31bf3856ad364e35" preCondition="managedHandler,runtimeVersionv4.0" />
       <add name="UrlRoutingModule-4.0" type="System.Web.Routing.UrlRoutingModule" preCondition="managedHandler,runtimeVersionv4.0" />
       <add name="ScriptModule-4.0" type="System.Web.Handlers.ScriptModule, System.Web.Extensions, Version=4.0.0.0, Culture=neutral, PublicKeyToken=31bf3856ad364e35" preCondition="managedHandler,runtimeVersionv4.0" />
-      <add name="CustomLoggingModule" lockItem="true" />
-      <add name="FailedRequestsTracingModule" lockItem="true" />
-      <add name="WebSocketModule" lockItem="true" />
-      <add name="HttpRedirectionModule" lockItem="true" />
-      <add name="CertificateMappingAuthenticationModule" lockItem="true" />
-      <add name="UrlAuthorizationModule" lockItem="true" />
-      <add name="DigestAuthenticationModule" lockItem="true" />
-      <add name="IISCertificateMappingAuthenticationModule" lockItem="true" />
-      <add name="IpRestrictionModule" lockItem="true" />
-			{{if .Rewrite}}
-			<add name="RewriteModule" />
-			{{end}}
+      {{range .OptionalModules}}{{range .Modules}}
+      <add name="{{.}}" />
+      {{end}}{{end}}
     </modules>
 
     <handlers accessPolicy="Read, Script">
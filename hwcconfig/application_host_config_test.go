@@ -5,8 +5,11 @@ package hwcconfig_test
 
 import (
 	"encoding/xml"
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -21,17 +24,45 @@ type Configuration struct {
 	SystemWebServer struct {
 		Security struct {
 			Authentication struct {
+				AnonymousAuthentication struct {
+					Enabled  string `xml:"enabled,attr"`
+					UserName string `xml:"userName,attr"`
+				} `xml:"anonymousAuthentication"`
 				WindowsAuthentication struct {
 					Enabled                  string `xml:"enabled,attr"`
 					AuthPersistNonNTLM       string `xml:"authPersistNonNTLM,attr"`
 					AuthPersistSingleRequest string `xml:"authPersistSingleRequest,attr"`
+					UseKernelMode            string `xml:"useKernelMode,attr"`
 					Providers                struct {
 						Add []struct {
 							Value string `xml:"value,attr"`
 						} `xml:"add"`
 					} `xml:"providers"`
+					ExtendedProtection struct {
+						TokenChecking string `xml:"tokenChecking,attr"`
+					} `xml:"extendedProtection"`
 				} `xml:"windowsAuthentication"`
 			} `xml:"authentication"`
+			IPSecurity struct {
+				AllowUnlisted   string `xml:"allowUnlisted,attr"`
+				EnableProxyMode string `xml:"enableProxyMode,attr"`
+				Add             []struct {
+					IPAddress  string `xml:"ipAddress,attr"`
+					SubnetMask string `xml:"subnetMask,attr"`
+					Allowed    string `xml:"allowed,attr"`
+				} `xml:"add"`
+			} `xml:"ipSecurity"`
+			DynamicIPSecurity struct {
+				DenyByConcurrentRequests struct {
+					Enabled               string `xml:"enabled,attr"`
+					MaxConcurrentRequests string `xml:"maxConcurrentRequests,attr"`
+				} `xml:"denyByConcurrentRequests"`
+				DenyByRequestRate struct {
+					Enabled                       string `xml:"enabled,attr"`
+					MaxRequests                   string `xml:"maxRequests,attr"`
+					RequestIntervalInMilliseconds string `xml:"requestIntervalInMilliseconds,attr"`
+				} `xml:"denyByRequestRate"`
+			} `xml:"dynamicIpSecurity"`
 		} `xml:"security"`
 	} `xml:"system.webServer"`
 }
@@ -49,6 +80,19 @@ var _ bool = Describe("ApplicationHostConfig", func() {
 		Expect(err).ToNot(HaveOccurred())
 	}
 
+	var createModule = func(targetFilePath string) {
+		fixture := filepath.Join("..", "fixtures", "aspnet-win32", "dist", "bin", "lib", "x64", "VersionDll.dll")
+		if runtime.GOARCH == "386" {
+			fixture = filepath.Join("..", "fixtures", "aspnet-win32", "dist", "bin", "lib", "Win32", "VersionDll.dll")
+		}
+		contents, err := os.ReadFile(fixture)
+		Expect(err).ToNot(HaveOccurred())
+		err = os.MkdirAll(filepath.Dir(targetFilePath), 0777)
+		Expect(err).ToNot(HaveOccurred())
+		err = os.WriteFile(targetFilePath, contents, 0666)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
 	var basicDeps = func(workingDirectory string) (listenPort int, rootPath string, tmpPath string, contextPath string, uuid string) {
 		listenPort = 8080
 		rootPath = workingDirectory + "/rootPath"
@@ -59,6 +103,34 @@ var _ bool = Describe("ApplicationHostConfig", func() {
 		return
 	}
 
+	var createFakeWindir = func(images ...string) string {
+		fakeWindir := filepath.Join(workingDirectoryPath, "Windows")
+		requiredImages := []string{
+			`System32\inetsrv\cachuri.dll`,
+			`System32\inetsrv\cachfile.dll`,
+			`System32\inetsrv\cachtokn.dll`,
+			`System32\inetsrv\cachhttp.dll`,
+			`System32\inetsrv\compstat.dll`,
+			`System32\inetsrv\defdoc.dll`,
+			`System32\inetsrv\dirlist.dll`,
+			`System32\inetsrv\protsup.dll`,
+			`System32\inetsrv\static.dll`,
+			`System32\inetsrv\authanon.dll`,
+			`System32\inetsrv\modrqflt.dll`,
+			`System32\inetsrv\custerr.dll`,
+			`System32\inetsrv\loghttp.dll`,
+			`System32\inetsrv\isapi.dll`,
+			`System32\inetsrv\filter.dll`,
+			`System32\inetsrv\validcfg.dll`,
+			`Microsoft.NET\Framework\v4.0.30319\webengine4.dll`,
+			`Microsoft.NET\Framework64\v4.0.30319\webengine4.dll`,
+		}
+		for _, image := range append(requiredImages, images...) {
+			createAllFiles(filepath.Join(fakeWindir, image))
+		}
+		return fakeWindir
+	}
+
 	BeforeEach(func() {
 		var err error
 
@@ -81,6 +153,62 @@ var _ bool = Describe("ApplicationHostConfig", func() {
 			_, err = os.Stat(hwcConfig.ApplicationHostConfigPath)
 			Expect(err).ToNot(HaveOccurred())
 		})
+
+		It("hides the hwc settings files from requests", func() {
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			for _, name := range []string{"hwc.yml", "hwc.yaml", "hwc.json"} {
+				Expect(string(configFileContents)).To(ContainSubstring(`<add segment="` + name + `" />`))
+			}
+		})
+	})
+
+	Context("When hwc settings files are named in the environment", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("HWC_WARMUP_FILE")).To(Succeed())
+			Expect(os.Unsetenv("HWC_SERVICE_MAPPINGS")).To(Succeed())
+		})
+
+		It("hides a warm-up file in the app root from requests", func() {
+			Expect(os.Setenv("HWC_WARMUP_FILE", filepath.Join("config", "warmup.json"))).To(Succeed())
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configFileContents)).To(ContainSubstring(`<add segment="warmup.json" />`))
+		})
+
+		It("hides a service mappings file in the app root from requests", func() {
+			Expect(os.Setenv("HWC_SERVICE_MAPPINGS", "service-mappings.json")).To(Succeed())
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configFileContents)).To(ContainSubstring(`<add segment="service-mappings.json" />`))
+		})
+
+		It("leaves a warm-up file outside the app root alone", func() {
+			Expect(os.Setenv("HWC_WARMUP_FILE", filepath.Join(workingDirectoryPath, "warmup.json"))).To(Succeed())
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configFileContents)).ToNot(ContainSubstring(`<add segment="warmup.json" />`))
+		})
 	})
 
 	Context("When custom modules are specified", func() {
@@ -102,13 +230,13 @@ var _ bool = Describe("ApplicationHostConfig", func() {
 			Expect(err).ToNot(HaveOccurred())
 
 			someDLLFilePath := filepath.Join(someDir, "someModule", "mymodule.dll")
-			createAllFiles(someDLLFilePath)
+			createModule(someDLLFilePath)
 
 			otherDLLFilePath := filepath.Join(otherDir, "otherModule", "mymodule.dll")
-			createAllFiles(otherDLLFilePath)
+			createModule(otherDLLFilePath)
 
 			linkSourcePath := filepath.Join(workingDirectoryPath, "sourceModule.dll")
-			createAllFiles(linkSourcePath)
+			createModule(linkSourcePath)
 
 			linkFilePath := filepath.Join(someDir, "myLinkedModule", "linkModule.dll")
 			err = os.MkdirAll(filepath.Dir(linkFilePath), 0777)
@@ -134,6 +262,75 @@ var _ bool = Describe("ApplicationHostConfig", func() {
 			Expect(string(configFileContents)).To(ContainSubstring("<add name=\"otherModule\" lockItem=\"true\" />"))
 		})
 
+		It("skips files that are not PE images", func() {
+			var err error
+
+			err = os.Setenv("HWC_NATIVE_MODULES", someDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			someDLLFilePath := filepath.Join(someDir, "someModule", "mymodule.dll")
+			createModule(someDLLFilePath)
+
+			symbolsFilePath := filepath.Join(someDir, "someModule", "mymodule.pdb")
+			createAllFiles(symbolsFilePath)
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(configFileContents)).To(ContainSubstring("<add name=\"someModule\" image=\"" + someDLLFilePath + "\""))
+			Expect(string(configFileContents)).NotTo(ContainSubstring(symbolsFilePath))
+		})
+
+		It("skips directories nested in a module directory", func() {
+			Expect(os.Setenv("HWC_NATIVE_MODULES", someDir)).To(Succeed())
+
+			someDLLFilePath := filepath.Join(someDir, "someModule", "mymodule.dll")
+			createModule(someDLLFilePath)
+			nestedDirPath := filepath.Join(someDir, "someModule", "x64")
+			Expect(os.MkdirAll(nestedDirPath, 0777)).To(Succeed())
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(configFileContents)).To(ContainSubstring("<add name=\"someModule\" image=\"" + someDLLFilePath + "\""))
+			Expect(string(configFileContents)).NotTo(ContainSubstring(nestedDirPath))
+		})
+
+		It("returns an error naming a directory without PE images", func() {
+			Expect(os.Setenv("HWC_NATIVE_MODULES", someDir)).To(Succeed())
+			createAllFiles(filepath.Join(someDir, "someModule", "readme.txt"))
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError("HWC_NATIVE_MODULES: " + someDir + " contains no PE images to load as native modules"))
+		})
+
+		It("refuses to load a module whose sidecar checksum does not match", func() {
+			var err error
+
+			err = os.Setenv("HWC_NATIVE_MODULES", someDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			someDLLFilePath := filepath.Join(someDir, "someModule", "mymodule.dll")
+			createModule(someDLLFilePath)
+
+			err = os.WriteFile(someDLLFilePath+".sha256", []byte(strings.Repeat("0", 64)+"\n"), 0666)
+			Expect(err).ToNot(HaveOccurred())
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, _ = hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError(ContainSubstring("HWC refusing to load native module " + someDLLFilePath)))
+		})
+
 		It("returns error when user provided directory is empty", func() {
 			var err error
 			emptyModulesDirectoryPath := filepath.Join(workingDirectoryPath, "modules")
@@ -151,6 +348,229 @@ var _ bool = Describe("ApplicationHostConfig", func() {
 		})
 	})
 
+	Context("When optional baseline modules are not installed", func() {
+		var windir string
+
+		BeforeEach(func() {
+			windir = os.Getenv("WINDIR")
+			Expect(os.Setenv("WINDIR", createFakeWindir())).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("WINDIR", windir)).To(Succeed())
+		})
+
+		It("omits them from globalModules and modules", func() {
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hwcConfig.OmittedModules).To(ContainElements("DigestAuthenticationModule", "DynamicIpRestrictionModule", "WindowsAuthenticationModule"))
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configFileContents)).NotTo(ContainSubstring("DigestAuthenticationModule"))
+			Expect(string(configFileContents)).NotTo(ContainSubstring("DynamicIpRestrictionModule"))
+			Expect(string(configFileContents)).To(ContainSubstring("<add name=\"StaticFileModule\" lockItem=\"true\" />"))
+			for _, managedModule := range []string{
+				`<add name="OutputCache" type="System.Web.Caching.OutputCacheModule" preCondition="managedHandler" />`,
+				`<add name="Session" type="System.Web.SessionState.SessionStateModule" preCondition="managedHandler" />`,
+				`<add name="WindowsAuthentication" type="System.Web.Security.WindowsAuthenticationModule" preCondition="managedHandler" />`,
+				`<add name="FormsAuthentication" type="System.Web.Security.FormsAuthenticationModule" preCondition="managedHandler" />`,
+				`<add name="DefaultAuthentication" type="System.Web.Security.DefaultAuthenticationModule" preCondition="managedHandler" />`,
+				`<add name="RoleManager" type="System.Web.Security.RoleManagerModule" preCondition="managedHandler" />`,
+				`<add name="UrlAuthorization" type="System.Web.Security.UrlAuthorizationModule" preCondition="managedHandler" />`,
+				`<add name="FileAuthorization" type="System.Web.Security.FileAuthorizationModule" preCondition="managedHandler" />`,
+				`<add name="AnonymousIdentification" type="System.Web.Security.AnonymousIdentificationModule" preCondition="managedHandler" />`,
+				`<add name="Profile" type="System.Web.Profile.ProfileModule" preCondition="managedHandler" />`,
+				`<add name="UrlMappingsModule" type="System.Web.UrlMappingsModule" preCondition="managedHandler" />`,
+				`<add name="ServiceModel-4.0" type="System.ServiceModel.Activation.ServiceHttpModule, System.ServiceModel.Activation, Version=4.0.0.0, Culture=neutral, PublicKeyToken=31bf3856ad364e35" preCondition="managedHandler,runtimeVersionv4.0" />`,
+				`<add name="UrlRoutingModule-4.0" type="System.Web.Routing.UrlRoutingModule" preCondition="managedHandler,runtimeVersionv4.0" />`,
+				`<add name="ScriptModule-4.0" type="System.Web.Handlers.ScriptModule, System.Web.Extensions, Version=4.0.0.0, Culture=neutral, PublicKeyToken=31bf3856ad364e35" preCondition="managedHandler,runtimeVersionv4.0" />`,
+			} {
+				Expect(string(configFileContents)).To(ContainSubstring(managedModule))
+			}
+
+			var config Configuration
+			err = xml.Unmarshal(configFileContents, &config)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.SystemWebServer.Security.Authentication.WindowsAuthentication.Enabled).To(Equal("false"))
+			Expect(string(configFileContents)).To(ContainSubstring(`<webSocket enabled="false" />`))
+		})
+
+		It("refuses to enable websockets without WebSocketModule", func() {
+			Expect(os.Setenv("HWC_WEBSOCKETS", "true")).To(Succeed())
+			defer os.Unsetenv("HWC_WEBSOCKETS")
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError(ContainSubstring("HWC_WEBSOCKETS=true requires WebSocketModule")))
+		})
+
+		It("refuses to enable windows authentication without WindowsAuthenticationModule", func() {
+			Expect(os.Setenv("HWC_WINDOWS_AUTH", "ntlm")).To(Succeed())
+			defer os.Unsetenv("HWC_WINDOWS_AUTH")
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError(ContainSubstring("HWC_WINDOWS_AUTH requires WindowsAuthenticationModule")))
+		})
+
+		It("refuses to disable anonymous authentication without WindowsAuthenticationModule", func() {
+			Expect(os.Setenv("HWC_ANONYMOUS_AUTH", "false")).To(Succeed())
+			defer os.Unsetenv("HWC_ANONYMOUS_AUTH")
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError(ContainSubstring("HWC_ANONYMOUS_AUTH=false requires windows authentication")))
+		})
+
+		It("refuses dynamic IP restrictions without DynamicIpRestrictionModule", func() {
+			Expect(os.Setenv("HWC_IP_MAX_REQUESTS", "20")).To(Succeed())
+			defer os.Unsetenv("HWC_IP_MAX_REQUESTS")
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError(ContainSubstring("require DynamicIpRestrictionModule")))
+		})
+	})
+
+	Context("When optional IIS modules are installed", func() {
+		var windir string
+
+		BeforeEach(func() {
+			windir = os.Getenv("WINDIR")
+			fakeWindir := createFakeWindir(`system32\inetsrv\rewrite.dll`, `system32\inetsrv\iiscors.dll`)
+			Expect(os.Setenv("WINDIR", fakeWindir)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("WINDIR", windir)).To(Succeed())
+			Expect(os.Unsetenv("HWC_DISABLE_OPTIONAL_MODULES")).To(Succeed())
+		})
+
+		It("enables each detected module and its config sections", func() {
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hwcConfig.OptionalModules).To(Equal([]string{"RewriteModule", "CorsModule"}))
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configFileContents)).To(ContainSubstring(`<sectionGroup name="rewrite">`))
+			Expect(string(configFileContents)).To(ContainSubstring(`<section name="cors"`))
+			Expect(string(configFileContents)).To(ContainSubstring(`<add name="CorsModule" image="%windir%\system32\inetsrv\iiscors.dll"`))
+			Expect(string(configFileContents)).To(ContainSubstring(`<add name="CorsModule" />`))
+			Expect(string(configFileContents)).NotTo(ContainSubstring(`<section name="applicationInitialization"`))
+			Expect(string(configFileContents)).NotTo(ContainSubstring(`<section name="webFarms"`))
+		})
+
+		It("leaves out modules disabled by HWC_DISABLE_OPTIONAL_MODULES", func() {
+			Expect(os.Setenv("HWC_DISABLE_OPTIONAL_MODULES", "RewriteModule")).To(Succeed())
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hwcConfig.OptionalModules).To(Equal([]string{"CorsModule"}))
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configFileContents)).NotTo(ContainSubstring("RewriteModule"))
+		})
+
+		It("rejects unknown module names in HWC_DISABLE_OPTIONAL_MODULES", func() {
+			Expect(os.Setenv("HWC_DISABLE_OPTIONAL_MODULES", "RewriteModul")).To(Succeed())
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError(`HWC_DISABLE_OPTIONAL_MODULES: unknown optional module "RewriteModul"`))
+		})
+	})
+
+	Context("When bind addresses are specified", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("HWC_BIND_ADDRESS")).To(Succeed())
+		})
+
+		It("binds to every address by default", func() {
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hwcConfig.BindAddresses).To(Equal([]string{"*"}))
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Count(string(configFileContents), "<binding ")).To(Equal(1))
+			Expect(string(configFileContents)).To(ContainSubstring(fmt.Sprintf(`<binding protocol="http" bindingInformation="*:%d:" />`, listenPort)))
+		})
+
+		It("renders a binding for each address, with IPv6 addresses in brackets", func() {
+			Expect(os.Setenv("HWC_BIND_ADDRESS", "10.0.0.5,fd00::1")).To(Succeed())
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hwcConfig.BindAddress).To(Equal("10.0.0.5"))
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Count(string(configFileContents), "<binding ")).To(Equal(2))
+			Expect(string(configFileContents)).To(ContainSubstring(fmt.Sprintf(`<binding protocol="http" bindingInformation="10.0.0.5:%d:" />`, listenPort)))
+			Expect(string(configFileContents)).To(ContainSubstring(fmt.Sprintf(`<binding protocol="http" bindingInformation="[fd00::1]:%d:" />`, listenPort)))
+		})
+
+		It("rejects an invalid address", func() {
+			Expect(os.Setenv("HWC_BIND_ADDRESS", "10.0.0.5,[fd00::1")).To(Succeed())
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError(`HWC_BIND_ADDRESS: bind address "[fd00::1" has unbalanced brackets`))
+		})
+	})
+
+	Context("When websocket settings are specified", func() {
+		AfterEach(func() {
+			Expect(os.Unsetenv("HWC_WEBSOCKETS")).To(Succeed())
+			Expect(os.Unsetenv("HWC_WEBSOCKET_PING_INTERVAL")).To(Succeed())
+			Expect(os.Unsetenv("HWC_WEBSOCKET_RECEIVE_BUFFER_LIMIT")).To(Succeed())
+		})
+
+		It("renders them into the webSocket section", func() {
+			Expect(os.Setenv("HWC_WEBSOCKETS", "true")).To(Succeed())
+			Expect(os.Setenv("HWC_WEBSOCKET_PING_INTERVAL", "90s")).To(Succeed())
+			Expect(os.Setenv("HWC_WEBSOCKET_RECEIVE_BUFFER_LIMIT", "8388608")).To(Succeed())
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configFileContents)).To(ContainSubstring(`<webSocket enabled="true" pingInterval="00:01:30" receiveBufferLimit="8388608" />`))
+		})
+
+		It("disables websockets", func() {
+			Expect(os.Setenv("HWC_WEBSOCKETS", "false")).To(Succeed())
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(configFileContents)).To(ContainSubstring(`<webSocket enabled="false" />`))
+		})
+
+		It("rejects an invalid ping interval", func() {
+			Expect(os.Setenv("HWC_WEBSOCKET_PING_INTERVAL", "soon")).To(Succeed())
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError(`HWC_WEBSOCKET_PING_INTERVAL must be a positive duration such as 30s, got "soon"`))
+		})
+	})
+
 	Context("When windowsauthentication is defined", func() {
 		It("adds secure windows auth config values to applicationHost.config", func() {
 			var err error
@@ -172,6 +592,355 @@ var _ bool = Describe("ApplicationHostConfig", func() {
 
 			Expect(config.SystemWebServer.Security.Authentication.WindowsAuthentication.Providers.Add).To(HaveLen(1))
 			Expect(config.SystemWebServer.Security.Authentication.WindowsAuthentication.Providers.Add[0].Value).To(Equal("Negotiate"), "Not Negotiate")
+			Expect(config.SystemWebServer.Security.Authentication.WindowsAuthentication.UseKernelMode).To(BeEmpty())
+			Expect(config.SystemWebServer.Security.Authentication.WindowsAuthentication.ExtendedProtection.TokenChecking).To(Equal("None"))
+
+			Expect(config.SystemWebServer.Security.Authentication.AnonymousAuthentication.Enabled).To(Equal("true"))
+			Expect(config.SystemWebServer.Security.Authentication.AnonymousAuthentication.UserName).To(Equal("IUSR"))
+		})
+	})
+
+	Context("When authentication settings are specified", func() {
+		var readConfig = func() Configuration {
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			var config Configuration
+			Expect(xml.Unmarshal(configFileContents, &config)).To(Succeed())
+			return config
+		}
+
+		AfterEach(func() {
+			for _, name := range []string{"HWC_WINDOWS_AUTH", "HWC_WINDOWS_AUTH_KERNEL_MODE", "HWC_WINDOWS_AUTH_EXTENDED_PROTECTION", "HWC_ANONYMOUS_AUTH", "HWC_ANONYMOUS_AUTH_USER"} {
+				Expect(os.Unsetenv(name)).To(Succeed())
+			}
+		})
+
+		It("renders the chosen providers, kernel mode and extended protection", func() {
+			Expect(os.Setenv("HWC_WINDOWS_AUTH", "ntlm, Negotiate")).To(Succeed())
+			Expect(os.Setenv("HWC_WINDOWS_AUTH_KERNEL_MODE", "false")).To(Succeed())
+			Expect(os.Setenv("HWC_WINDOWS_AUTH_EXTENDED_PROTECTION", "require")).To(Succeed())
+
+			windowsAuth := readConfig().SystemWebServer.Security.Authentication.WindowsAuthentication
+			Expect(windowsAuth.Enabled).To(Equal("true"))
+			Expect(windowsAuth.Providers.Add).To(HaveLen(2))
+			Expect(windowsAuth.Providers.Add[0].Value).To(Equal("NTLM"))
+			Expect(windowsAuth.Providers.Add[1].Value).To(Equal("Negotiate"))
+			Expect(windowsAuth.UseKernelMode).To(Equal("false"))
+			Expect(windowsAuth.ExtendedProtection.TokenChecking).To(Equal("Require"))
+		})
+
+		It("turns windows authentication off and keeps anonymous authentication", func() {
+			Expect(os.Setenv("HWC_WINDOWS_AUTH", "off")).To(Succeed())
+
+			authentication := readConfig().SystemWebServer.Security.Authentication
+			Expect(authentication.WindowsAuthentication.Enabled).To(Equal("false"))
+			Expect(authentication.WindowsAuthentication.Providers.Add).To(BeEmpty())
+			Expect(authentication.AnonymousAuthentication.Enabled).To(Equal("true"))
+		})
+
+		It("runs anonymous requests as the configured user", func() {
+			Expect(os.Setenv("HWC_ANONYMOUS_AUTH_USER", "process")).To(Succeed())
+
+			Expect(readConfig().SystemWebServer.Security.Authentication.AnonymousAuthentication.UserName).To(BeEmpty())
+		})
+
+		It("disables anonymous authentication", func() {
+			Expect(os.Setenv("HWC_ANONYMOUS_AUTH", "false")).To(Succeed())
+
+			authentication := readConfig().SystemWebServer.Security.Authentication
+			Expect(authentication.AnonymousAuthentication.Enabled).To(Equal("false"))
+			Expect(authentication.WindowsAuthentication.Enabled).To(Equal("true"))
+		})
+
+		DescribeTable("rejects invalid settings",
+			func(env map[string]string, message string) {
+				for name, value := range env {
+					Expect(os.Setenv(name, value)).To(Succeed())
+				}
+
+				listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+				err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("both schemes disabled", map[string]string{"HWC_WINDOWS_AUTH": "off", "HWC_ANONYMOUS_AUTH": "false"}, "leave no way to authenticate requests"),
+			Entry("unknown provider", map[string]string{"HWC_WINDOWS_AUTH": "basic"}, `HWC_WINDOWS_AUTH must be off or a list of`),
+			Entry("kernel mode without windows authentication", map[string]string{"HWC_WINDOWS_AUTH": "off", "HWC_WINDOWS_AUTH_KERNEL_MODE": "true"}, "require windows authentication"),
+			Entry("extended protection without windows authentication", map[string]string{"HWC_WINDOWS_AUTH": "off", "HWC_WINDOWS_AUTH_EXTENDED_PROTECTION": "allow"}, "require windows authentication"),
+			Entry("unknown extended protection", map[string]string{"HWC_WINDOWS_AUTH_EXTENDED_PROTECTION": "always"}, "HWC_WINDOWS_AUTH_EXTENDED_PROTECTION must be none, allow or require"),
+			Entry("invalid anonymous flag", map[string]string{"HWC_ANONYMOUS_AUTH": "maybe"}, "HWC_ANONYMOUS_AUTH must be true or false"),
+			Entry("invalid anonymous user", map[string]string{"HWC_ANONYMOUS_AUTH_USER": "a<b"}, "HWC_ANONYMOUS_AUTH_USER must be a user name"),
+		)
+	})
+
+	Context("When IP restrictions are specified", func() {
+		var windir string
+
+		BeforeEach(func() {
+			windir = os.Getenv("WINDIR")
+			Expect(os.Setenv("WINDIR", createFakeWindir(`System32\inetsrv\iprestr.dll`))).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("WINDIR", windir)).To(Succeed())
+			for _, name := range []string{"HWC_IP_ALLOW", "HWC_IP_DENY", "HWC_IP_MAX_CONCURRENT_REQUESTS", "HWC_IP_MAX_REQUESTS", "HWC_IP_REQUEST_INTERVAL"} {
+				Expect(os.Unsetenv(name)).To(Succeed())
+			}
+		})
+
+		var readConfig = func() (string, Configuration) {
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			var config Configuration
+			Expect(xml.Unmarshal(configFileContents, &config)).To(Succeed())
+			return string(configFileContents), config
+		}
+
+		It("leaves ipSecurity empty by default", func() {
+			contents, config := readConfig()
+			Expect(config.SystemWebServer.Security.IPSecurity.Add).To(BeEmpty())
+			Expect(contents).To(ContainSubstring("<ipSecurity />"))
+			Expect(contents).NotTo(ContainSubstring("dynamicIpSecurity"))
 		})
+
+		It("converts the allow and deny lists into address and subnet mask entries", func() {
+			Expect(os.Setenv("HWC_IP_ALLOW", "10.0.0.0/8, 192.168.1.7 2001:db8::/32")).To(Succeed())
+			Expect(os.Setenv("HWC_IP_DENY", "10.1.0.0/16")).To(Succeed())
+
+			_, config := readConfig()
+			ipSecurity := config.SystemWebServer.Security.IPSecurity
+			Expect(ipSecurity.AllowUnlisted).To(Equal("false"))
+			Expect(ipSecurity.Add).To(HaveLen(4))
+			Expect(ipSecurity.Add[0].IPAddress).To(Equal("10.1.0.0"))
+			Expect(ipSecurity.Add[0].SubnetMask).To(Equal("255.255.0.0"))
+			Expect(ipSecurity.Add[0].Allowed).To(Equal("false"))
+			Expect(ipSecurity.Add[1].IPAddress).To(Equal("10.0.0.0"))
+			Expect(ipSecurity.Add[1].SubnetMask).To(Equal("255.0.0.0"))
+			Expect(ipSecurity.Add[1].Allowed).To(Equal("true"))
+			Expect(ipSecurity.Add[2].IPAddress).To(Equal("192.168.1.7"))
+			Expect(ipSecurity.Add[2].SubnetMask).To(Equal("255.255.255.255"))
+			Expect(ipSecurity.Add[3].IPAddress).To(Equal("2001:db8::"))
+			Expect(ipSecurity.Add[3].SubnetMask).To(Equal("32"))
+		})
+
+		It("allows unlisted callers when only a deny list is given", func() {
+			Expect(os.Setenv("HWC_IP_DENY", "203.0.113.0/24")).To(Succeed())
+
+			_, config := readConfig()
+			Expect(config.SystemWebServer.Security.IPSecurity.AllowUnlisted).To(Equal("true"))
+			Expect(config.SystemWebServer.Security.IPSecurity.Add).To(HaveLen(1))
+		})
+
+		It("renders the dynamic IP restriction thresholds", func() {
+			Expect(os.Setenv("WINDIR", createFakeWindir(`System32\inetsrv\iprestr.dll`, `System32\inetsrv\diprestr.dll`))).To(Succeed())
+			Expect(os.Setenv("HWC_IP_MAX_CONCURRENT_REQUESTS", "10")).To(Succeed())
+			Expect(os.Setenv("HWC_IP_MAX_REQUESTS", "50")).To(Succeed())
+			Expect(os.Setenv("HWC_IP_REQUEST_INTERVAL", "1s")).To(Succeed())
+
+			contents, config := readConfig()
+			Expect(contents).To(ContainSubstring(`<section name="dynamicIpSecurity" overrideModeDefault="Deny" />`))
+			Expect(contents).To(ContainSubstring(`<add name="DynamicIpRestrictionModule" lockItem="true" />`))
+			dynamic := config.SystemWebServer.Security.DynamicIPSecurity
+			Expect(dynamic.DenyByConcurrentRequests.Enabled).To(Equal("true"))
+			Expect(dynamic.DenyByConcurrentRequests.MaxConcurrentRequests).To(Equal("10"))
+			Expect(dynamic.DenyByRequestRate.MaxRequests).To(Equal("50"))
+			Expect(dynamic.DenyByRequestRate.RequestIntervalInMilliseconds).To(Equal("1000"))
+		})
+
+		DescribeTable("rejects invalid settings",
+			func(name, value, message string) {
+				Expect(os.Setenv(name, value)).To(Succeed())
+
+				listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+				err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("malformed CIDR", "HWC_IP_ALLOW", "10.0.0.0/33", `HWC_IP_ALLOW: "10.0.0.0/33" is not a CIDR range`),
+			Entry("host name", "HWC_IP_DENY", "example.com", `HWC_IP_DENY: "example.com" is not an IP address or CIDR range`),
+			Entry("host bits set", "HWC_IP_ALLOW", "10.0.0.5/24", `"10.0.0.5/24" has host bits set; use 10.0.0.0/24`),
+			Entry("invalid concurrent request limit", "HWC_IP_MAX_CONCURRENT_REQUESTS", "0", "HWC_IP_MAX_CONCURRENT_REQUESTS must be a positive number"),
+			Entry("interval without a request limit", "HWC_IP_REQUEST_INTERVAL", "1s", "HWC_IP_REQUEST_INTERVAL requires HWC_IP_MAX_REQUESTS"),
+		)
+	})
+
+	Context("When X-Forwarded-For is honored", func() {
+		var windir string
+
+		BeforeEach(func() {
+			windir = os.Getenv("WINDIR")
+			Expect(os.Setenv("HWC_FORWARDED_FOR", "true")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("WINDIR", windir)).To(Succeed())
+			Expect(os.Unsetenv("HWC_FORWARDED_FOR")).To(Succeed())
+			Expect(os.Unsetenv("HWC_TRUSTED_PROXIES")).To(Succeed())
+		})
+
+		var generate = func() string {
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			return string(configFileContents)
+		}
+
+		It("enables proxy mode and logs the X-Forwarded-For header", func() {
+			Expect(os.Setenv("WINDIR", createFakeWindir())).To(Succeed())
+
+			contents := generate()
+			var config Configuration
+			Expect(xml.Unmarshal([]byte(contents), &config)).To(Succeed())
+			Expect(config.SystemWebServer.Security.IPSecurity.EnableProxyMode).To(Equal("true"))
+			Expect(contents).To(ContainSubstring(`<add logFieldName="X-Forwarded-For" sourceName="X-Forwarded-For" sourceType="RequestHeader" />`))
+			Expect(contents).NotTo(ContainSubstring("<rewrite>"))
+		})
+
+		It("rewrites REMOTE_ADDR for trusted proxies when URL Rewrite is installed", func() {
+			Expect(os.Setenv("WINDIR", createFakeWindir(`system32\inetsrv\rewrite.dll`))).To(Succeed())
+			Expect(os.Setenv("HWC_TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.7")).To(Succeed())
+
+			contents := generate()
+			Expect(contents).To(ContainSubstring(`<add name="REMOTE_ADDR" />`))
+			Expect(contents).To(ContainSubstring(`<add input="{REMOTE_ADDR}" pattern="^(?:10\.[^,\s]*|192\.168\.1\.7)$" />`))
+			Expect(contents).To(ContainSubstring(`<set name="REMOTE_ADDR" value="{C:1}" />`))
+		})
+
+		It("takes the rightmost X-Forwarded-For address that is not a trusted proxy", func() {
+			Expect(os.Setenv("WINDIR", createFakeWindir(`system32\inetsrv\rewrite.dll`))).To(Succeed())
+			Expect(os.Setenv("HWC_TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.7")).To(Succeed())
+
+			match := regexp.MustCompile(`<add input="\{HTTP_X_FORWARDED_FOR\}" pattern="([^"]+)" />`).FindStringSubmatch(generate())
+			Expect(match).To(HaveLen(2))
+			clientAddress := regexp.MustCompile("(?i)" + match[1])
+
+			for header, client := range map[string]string{
+				"203.0.113.9":           "203.0.113.9",
+				"203.0.113.9, 10.0.0.4": "203.0.113.9",
+				"198.51.100.1, 203.0.113.9,10.0.0.4 , 192.168.1.7": "203.0.113.9",
+				"198.51.100.1, 192.168.1.70":                       "192.168.1.70",
+				"10.0.0.4":                                         "10.0.0.4",
+			} {
+				Expect(clientAddress.FindStringSubmatch(header)).To(HaveLen(2), header)
+				Expect(clientAddress.FindStringSubmatch(header)[1]).To(Equal(client), header)
+			}
+		})
+
+		It("skips the REMOTE_ADDR rewrite without URL Rewrite", func() {
+			Expect(os.Setenv("WINDIR", createFakeWindir())).To(Succeed())
+			Expect(os.Setenv("HWC_TRUSTED_PROXIES", "10.0.0.0/8")).To(Succeed())
+
+			Expect(generate()).NotTo(ContainSubstring("<rewrite>"))
+		})
+
+		DescribeTable("rejects invalid trusted proxies",
+			func(value, message string) {
+				Expect(os.Setenv("HWC_TRUSTED_PROXIES", value)).To(Succeed())
+
+				listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+				err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("not an address", "router", `HWC_TRUSTED_PROXIES: "router" is not an IP address or CIDR range`),
+			Entry("off an octet boundary", "10.0.0.0/12", "must be an IPv4 range on an octet boundary"),
+			Entry("every caller", "0.0.0.0/0", "would trust every caller"),
+			Entry("IPv6 range", "fd00::/8", "must be a single IPv6 address"),
+		)
+
+		It("requires HWC_FORWARDED_FOR for trusted proxies", func() {
+			Expect(os.Unsetenv("HWC_FORWARDED_FOR")).To(Succeed())
+			Expect(os.Setenv("HWC_TRUSTED_PROXIES", "10.0.0.0/8")).To(Succeed())
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError("HWC_TRUSTED_PROXIES requires HWC_FORWARDED_FOR=true"))
+		})
+	})
+
+	Context("When redirects are specified", func() {
+		var windir string
+
+		BeforeEach(func() {
+			windir = os.Getenv("WINDIR")
+			Expect(os.Setenv("WINDIR", createFakeWindir(`system32\inetsrv\rewrite.dll`))).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.Setenv("WINDIR", windir)).To(Succeed())
+			Expect(os.Unsetenv("HWC_FORCE_HTTPS")).To(Succeed())
+			Expect(os.Unsetenv("HWC_CANONICAL_HOST")).To(Succeed())
+			Expect(os.Unsetenv("HWC_DISABLE_OPTIONAL_MODULES")).To(Succeed())
+		})
+
+		var generate = func() string {
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, hwcConfig := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).ToNot(HaveOccurred())
+			configFileContents, err := os.ReadFile(hwcConfig.ApplicationHostConfigPath)
+			Expect(err).ToNot(HaveOccurred())
+			return string(configFileContents)
+		}
+
+		It("renders no rewrite rules by default", func() {
+			Expect(generate()).NotTo(ContainSubstring("<globalRules>"))
+		})
+
+		It("redirects requests forwarded over http to https", func() {
+			Expect(os.Setenv("HWC_FORCE_HTTPS", "true")).To(Succeed())
+
+			contents := generate()
+			Expect(contents).To(ContainSubstring(`<rule name="hwc-force-https" stopProcessing="true">`))
+			Expect(contents).To(ContainSubstring(`<add input="{HTTP_X_FORWARDED_PROTO}" pattern="^http$" />`))
+			Expect(contents).To(ContainSubstring(`<action type="Redirect" url="https://{HTTP_HOST}{REQUEST_URI}" appendQueryString="false" redirectType="Permanent" />`))
+			Expect(contents).NotTo(ContainSubstring("hwc-canonical-host"))
+		})
+
+		It("redirects other hosts to the canonical host", func() {
+			Expect(os.Setenv("HWC_CANONICAL_HOST", "WWW.Example.com")).To(Succeed())
+
+			contents := generate()
+			Expect(contents).To(ContainSubstring(`<add input="{HTTP_HOST}" pattern="^www\.example\.com(:\d+)?$" negate="true" />`))
+			Expect(contents).To(ContainSubstring(`<action type="Redirect" url="{C:1}://www.example.com{REQUEST_URI}" appendQueryString="false" redirectType="Permanent" />`))
+			Expect(contents).NotTo(ContainSubstring("hwc-force-https"))
+		})
+
+		It("redirects to https on the canonical host in one step", func() {
+			Expect(os.Setenv("HWC_FORCE_HTTPS", "true")).To(Succeed())
+			Expect(os.Setenv("HWC_CANONICAL_HOST", "www.example.com")).To(Succeed())
+
+			contents := generate()
+			Expect(contents).To(ContainSubstring(`url="https://www.example.com{REQUEST_URI}"`))
+			Expect(strings.Index(contents, "hwc-canonical-host")).To(BeNumerically("<", strings.Index(contents, "hwc-force-https")))
+		})
+
+		It("refuses redirects without RewriteModule", func() {
+			Expect(os.Setenv("HWC_FORCE_HTTPS", "true")).To(Succeed())
+			Expect(os.Setenv("HWC_DISABLE_OPTIONAL_MODULES", "RewriteModule")).To(Succeed())
+
+			listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+			err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+			Expect(err).To(MatchError(ContainSubstring("HWC_FORCE_HTTPS requires RewriteModule")))
+		})
+
+		DescribeTable("rejects invalid settings",
+			func(name, value, message string) {
+				Expect(os.Setenv(name, value)).To(Succeed())
+
+				listenPort, rootPath, tmpPath, contextPath, uuid := basicDeps(workingDirectoryPath)
+				err, _ := hwcconfig.New(listenPort, rootPath, tmpPath, contextPath, uuid)
+				Expect(err).To(MatchError(message))
+			},
+			Entry("invalid flag", "HWC_FORCE_HTTPS", "always", `HWC_FORCE_HTTPS must be true or false, got "always"`),
+			Entry("URL as host", "HWC_CANONICAL_HOST", "https://www.example.com", `HWC_CANONICAL_HOST must be a host name such as www.example.com, got "https://www.example.com"`),
+			Entry("host with a port", "HWC_CANONICAL_HOST", "www.example.com:443", `HWC_CANONICAL_HOST must be a host name such as www.example.com, got "www.example.com:443"`),
+		)
 	})
 })
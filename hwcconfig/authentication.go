@@ -0,0 +1,115 @@
+package hwcconfig
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// windowsAuthProviders maps the accepted HWC_WINDOWS_AUTH values to the
+// provider names IIS expects
+var windowsAuthProviders = map[string]string{
+	"negotiate":          "Negotiate",
+	"ntlm":               "NTLM",
+	"negotiate:kerberos": "Negotiate:Kerberos",
+}
+
+// AuthenticationConfig holds the authentication settings rendered into the
+// applicationHost.config
+type AuthenticationConfig struct {
+	Windows   WindowsAuthConfig
+	Anonymous AnonymousAuthConfig
+}
+
+type WindowsAuthConfig struct {
+	Enabled   bool
+	Providers []string
+	// UseKernelMode is "true", "false" or empty for the IIS default
+	UseKernelMode string
+	// TokenChecking of extendedProtection: None, Allow or Require
+	TokenChecking string
+
+	// explicit is set when HWC_WINDOWS_AUTH was given
+	explicit bool
+}
+
+type AnonymousAuthConfig struct {
+	Enabled bool
+	// UserName is the account anonymous requests run as; empty runs them as
+	// the hwc process identity
+	UserName string
+}
+
+func authenticationConfigFromEnv() (AuthenticationConfig, error) {
+	config := AuthenticationConfig{
+		Windows:   WindowsAuthConfig{Enabled: true, Providers: []string{"Negotiate"}, TokenChecking: "None"},
+		Anonymous: AnonymousAuthConfig{Enabled: true, UserName: "IUSR"},
+	}
+
+	if value := strings.TrimSpace(os.Getenv("HWC_WINDOWS_AUTH")); value != "" {
+		config.Windows.explicit = true
+		if strings.EqualFold(value, "off") {
+			config.Windows.Enabled = false
+			config.Windows.Providers = nil
+		} else {
+			config.Windows.Providers = nil
+			for _, name := range strings.Split(value, ",") {
+				provider, ok := windowsAuthProviders[strings.ToLower(strings.TrimSpace(name))]
+				if !ok {
+					return config, fmt.Errorf("HWC_WINDOWS_AUTH must be off or a list of negotiate, ntlm and negotiate:kerberos, got %q", value)
+				}
+				config.Windows.Providers = append(config.Windows.Providers, provider)
+			}
+		}
+	}
+
+	if value := os.Getenv("HWC_WINDOWS_AUTH_KERNEL_MODE"); value != "" {
+		kernelMode, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("HWC_WINDOWS_AUTH_KERNEL_MODE must be true or false, got %q", value)
+		}
+		config.Windows.UseKernelMode = strconv.FormatBool(kernelMode)
+	}
+
+	if value := os.Getenv("HWC_WINDOWS_AUTH_EXTENDED_PROTECTION"); value != "" {
+		switch strings.ToLower(value) {
+		case "none":
+			config.Windows.TokenChecking = "None"
+		case "allow":
+			config.Windows.TokenChecking = "Allow"
+		case "require":
+			config.Windows.TokenChecking = "Require"
+		default:
+			return config, fmt.Errorf("HWC_WINDOWS_AUTH_EXTENDED_PROTECTION must be none, allow or require, got %q", value)
+		}
+	}
+
+	if !config.Windows.Enabled && (config.Windows.UseKernelMode != "" || config.Windows.TokenChecking != "None") {
+		return config, fmt.Errorf("HWC_WINDOWS_AUTH_KERNEL_MODE and HWC_WINDOWS_AUTH_EXTENDED_PROTECTION require windows authentication, but HWC_WINDOWS_AUTH is off")
+	}
+
+	if value := os.Getenv("HWC_ANONYMOUS_AUTH"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("HWC_ANONYMOUS_AUTH must be true or false, got %q", value)
+		}
+		config.Anonymous.Enabled = enabled
+	}
+
+	if value := strings.TrimSpace(os.Getenv("HWC_ANONYMOUS_AUTH_USER")); value != "" {
+		if strings.EqualFold(value, "process") {
+			config.Anonymous.UserName = ""
+		} else if strings.ContainsAny(value, `"<>&'/[]:;|=,+*?@`) {
+			return config, fmt.Errorf("HWC_ANONYMOUS_AUTH_USER must be a user name such as IUSR or DOMAIN\\user, or process, got %q", value)
+		} else {
+			config.Anonymous.UserName = value
+		}
+	}
+
+	if !config.Anonymous.Enabled && !config.Windows.Enabled {
+		return config, fmt.Errorf("HWC_WINDOWS_AUTH=off and HWC_ANONYMOUS_AUTH=false leave no way to authenticate requests")
+	}
+
+	return config, nil
+}
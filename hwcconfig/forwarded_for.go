@@ -0,0 +1,107 @@
+package hwcconfig
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ForwardedForConfig holds the settings that make IIS see the client address
+// a trusted proxy, such as the gorouter, put in X-Forwarded-For
+type ForwardedForConfig struct {
+	Enabled bool
+	// TrustedProxies are the addresses allowed to set REMOTE_ADDR, as a
+	// pattern matching {REMOTE_ADDR} in a URL Rewrite condition
+	TrustedProxies string
+	// ClientAddress matches {HTTP_X_FORWARDED_FOR} and captures the rightmost
+	// address that is not a trusted proxy, skipping the hops that load
+	// balancers in front of the gorouter appended
+	ClientAddress string
+	// RewriteRemoteAddr is set once RewriteModule is enabled to install the
+	// REMOTE_ADDR rewrite
+	RewriteRemoteAddr bool
+}
+
+func forwardedForConfigFromEnv() (ForwardedForConfig, error) {
+	var config ForwardedForConfig
+
+	if value := os.Getenv("HWC_FORWARDED_FOR"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("HWC_FORWARDED_FOR must be true or false, got %q", value)
+		}
+		config.Enabled = enabled
+	}
+
+	proxies := strings.FieldsFunc(os.Getenv("HWC_TRUSTED_PROXIES"), isListSeparator)
+	if len(proxies) == 0 {
+		return config, nil
+	}
+	if !config.Enabled {
+		return config, fmt.Errorf("HWC_TRUSTED_PROXIES requires HWC_FORWARDED_FOR=true")
+	}
+
+	var patterns []string
+	for _, proxy := range proxies {
+		pattern, err := trustedProxyPattern(proxy)
+		if err != nil {
+			return config, fmt.Errorf("HWC_TRUSTED_PROXIES: %v", err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	trusted := "(?:" + strings.Join(patterns, "|") + ")"
+	config.TrustedProxies = "^" + trusted + "$"
+	config.ClientAddress = `(?:^|,)\s*([^,\s]+)(?:\s*,\s*` + trusted + `)*\s*$`
+
+	return config, nil
+}
+
+// trustedProxyPattern turns an address or CIDR range into a regular
+// expression matching a whole address, as URL Rewrite conditions cannot match
+// ranges. IPv4 ranges must fall on an octet boundary and IPv6 proxies must be
+// single addresses.
+func trustedProxyPattern(entry string) (string, error) {
+	var prefix netip.Prefix
+	if strings.Contains(entry, "/") {
+		var err error
+		prefix, err = netip.ParsePrefix(entry)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a CIDR range such as 10.0.0.0/8", entry)
+		}
+	} else {
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return "", fmt.Errorf("%q is not an IP address or CIDR range", entry)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	if masked := prefix.Masked(); masked != prefix {
+		return "", fmt.Errorf("%q has host bits set; use %s", entry, masked)
+	}
+
+	addr := prefix.Addr()
+	if !addr.Is4() {
+		if addr.Zone() != "" || prefix.Bits() != 128 {
+			return "", fmt.Errorf("%q must be a single IPv6 address", entry)
+		}
+		return regexp.QuoteMeta(addr.String()), nil
+	}
+
+	if prefix.Bits()%8 != 0 {
+		return "", fmt.Errorf("%q must be an IPv4 range on an octet boundary, such as /8, /16 or /24", entry)
+	}
+	if prefix.Bits() == 0 {
+		return "", fmt.Errorf("%q would trust every caller", entry)
+	}
+
+	octets := strings.Split(addr.String(), ".")[:prefix.Bits()/8]
+	pattern := regexp.QuoteMeta(strings.Join(octets, "."))
+	if prefix.Bits() == 32 {
+		return pattern, nil
+	}
+	return pattern + `\.[^,\s]*`, nil
+}
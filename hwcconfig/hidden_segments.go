@@ -0,0 +1,36 @@
+package hwcconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/hwc/settings"
+)
+
+// settingsFileVariables name files, relative to the app root unless
+// absolute, that configure hwc rather than the app and may hold credentials
+var settingsFileVariables = []string{"HWC_WARMUP_FILE", "HWC_SERVICE_MAPPINGS"}
+
+// hiddenSegments lists the names of the hwc settings files, and of the files
+// named by settingsFileVariables that lie inside the app root, so that the
+// site does not serve them. IIS hides a segment wherever it appears in the
+// URL, as it does for Web.config.
+func hiddenSegments(rootPath string) []string {
+	segments := append([]string{}, settings.FileNames...)
+	for _, name := range settingsFileVariables {
+		path := os.Getenv(name)
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(rootPath, path)
+		}
+		relative, err := filepath.Rel(rootPath, path)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			continue
+		}
+		segments = append(segments, filepath.Base(path))
+	}
+	return segments
+}
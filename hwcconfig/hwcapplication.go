@@ -1,11 +1,26 @@
 package hwcconfig
 
-import "strings"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
 
 // HwcApplication represents an application element under the IronFoundry site
 type HwcApplication struct {
 	PhysicalPath string
 	Path         string
+	// VirtualDirectories are served by the application in addition to its
+	// root directory
+	VirtualDirectories []*HwcVirtualDirectory
+}
+
+// HwcVirtualDirectory represents a virtualDirectory element of an application.
+// Path is relative to the application's path.
+type HwcVirtualDirectory struct {
+	PhysicalPath string
+	Path         string
 }
 
 // NewHwcApplications returns the set of HwcApplications that need to be created in
@@ -31,6 +46,164 @@ func NewHwcApplications(defaultRootPath, rootPath, contextPath string) []*HwcApp
 	return apps
 }
 
+// AddVirtualDirectories maps the virtual paths in mappings, a comma-separated
+// list such as "/=./public,/api=./api", to directories inside rootPath, and
+// returns apps with any applications it added. A path that is one of apps
+// replaces that application's directory. A path prefixed with "app:", such as
+// "app:/admin=./admin", becomes an application of its own, with its own
+// Web.config and bin directory. Any other path becomes a virtual directory of
+// the deepest application containing it.
+func AddVirtualDirectories(apps []*HwcApplication, rootPath, mappings string) ([]*HwcApplication, error) {
+	root, err := filepath.EvalSymlinks(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var directories []virtualMapping
+	seen := map[string]bool{}
+	for _, mapping := range strings.Split(mappings, ",") {
+		mapping = strings.TrimSpace(mapping)
+		if mapping == "" {
+			continue
+		}
+
+		m, err := parseVirtualMapping(root, mapping)
+		if err != nil {
+			return nil, err
+		}
+		if seen[strings.ToLower(m.virtualPath)] {
+			return nil, fmt.Errorf("%s is mapped more than once", m.virtualPath)
+		}
+		seen[strings.ToLower(m.virtualPath)] = true
+
+		// applications go first so that the directories below them are
+		// added to them rather than to their parent
+		if !m.application {
+			directories = append(directories, m)
+			continue
+		}
+		app := containingApplication(apps, m.virtualPath)
+		if strings.EqualFold(app.Path, m.virtualPath) {
+			app.PhysicalPath = m.physicalPath
+			continue
+		}
+		apps = append(apps, &HwcApplication{Path: m.virtualPath, PhysicalPath: m.physicalPath})
+	}
+
+	for _, m := range directories {
+		app := containingApplication(apps, m.virtualPath)
+		if strings.EqualFold(app.Path, m.virtualPath) {
+			app.PhysicalPath = m.physicalPath
+			continue
+		}
+		app.VirtualDirectories = append(app.VirtualDirectories, &HwcVirtualDirectory{
+			Path:         "/" + strings.TrimPrefix(m.virtualPath[len(app.Path):], "/"),
+			PhysicalPath: m.physicalPath,
+		})
+	}
+	return apps, nil
+}
+
+// virtualMapping is one entry of HWC_VIRTUAL_DIRECTORIES
+type virtualMapping struct {
+	virtualPath  string
+	physicalPath string
+	application  bool
+}
+
+func parseVirtualMapping(root, mapping string) (virtualMapping, error) {
+	var m virtualMapping
+
+	virtualPath, physicalPath, ok := strings.Cut(mapping, "=")
+	if !ok {
+		return m, fmt.Errorf("%q must be a virtual path and a directory, such as /api=./api", mapping)
+	}
+
+	virtualPath = strings.TrimSpace(virtualPath)
+	virtualPath, m.application = strings.CutPrefix(virtualPath, "app:")
+
+	var err error
+	m.virtualPath, err = cleanVirtualPath(strings.TrimSpace(virtualPath))
+	if err != nil {
+		return m, err
+	}
+
+	m.physicalPath, err = resolveInside(root, strings.TrimSpace(physicalPath))
+	if err != nil {
+		return m, fmt.Errorf("%s: %v", m.virtualPath, err)
+	}
+	return m, nil
+}
+
+// cleanVirtualPath validates path and removes any trailing '/'
+func cleanVirtualPath(path string) (string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("virtual path %q must start with /", path)
+	}
+	if path == "/" {
+		return path, nil
+	}
+	path = strings.TrimSuffix(path, "/")
+	for _, segment := range strings.Split(path, "/")[1:] {
+		if segment == "" || segment == "." || segment == ".." || strings.ContainsAny(segment, `\:*?"<>|%`) {
+			return "", fmt.Errorf("virtual path %q is not valid", path)
+		}
+	}
+	return path, nil
+}
+
+// resolveInside resolves the directory path relative to root and checks it
+// stays inside root once symlinks are followed
+func resolveInside(root, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("missing directory")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, filepath.FromSlash(path))
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("directory %s does not exist", path)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("directory %s is outside the app root %s", path, root)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", path)
+	}
+	return resolved, nil
+}
+
+// containingApplication returns the application with the longest path that
+// contains virtualPath; the root application contains every path
+func containingApplication(apps []*HwcApplication, virtualPath string) *HwcApplication {
+	var best *HwcApplication
+	for _, app := range apps {
+		if !containsVirtualPath(app.Path, virtualPath) {
+			continue
+		}
+		if best == nil || len(app.Path) > len(best.Path) {
+			best = app
+		}
+	}
+	return best
+}
+
+func containsVirtualPath(appPath, virtualPath string) bool {
+	if appPath == "/" {
+		return true
+	}
+	if len(virtualPath) < len(appPath) || !strings.EqualFold(virtualPath[:len(appPath)], appPath) {
+		return false
+	}
+	return len(virtualPath) == len(appPath) || virtualPath[len(appPath)] == '/'
+}
+
 // Removes the last segment from the path, but always returns a leading '/'
 func removeLastSegmentFromPath(path string) string {
 	i := strings.LastIndexByte(path, '/')
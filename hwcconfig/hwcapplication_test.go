@@ -2,6 +2,7 @@ package hwcconfig_test
 
 import (
 	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -97,4 +98,121 @@ var _ = Describe("HwcApplication", func() {
 			})
 		})
 	})
+
+	Describe("virtual directories", func() {
+		var apps []*HwcApplication
+
+		add := func(mappings string) {
+			var err error
+			apps, err = AddVirtualDirectories(apps, rootPath, mappings)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			var err error
+			rootPath, err = filepath.EvalSymlinks(rootPath)
+			Expect(err).NotTo(HaveOccurred())
+			for _, dir := range []string{"public", "api", filepath.Join("app", "static")} {
+				Expect(os.MkdirAll(filepath.Join(rootPath, dir), 0700)).To(Succeed())
+			}
+			Expect(os.WriteFile(filepath.Join(rootPath, "README"), nil, 0600)).To(Succeed())
+			apps = NewHwcApplications(defaultRootPath, rootPath, "/app")
+		})
+
+		It("replaces the directory of an application path", func() {
+			add("/=./public")
+			Expect(apps).To(ContainElement(&HwcApplication{
+				Path:         "/",
+				PhysicalPath: filepath.Join(rootPath, "public"),
+			}))
+			Expect(apps).To(ContainElement(&HwcApplication{
+				Path:         "/app",
+				PhysicalPath: rootPath,
+			}))
+		})
+
+		It("adds other paths to the deepest application containing them", func() {
+			add("/api=./api, /app/static/=app/static")
+			Expect(apps).To(ContainElement(&HwcApplication{
+				Path:         "/",
+				PhysicalPath: defaultRootPath,
+				VirtualDirectories: []*HwcVirtualDirectory{
+					{Path: "/api", PhysicalPath: filepath.Join(rootPath, "api")},
+				},
+			}))
+			Expect(apps).To(ContainElement(&HwcApplication{
+				Path:         "/app",
+				PhysicalPath: rootPath,
+				VirtualDirectories: []*HwcVirtualDirectory{
+					{Path: "/static", PhysicalPath: filepath.Join(rootPath, "app", "static")},
+				},
+			}))
+		})
+
+		It("does not treat a path sharing a prefix as nested", func() {
+			add("/application=./api")
+			Expect(apps).To(ContainElement(&HwcApplication{
+				Path:         "/",
+				PhysicalPath: defaultRootPath,
+				VirtualDirectories: []*HwcVirtualDirectory{
+					{Path: "/application", PhysicalPath: filepath.Join(rootPath, "api")},
+				},
+			}))
+		})
+
+		It("creates an application for a path prefixed with app:", func() {
+			apps = NewHwcApplications(defaultRootPath, rootPath, "/")
+			add("/=./public, /app/static=./app/static, app:/app=./")
+			Expect(apps).To(ConsistOf(
+				&HwcApplication{
+					Path:         "/",
+					PhysicalPath: filepath.Join(rootPath, "public"),
+				},
+				&HwcApplication{
+					Path:         "/app",
+					PhysicalPath: rootPath,
+					VirtualDirectories: []*HwcVirtualDirectory{
+						{Path: "/static", PhysicalPath: filepath.Join(rootPath, "app", "static")},
+					},
+				},
+			))
+		})
+
+		It("replaces the directory of an existing application prefixed with app:", func() {
+			add("app:/app=./api")
+			Expect(apps).To(HaveLen(2))
+			Expect(apps).To(ContainElement(&HwcApplication{
+				Path:         "/app",
+				PhysicalPath: filepath.Join(rootPath, "api"),
+			}))
+		})
+
+		DescribeTable("rejects invalid mappings",
+			func(mappings, message string) {
+				_, err := AddVirtualDirectories(apps, rootPath, mappings)
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("missing directory", "/api", `"/api" must be a virtual path and a directory`),
+			Entry("relative virtual path", "api=./api", `virtual path "api" must start with /`),
+			Entry("relative application path", "app:api=./api", `virtual path "api" must start with /`),
+			Entry("duplicate application path", "/api=./api,app:/api=./public", "/api is mapped more than once"),
+			Entry("parent segment", "/a/../b=./api", `virtual path "/a/../b" is not valid`),
+			Entry("duplicate path", "/api=./api,/API=./public", "/API is mapped more than once"),
+			Entry("nonexistent directory", "/api=./missing", "does not exist"),
+			Entry("directory outside the app root", "/api=..", "is outside the app root"),
+			Entry("file", "/readme=./README", "is not a directory"),
+		)
+
+		It("rejects a symlink leaving the app root", func() {
+			outside, err := os.MkdirTemp("", "outside")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(outside)
+			if err := os.Symlink(outside, filepath.Join(rootPath, "link")); err != nil {
+				Skip("symlinks are not available: " + err.Error())
+			}
+
+			_, err = AddVirtualDirectories(apps, rootPath, "/link=./link")
+			Expect(err).To(MatchError(ContainSubstring("is outside the app root")))
+		})
+	})
 })
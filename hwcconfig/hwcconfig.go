@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"code.cloudfoundry.org/hwc/binding"
+	"code.cloudfoundry.org/hwc/logger"
+	"code.cloudfoundry.org/hwc/overlay"
 )
 
 type HwcConfig struct {
@@ -12,7 +16,29 @@ type HwcConfig struct {
 	TempDirectory                 string
 	IISCompressedFilesDirectory   string
 	ASPCompiledTemplatesDirectory string
-	BindAddress                   string
+	WebSocket                     WebSocketConfig
+	Authentication                AuthenticationConfig
+	IPSecurity                    IPSecurityConfig
+	ForwardedFor                  ForwardedForConfig
+	Redirect                      RedirectConfig
+	MachineKey                    MachineKeyConfig
+	Overlay                       overlay.Overlay
+
+	// BindAddresses are the addresses the site is bound to, as they appear
+	// in bindingInformation. BindAddress is the first, used to reach the site.
+	BindAddress   string
+	BindAddresses []string
+
+	// OmittedModules lists the optional baseline modules that were left out
+	// of the generated config because their image is not installed
+	OmittedModules []string
+	// OptionalModules lists the optional IIS modules, such as RewriteModule,
+	// that were detected and enabled
+	OptionalModules []string
+
+	// HiddenSegments are the names of the hwc settings files in the app
+	// root, which requestFiltering keeps the site from serving
+	HiddenSegments []string
 
 	Applications              []*HwcApplication
 	AspnetConfigPath          string
@@ -60,16 +86,65 @@ func New(port int, rootPath, tmpPath, contextPath, uuid string) (error, *HwcConf
 	}
 
 	config.Applications = NewHwcApplications(defaultRootPath, rootPath, contextPath)
+	if mappings := os.Getenv("HWC_VIRTUAL_DIRECTORIES"); mappings != "" {
+		config.Applications, err = AddVirtualDirectories(config.Applications, rootPath, mappings)
+		if err != nil {
+			return fmt.Errorf("HWC_VIRTUAL_DIRECTORIES: %v", err), nil
+		}
+	}
+	config.HiddenSegments = hiddenSegments(rootPath)
 	config.ApplicationHostConfigPath = filepath.Join(configPath, "ApplicationHost.config")
 	config.AspnetConfigPath = filepath.Join(configPath, "Aspnet.config")
 	config.WebConfigPath = filepath.Join(configPath, "Web.config")
 
-	bindAddress, exists := os.LookupEnv("HWC_BIND_ADDRESS")
+	config.BindAddresses, err = binding.ParseAddresses(os.Getenv("HWC_BIND_ADDRESS"))
+	if err != nil {
+		return fmt.Errorf("HWC_BIND_ADDRESS: %v", err), nil
+	}
+	config.BindAddress = config.BindAddresses[0]
 
-	if exists {
-		config.BindAddress = bindAddress
-	} else {
-		config.BindAddress = "*"
+	config.WebSocket, err = webSocketConfigFromEnv()
+	if err != nil {
+		return err, nil
+	}
+
+	config.Authentication, err = authenticationConfigFromEnv()
+	if err != nil {
+		return err, nil
+	}
+
+	config.IPSecurity, err = ipSecurityConfigFromEnv()
+	if err != nil {
+		return err, nil
+	}
+
+	config.ForwardedFor, err = forwardedForConfigFromEnv()
+	if err != nil {
+		return err, nil
+	}
+
+	config.Redirect, err = redirectConfigFromEnv()
+	if err != nil {
+		return err, nil
+	}
+
+	config.Overlay, err = serviceOverlay(rootPath)
+	if err != nil {
+		return err, nil
+	}
+
+	err = addEnvironmentAppSettings(rootPath, &config.Overlay)
+	if err != nil {
+		return err, nil
+	}
+
+	config.MachineKey, err = machineKeyConfig()
+	if err != nil {
+		return err, nil
+	}
+	if config.MachineKey.Enabled() {
+		logger.Infof("machine_key_configured", logger.Fields{"source": config.MachineKey.Source, "validation": config.MachineKey.Validation, "decryption": config.MachineKey.Decryption},
+			"HWC using machineKey from %s (validation %s, decryption %s)", config.MachineKey.Source, config.MachineKey.Validation, config.MachineKey.Decryption)
 	}
 
 	err = config.generateApplicationHostConfig()
@@ -89,3 +164,25 @@ func New(port int, rootPath, tmpPath, contextPath, uuid string) (error, *HwcConf
 
 	return nil, config
 }
+
+// IsModuleOmitted reports whether the optional baseline module name was left
+// out of the generated config
+func (c *HwcConfig) IsModuleOmitted(name string) bool {
+	for _, n := range c.OmittedModules {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isOptionalModuleEnabled reports whether the optional IIS module name was
+// detected and enabled
+func (c *HwcConfig) isOptionalModuleEnabled(name string) bool {
+	for _, n := range c.OptionalModules {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
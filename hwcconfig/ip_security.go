@@ -0,0 +1,156 @@
+package hwcconfig
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IPSecurityConfig holds the ipSecurity and dynamicIpSecurity settings
+// rendered into the applicationHost.config
+type IPSecurityConfig struct {
+	// AllowUnlisted is false once HWC_IP_ALLOW lists the permitted callers
+	AllowUnlisted bool
+	Rules         []IPRule
+	Dynamic       DynamicIPSecurityConfig
+}
+
+// IPRule is an ipSecurity entry in the address/subnetMask form IIS expects
+type IPRule struct {
+	Address    string
+	SubnetMask string
+	Allowed    bool
+}
+
+type DynamicIPSecurityConfig struct {
+	// MaxConcurrentRequests enables denyByConcurrentRequests when set
+	MaxConcurrentRequests int
+	// MaxRequests enables denyByRequestRate when set
+	MaxRequests       int
+	RequestIntervalMs int
+}
+
+// Enabled reports whether any dynamic IP restriction threshold is set
+func (d DynamicIPSecurityConfig) Enabled() bool {
+	return d.MaxConcurrentRequests > 0 || d.MaxRequests > 0
+}
+
+// Enabled reports whether any ipSecurity rule is set
+func (c IPSecurityConfig) Enabled() bool {
+	return len(c.Rules) > 0
+}
+
+func ipSecurityConfigFromEnv() (IPSecurityConfig, error) {
+	config := IPSecurityConfig{AllowUnlisted: true}
+
+	allow, err := parseIPRules("HWC_IP_ALLOW", true)
+	if err != nil {
+		return config, err
+	}
+	deny, err := parseIPRules("HWC_IP_DENY", false)
+	if err != nil {
+		return config, err
+	}
+
+	seen := map[string]bool{}
+	for _, rule := range deny {
+		seen[rule.Address+"/"+rule.SubnetMask] = true
+	}
+	for _, rule := range allow {
+		if seen[rule.Address+"/"+rule.SubnetMask] {
+			return config, fmt.Errorf("HWC_IP_ALLOW and HWC_IP_DENY both list %s/%s", rule.Address, rule.SubnetMask)
+		}
+	}
+
+	// IIS applies the first matching entry, so the denied ranges go first to
+	// carve them out of broader allowed ranges
+	config.Rules = append(deny, allow...)
+	if len(allow) > 0 {
+		config.AllowUnlisted = false
+	}
+
+	if value := os.Getenv("HWC_IP_MAX_CONCURRENT_REQUESTS"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return config, fmt.Errorf("HWC_IP_MAX_CONCURRENT_REQUESTS must be a positive number, got %q", value)
+		}
+		config.Dynamic.MaxConcurrentRequests = limit
+	}
+
+	if value := os.Getenv("HWC_IP_MAX_REQUESTS"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return config, fmt.Errorf("HWC_IP_MAX_REQUESTS must be a positive number, got %q", value)
+		}
+		config.Dynamic.MaxRequests = limit
+		config.Dynamic.RequestIntervalMs = 200
+	}
+
+	if value := os.Getenv("HWC_IP_REQUEST_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < time.Millisecond {
+			return config, fmt.Errorf("HWC_IP_REQUEST_INTERVAL must be a duration of at least 1ms such as 200ms, got %q", value)
+		}
+		if config.Dynamic.MaxRequests == 0 {
+			return config, fmt.Errorf("HWC_IP_REQUEST_INTERVAL requires HWC_IP_MAX_REQUESTS")
+		}
+		config.Dynamic.RequestIntervalMs = int(interval / time.Millisecond)
+	}
+
+	return config, nil
+}
+
+// parseIPRules reads the CIDR ranges and addresses listed in the environment
+// variable name
+func parseIPRules(name string, allowed bool) ([]IPRule, error) {
+	var rules []IPRule
+	for _, entry := range strings.FieldsFunc(os.Getenv(name), isListSeparator) {
+		rule, err := parseIPRule(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		rule.Allowed = allowed
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseIPRule(entry string) (IPRule, error) {
+	var prefix netip.Prefix
+	if strings.Contains(entry, "/") {
+		var err error
+		prefix, err = netip.ParsePrefix(entry)
+		if err != nil {
+			return IPRule{}, fmt.Errorf("%q is not a CIDR range such as 10.0.0.0/8", entry)
+		}
+	} else {
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return IPRule{}, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	if prefix.Addr().Zone() != "" {
+		return IPRule{}, fmt.Errorf("%q must not have a zone", entry)
+	}
+	if prefix.Addr().Is4In6() {
+		return IPRule{}, fmt.Errorf("%q is an IPv4-mapped address; list it as IPv4", entry)
+	}
+	if masked := prefix.Masked(); masked != prefix {
+		return IPRule{}, fmt.Errorf("%q has host bits set; use %s", entry, masked)
+	}
+
+	rule := IPRule{Address: prefix.Addr().String()}
+	if prefix.Addr().Is4() {
+		rule.SubnetMask = net.IP(net.CIDRMask(prefix.Bits(), 32)).String()
+	} else {
+		// IIS takes the prefix length as the subnet mask of IPv6 entries
+		rule.SubnetMask = strconv.Itoa(prefix.Bits())
+	}
+	return rule, nil
+}
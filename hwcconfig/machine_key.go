@@ -0,0 +1,201 @@
+package hwcconfig
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry-community/go-cfenv"
+)
+
+// validationKeyLengths are the accepted machineKey validation algorithms
+// and the minimum validationKey length of each, in bytes
+var validationKeyLengths = map[string]int{
+	"HMACSHA256": 32,
+	"HMACSHA384": 48,
+	"HMACSHA512": 64,
+}
+
+// decryptionKeyLengths are the accepted machineKey decryption algorithms
+// and their valid decryptionKey lengths, in bytes
+var decryptionKeyLengths = map[string][]int{
+	"AES": {16, 24, 32},
+}
+
+// machineKeyTags mark a bound service whose credentials hold a machineKey
+var machineKeyTags = []string{"machinekey", "machine-key"}
+
+// MachineKeyConfig holds the machineKey rendered into the root Web.config so
+// that every instance of an app signs and encrypts with the same keys
+type MachineKeyConfig struct {
+	Validation    string
+	ValidationKey string
+	Decryption    string
+	DecryptionKey string
+	// Source describes where the keys came from, for logging
+	Source string
+}
+
+// Enabled reports whether a machineKey is configured
+func (m MachineKeyConfig) Enabled() bool {
+	return m.ValidationKey != ""
+}
+
+// machineKeyConfig reads the machineKey from HWC_MACHINE_KEY_* or, when those
+// are not set, from a bound service named by HWC_MACHINE_KEY_SERVICE or
+// tagged machinekey
+func machineKeyConfig() (MachineKeyConfig, error) {
+	config := MachineKeyConfig{
+		Validation:    os.Getenv("HWC_MACHINE_KEY_VALIDATION"),
+		ValidationKey: os.Getenv("HWC_MACHINE_KEY_VALIDATION_KEY"),
+		Decryption:    os.Getenv("HWC_MACHINE_KEY_DECRYPTION"),
+		DecryptionKey: os.Getenv("HWC_MACHINE_KEY_DECRYPTION_KEY"),
+		Source:        "environment",
+	}
+
+	if config.ValidationKey == "" && config.DecryptionKey == "" {
+		service, ok, err := machineKeyService()
+		if err != nil {
+			return MachineKeyConfig{}, err
+		}
+		if !ok {
+			if config.Validation != "" || config.Decryption != "" {
+				return MachineKeyConfig{}, fmt.Errorf("HWC_MACHINE_KEY_VALIDATION and HWC_MACHINE_KEY_DECRYPTION require HWC_MACHINE_KEY_VALIDATION_KEY and HWC_MACHINE_KEY_DECRYPTION_KEY")
+			}
+			return MachineKeyConfig{}, nil
+		}
+		config = service
+	}
+
+	if err := config.validate(); err != nil {
+		return MachineKeyConfig{}, fmt.Errorf("machineKey from %s: %v", config.Source, err)
+	}
+	return config, nil
+}
+
+func machineKeyService() (MachineKeyConfig, bool, error) {
+	name := os.Getenv("HWC_MACHINE_KEY_SERVICE")
+	if !cfenv.IsRunningOnCF() {
+		if name != "" {
+			return MachineKeyConfig{}, false, fmt.Errorf("HWC_MACHINE_KEY_SERVICE: service %s is not bound", name)
+		}
+		return MachineKeyConfig{}, false, nil
+	}
+
+	appEnv, err := cfenv.Current()
+	if err != nil {
+		return MachineKeyConfig{}, false, fmt.Errorf("Getting current CF environment: %v", err)
+	}
+
+	var found []cfenv.Service
+	for _, services := range appEnv.Services {
+		for _, service := range services {
+			if name != "" {
+				if service.Name == name {
+					found = append(found, service)
+				}
+				continue
+			}
+			if serviceHasTag(service, machineKeyTags...) {
+				found = append(found, service)
+			}
+		}
+	}
+
+	switch {
+	case len(found) == 0 && name != "":
+		return MachineKeyConfig{}, false, fmt.Errorf("HWC_MACHINE_KEY_SERVICE: service %s is not bound", name)
+	case len(found) == 0:
+		return MachineKeyConfig{}, false, nil
+	case len(found) > 1:
+		return MachineKeyConfig{}, false, fmt.Errorf("more than one bound service is tagged machinekey; set HWC_MACHINE_KEY_SERVICE to choose one")
+	}
+
+	service := found[0]
+	credential := func(key string) string {
+		value, _ := service.Credentials[key].(string)
+		return value
+	}
+	return MachineKeyConfig{
+		Validation:    credential("validation"),
+		ValidationKey: credential("validationKey"),
+		Decryption:    credential("decryption"),
+		DecryptionKey: credential("decryptionKey"),
+		Source:        "service " + service.Name,
+	}, true, nil
+}
+
+// validate checks the algorithms and key lengths, defaulting the algorithms
+// to HMACSHA256 and AES. Errors never include the keys.
+func (m *MachineKeyConfig) validate() error {
+	if m.Validation == "" {
+		m.Validation = "HMACSHA256"
+	}
+	if m.Decryption == "" {
+		m.Decryption = "AES"
+	}
+	m.Validation = strings.ToUpper(m.Validation)
+	m.Decryption = strings.ToUpper(m.Decryption)
+
+	minLength, ok := validationKeyLengths[m.Validation]
+	if !ok {
+		return fmt.Errorf("validation must be HMACSHA256, HMACSHA384 or HMACSHA512, got %q", m.Validation)
+	}
+	lengths, ok := decryptionKeyLengths[m.Decryption]
+	if !ok {
+		return fmt.Errorf("decryption must be AES, got %q", m.Decryption)
+	}
+
+	validationKey, err := decodeKey("validationKey", m.ValidationKey)
+	if err != nil {
+		return err
+	}
+	if len(validationKey) < minLength {
+		return fmt.Errorf("validationKey must be at least %d hex characters for %s, got %d", 2*minLength, m.Validation, len(m.ValidationKey))
+	}
+
+	decryptionKey, err := decodeKey("decryptionKey", m.DecryptionKey)
+	if err != nil {
+		return err
+	}
+	valid := false
+	for _, length := range lengths {
+		valid = valid || len(decryptionKey) == length
+	}
+	if !valid {
+		return fmt.Errorf("decryptionKey must be 32, 48 or 64 hex characters for %s, got %d", m.Decryption, len(m.DecryptionKey))
+	}
+
+	m.ValidationKey = strings.ToUpper(m.ValidationKey)
+	m.DecryptionKey = strings.ToUpper(m.DecryptionKey)
+	return nil
+}
+
+func decodeKey(name, key string) ([]byte, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%s is missing", name)
+	}
+	if strings.Contains(strings.ToLower(key), "autogenerate") {
+		return nil, fmt.Errorf("%s must be a fixed key, not AutoGenerate", name)
+	}
+	decoded, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be hexadecimal", name)
+	}
+	return decoded, nil
+}
+
+func serviceHasTag(service cfenv.Service, tags ...string) bool {
+	for _, tag := range tags {
+		if strings.EqualFold(service.Label, tag) {
+			return true
+		}
+		for _, t := range service.Tags {
+			if strings.EqualFold(t, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
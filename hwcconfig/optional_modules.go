@@ -0,0 +1,137 @@
+package hwcconfig
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/hwc/logger"
+)
+
+// optionalModule describes an IIS module that is enabled when its image is
+// installed on the machine
+type optionalModule struct {
+	Name  string
+	Image string
+	// RootSectionSchema is declared directly under configSections
+	RootSectionSchema string
+	// SectionSchema is declared under the system.webServer sectionGroup
+	SectionSchema string
+	// Modules are added to the site's modules element
+	Modules []string
+	// Requires names other optional modules this module depends on
+	Requires []string
+}
+
+var optionalModules = [...]optionalModule{
+	{
+		Name:  "RewriteModule",
+		Image: `%windir%\system32\inetsrv\rewrite.dll`,
+		SectionSchema: `
+      <sectionGroup name="rewrite">
+        <section name="rules" overrideModeDefault="Allow" />
+        <section name="globalRules" overrideModeDefault="Deny" allowDefinition="AppHostOnly" />
+        <section name="outboundRules" overrideModeDefault="Allow" />
+        <section name="providers" overrideModeDefault="Allow" />
+        <section name="rewriteMaps" overrideModeDefault="Allow" />
+        <section name="allowedServerVariables" overrideModeDefault="Allow" />
+      </sectionGroup>`,
+		Modules: []string{"RewriteModule"},
+	},
+	{
+		Name:  "ApplicationRequestRouting",
+		Image: `%ProgramFiles%\IIS\Application Request Routing\requestRouter.dll`,
+		RootSectionSchema: `
+    <section name="webFarms" allowDefinition="AppHostOnly" overrideModeDefault="Deny" />`,
+		SectionSchema: `
+      <section name="proxy" allowDefinition="AppHostOnly" overrideModeDefault="Deny" />`,
+		Modules:  []string{"ApplicationRequestRouting"},
+		Requires: []string{"RewriteModule"},
+	},
+	{
+		Name:  "CorsModule",
+		Image: `%windir%\system32\inetsrv\iiscors.dll`,
+		SectionSchema: `
+      <section name="cors" overrideModeDefault="Allow" allowDefinition="Everywhere" />`,
+		Modules: []string{"CorsModule"},
+	},
+	{
+		Name:  "ApplicationInitializationModule",
+		Image: `%windir%\system32\inetsrv\warmup.dll`,
+		SectionSchema: `
+      <section name="applicationInitialization" allowDefinition="MachineToApplication" overrideModeDefault="Allow" />`,
+		Modules: []string{"ApplicationInitializationModule"},
+	},
+}
+
+var windowsEnvVar = regexp.MustCompile(`%([^%]+)%`)
+
+// expandWindowsEnv expands %VAR% references the way IIS does
+func expandWindowsEnv(path string) string {
+	return os.ExpandEnv(windowsEnvVar.ReplaceAllString(path, `${$1}`))
+}
+
+// detectOptionalModules returns the optional modules that are installed and
+// not disabled through HWC_DISABLE_OPTIONAL_MODULES
+func detectOptionalModules() ([]optionalModule, error) {
+	disabled := map[string]bool{}
+	for _, name := range strings.FieldsFunc(os.Getenv("HWC_DISABLE_OPTIONAL_MODULES"), isListSeparator) {
+		if !isOptionalModule(name) {
+			return nil, fmt.Errorf("HWC_DISABLE_OPTIONAL_MODULES: unknown optional module %q", name)
+		}
+		disabled[name] = true
+	}
+
+	var detected []optionalModule
+	enabled := map[string]bool{}
+
+	for _, m := range optionalModules {
+		if disabled[m.Name] {
+			logger.Infof("optional_module_disabled", logger.Fields{"module": m.Name}, "HWC optional module %s disabled by HWC_DISABLE_OPTIONAL_MODULES", m.Name)
+			continue
+		}
+
+		imagePath := expandWindowsEnv(m.Image)
+		_, err := os.Stat(imagePath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if missing := missingRequirements(m, enabled); len(missing) > 0 {
+			logger.Infof("optional_module_skipped", logger.Fields{"module": m.Name, "requires": missing}, "HWC skipping optional module %s: requires %s", m.Name, strings.Join(missing, ", "))
+			continue
+		}
+
+		logger.Infof("optional_module_enabled", logger.Fields{"module": m.Name, "image": imagePath}, "HWC enabling optional module %s: %s", m.Name, imagePath)
+		detected = append(detected, m)
+		enabled[m.Name] = true
+	}
+
+	return detected, nil
+}
+
+func missingRequirements(m optionalModule, enabled map[string]bool) []string {
+	var missing []string
+	for _, name := range m.Requires {
+		if !enabled[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+func isOptionalModule(name string) bool {
+	for _, m := range optionalModules {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isListSeparator(r rune) bool {
+	return r == ',' || r == ';' || r == ' '
+}
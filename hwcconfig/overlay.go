@@ -0,0 +1,120 @@
+package hwcconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-community/go-cfenv"
+
+	"code.cloudfoundry.org/hwc/logger"
+	"code.cloudfoundry.org/hwc/overlay"
+)
+
+// serviceOverlay maps the services bound to the app to connection strings
+// and app settings. HWC_SERVICE_MAPPINGS names a mapping file, relative to the
+// app root unless absolute, that overrides the built-in mappings. Connection
+// strings the app's Web.config adds itself are left to the app, since .NET
+// rejects a name added twice.
+func serviceOverlay(rootPath string) (overlay.Overlay, error) {
+	if !cfenv.IsRunningOnCF() {
+		return overlay.Overlay{}, nil
+	}
+
+	appEnv, err := cfenv.Current()
+	if err != nil {
+		return overlay.Overlay{}, fmt.Errorf("Getting current CF environment: %v", err)
+	}
+
+	var mappings []overlay.Mapping
+	if mappingsPath := os.Getenv("HWC_SERVICE_MAPPINGS"); mappingsPath != "" {
+		if !filepath.IsAbs(mappingsPath) {
+			mappingsPath = filepath.Join(rootPath, mappingsPath)
+		}
+		mappings, err = overlay.LoadMappings(mappingsPath)
+		if err != nil {
+			return overlay.Overlay{}, fmt.Errorf("HWC_SERVICE_MAPPINGS: %v", err)
+		}
+	}
+
+	result, err := overlay.FromServices(appEnv.Services, mappings)
+	if err != nil {
+		return overlay.Overlay{}, err
+	}
+
+	webConfigPath := filepath.Join(rootPath, "Web.config")
+	appConnectionStrings, err := overlay.ReadConnectionStrings(webConfigPath)
+	if err != nil {
+		return overlay.Overlay{}, fmt.Errorf("Reading connectionStrings from %s: %v", webConfigPath, err)
+	}
+
+	var connectionStrings []overlay.ConnectionString
+	for _, cs := range result.ConnectionStrings {
+		if appConnectionStrings.Conflicts(cs.Name) {
+			logger.Infof("connection_string_ignored", logger.Fields{"name": cs.Name}, "HWC connection string %s is defined by the app's Web.config, not injecting it", cs.Name)
+			continue
+		}
+		connectionStrings = append(connectionStrings, cs)
+	}
+	result.ConnectionStrings = connectionStrings
+
+	for _, cs := range result.ConnectionStrings {
+		logger.Infof("connection_string_injected", logger.Fields{"name": cs.Name}, "HWC injecting connection string %s", cs.Name)
+	}
+	for _, setting := range result.AppSettings {
+		logger.Infof("app_setting_injected", logger.Fields{"key": setting.Key, "source": "services"}, "HWC injecting app setting %s", setting.Key)
+	}
+	return result, nil
+}
+
+// addEnvironmentAppSettings adds the environment variables whose names start
+// with HWC_APPSETTINGS_PREFIX to the overlay's app settings. The app's own
+// Web.config wins for keys it defines, since a child config overrides the
+// root one; HWC_APPSETTINGS_CONFLICTS=error refuses to start instead.
+func addEnvironmentAppSettings(rootPath string, o *overlay.Overlay) error {
+	prefix := os.Getenv("HWC_APPSETTINGS_PREFIX")
+	if prefix == "" {
+		return nil
+	}
+
+	failOnConflict := false
+	switch conflicts := os.Getenv("HWC_APPSETTINGS_CONFLICTS"); conflicts {
+	case "", "app":
+	case "error":
+		failOnConflict = true
+	default:
+		return fmt.Errorf("HWC_APPSETTINGS_CONFLICTS must be app or error, got %q", conflicts)
+	}
+
+	webConfigPath := filepath.Join(rootPath, "Web.config")
+	appSettings, err := overlay.ReadAppSettings(webConfigPath)
+	if err != nil {
+		return fmt.Errorf("Reading appSettings from %s: %v", webConfigPath, err)
+	}
+
+	var settings []overlay.AppSetting
+	var conflicting []string
+	for _, setting := range overlay.FromEnvironment(prefix, os.Environ()) {
+		if appSettings.Defines(setting.Key) {
+			conflicting = append(conflicting, setting.Key)
+			continue
+		}
+		settings = append(settings, setting)
+	}
+
+	if len(conflicting) > 0 {
+		if failOnConflict {
+			return fmt.Errorf("HWC_APPSETTINGS_CONFLICTS=error: app settings %s are also defined by %s", strings.Join(conflicting, ", "), webConfigPath)
+		}
+		for _, key := range conflicting {
+			logger.Infof("app_setting_ignored", logger.Fields{"key": key, "variable": prefix + key}, "HWC app setting %s is defined by the app's Web.config, ignoring %s%s", key, prefix, key)
+		}
+	}
+
+	for _, setting := range settings {
+		logger.Infof("app_setting_injected", logger.Fields{"key": setting.Key, "source": "environment"}, "HWC injecting app setting %s", setting.Key)
+	}
+	o.SetAppSettings(settings)
+	return nil
+}
@@ -0,0 +1,64 @@
+package hwcconfig
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var hostnamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+
+// RedirectConfig holds the redirects rendered as URL Rewrite global rules.
+// Both only apply to requests that came through a proxy setting
+// X-Forwarded-Proto, so health checks against the instance are not redirected.
+type RedirectConfig struct {
+	ForceHTTPS    bool
+	CanonicalHost string
+}
+
+// Enabled reports whether any redirect is configured
+func (r RedirectConfig) Enabled() bool {
+	return r.ForceHTTPS || r.CanonicalHost != ""
+}
+
+// CanonicalHostPattern matches the canonical host, with or without a port,
+// in {HTTP_HOST}
+func (r RedirectConfig) CanonicalHostPattern() string {
+	return "^" + regexp.QuoteMeta(r.CanonicalHost) + `(:\d+)?$`
+}
+
+func redirectConfigFromEnv() (RedirectConfig, error) {
+	var config RedirectConfig
+
+	if value := os.Getenv("HWC_FORCE_HTTPS"); value != "" {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("HWC_FORCE_HTTPS must be true or false, got %q", value)
+		}
+		config.ForceHTTPS = force
+	}
+
+	if value := strings.TrimSpace(os.Getenv("HWC_CANONICAL_HOST")); value != "" {
+		host := strings.ToLower(strings.TrimSuffix(value, "."))
+		if len(host) > 253 || !hostnamePattern.MatchString(host) {
+			return config, fmt.Errorf("HWC_CANONICAL_HOST must be a host name such as www.example.com, got %q", value)
+		}
+		config.CanonicalHost = host
+	}
+
+	return config, nil
+}
+
+// requirementError reports that the configured redirects need module
+func (r RedirectConfig) requirementError(module, image string) error {
+	switch {
+	case r.ForceHTTPS && r.CanonicalHost != "":
+		return fmt.Errorf("HWC_FORCE_HTTPS and HWC_CANONICAL_HOST require %s, but %s is not installed or is disabled", module, image)
+	case r.ForceHTTPS:
+		return fmt.Errorf("HWC_FORCE_HTTPS requires %s, but %s is not installed or is disabled", module, image)
+	default:
+		return fmt.Errorf("HWC_CANONICAL_HOST requires %s, but %s is not installed or is disabled", module, image)
+	}
+}
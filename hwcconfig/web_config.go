@@ -1,7 +1,9 @@
 package hwcconfig
 
 import (
+	"encoding/xml"
 	"os"
+	"strings"
 	"text/template"
 )
 
@@ -12,13 +14,19 @@ func (c *HwcConfig) generateWebConfig() error {
 	}
 	defer file.Close()
 
-	var tmpl = template.Must(template.New("webconfig").Parse(webConfigTemplate))
+	var tmpl = template.Must(template.New("webconfig").Funcs(template.FuncMap{"xml": escapeXML}).Parse(webConfigTemplate))
 	if err := tmpl.Execute(file, c); err != nil {
 		return err
 	}
 	return nil
 }
 
+func escapeXML(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
 const webConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
 <!-- the root web configuration file -->
 <configuration>
@@ -32,6 +40,20 @@ const webConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
         web applications should change the default Trust level and ensure
         that overrides are not allowed
     -->
+    {{- with .Overlay.ConnectionStrings}}
+    <connectionStrings>
+        {{- range .}}
+        <add name="{{xml .Name}}" connectionString="{{xml .ConnectionString}}"{{if .ProviderName}} providerName="{{xml .ProviderName}}"{{end}} />
+        {{- end}}
+    </connectionStrings>
+    {{- end}}
+    {{- with .Overlay.AppSettings}}
+    <appSettings>
+        {{- range .}}
+        <add key="{{xml .Key}}" value="{{xml .Value}}" />
+        {{- end}}
+    </appSettings>
+    {{- end}}
     <location allowOverride="true">
         <system.web>
 				    <hostingEnvironment shadowCopyBinAssemblies="false" />
@@ -92,6 +114,10 @@ const webConfigTemplate = `<?xml version="1.0" encoding="UTF-8"?>
         <authorization>
             <allow users="*" />
         </authorization>
+        {{- with .MachineKey}}{{if .Enabled}}
+
+        <machineKey validation="{{.Validation}}" validationKey="{{xml .ValidationKey}}" decryption="{{.Decryption}}" decryptionKey="{{xml .DecryptionKey}}" />
+        {{- end}}{{end}}
 
         <browserCaps userAgentCacheKeyLength="64">
             <result type="System.Web.Mobile.MobileCapabilities, System.Web.Mobile, Version=4.0.0.0, Culture=neutral, PublicKeyToken=b03f5f7f11d50a3a" />
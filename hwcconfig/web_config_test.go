@@ -0,0 +1,267 @@
+//go:build windows
+// +build windows
+
+package hwcconfig_test
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/hwcconfig"
+)
+
+type RootWebConfig struct {
+	XMLName           xml.Name `xml:"configuration"`
+	ConnectionStrings struct {
+		Add []struct {
+			Name             string `xml:"name,attr"`
+			ConnectionString string `xml:"connectionString,attr"`
+			ProviderName     string `xml:"providerName,attr"`
+		} `xml:"add"`
+	} `xml:"connectionStrings"`
+	AppSettings struct {
+		Add []struct {
+			Key   string `xml:"key,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"add"`
+	} `xml:"appSettings"`
+	SystemWeb struct {
+		MachineKey *struct {
+			Validation    string `xml:"validation,attr"`
+			ValidationKey string `xml:"validationKey,attr"`
+			Decryption    string `xml:"decryption,attr"`
+			DecryptionKey string `xml:"decryptionKey,attr"`
+		} `xml:"machineKey"`
+	} `xml:"system.web"`
+}
+
+var _ = Describe("WebConfig", func() {
+	var (
+		workingDirectoryPath string
+		rootPath             string
+		tmpPath              string
+	)
+
+	var generate = func() (error, RootWebConfig) {
+		err, hwcConfig := hwcconfig.New(8080, rootPath, tmpPath, "/", "someuid12345")
+		if err != nil {
+			return err, RootWebConfig{}
+		}
+
+		contents, err := os.ReadFile(hwcConfig.WebConfigPath)
+		Expect(err).ToNot(HaveOccurred())
+
+		var config RootWebConfig
+		Expect(xml.Unmarshal(contents, &config)).To(Succeed())
+		return nil, config
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		workingDirectoryPath, err = os.MkdirTemp("", "hwcconfig_test")
+		Expect(err).ToNot(HaveOccurred())
+		rootPath = filepath.Join(workingDirectoryPath, "rootPath")
+		tmpPath = filepath.Join(workingDirectoryPath, "tmpPath")
+		Expect(os.MkdirAll(rootPath, 0777)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv("VCAP_APPLICATION")).To(Succeed())
+		Expect(os.Unsetenv("VCAP_SERVICES")).To(Succeed())
+		Expect(os.Unsetenv("HWC_SERVICE_MAPPINGS")).To(Succeed())
+		Expect(os.Unsetenv("HWC_APPSETTINGS_PREFIX")).To(Succeed())
+		Expect(os.Unsetenv("HWC_APPSETTINGS_CONFLICTS")).To(Succeed())
+		Expect(os.Unsetenv("APPSETTING_Mode")).To(Succeed())
+		Expect(os.Unsetenv("APPSETTING_Region")).To(Succeed())
+		for _, name := range []string{"HWC_MACHINE_KEY_VALIDATION", "HWC_MACHINE_KEY_VALIDATION_KEY", "HWC_MACHINE_KEY_DECRYPTION", "HWC_MACHINE_KEY_DECRYPTION_KEY", "HWC_MACHINE_KEY_SERVICE"} {
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+		_ = os.RemoveAll(workingDirectoryPath)
+	})
+
+	Context("When not running on CF", func() {
+		It("does not add connection strings or app settings", func() {
+			err, config := generate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.ConnectionStrings.Add).To(BeEmpty())
+			Expect(config.AppSettings.Add).To(BeEmpty())
+		})
+	})
+
+	Context("When services are bound", func() {
+		BeforeEach(func() {
+			Expect(os.Setenv("VCAP_APPLICATION", "{}")).To(Succeed())
+			Expect(os.Setenv("VCAP_SERVICES", `{
+				"mssql": [{"name": "orders-db", "label": "mssql", "tags": ["sqlserver"],
+					"credentials": {"hostname": "db", "port": 1433, "name": "orders", "username": "sa", "password": "<&>"}}],
+				"user-provided": [{"name": "payments", "label": "user-provided", "tags": [],
+					"credentials": {"url": "https://payments.example.com"}}]
+			}`)).To(Succeed())
+		})
+
+		It("injects connection strings into the root Web.config", func() {
+			err, config := generate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.ConnectionStrings.Add).To(HaveLen(1))
+			Expect(config.ConnectionStrings.Add[0].Name).To(Equal("orders-db"))
+			Expect(config.ConnectionStrings.Add[0].ConnectionString).To(Equal("Server=db,1433;Database=orders;User Id=sa;Password=<&>;"))
+			Expect(config.ConnectionStrings.Add[0].ProviderName).To(Equal("System.Data.SqlClient"))
+		})
+
+		It("injects app settings from the mapping file", func() {
+			mappings := `[{"service": "payments", "appSettings": {"PaymentsUrl": "{{.url}}"}}]`
+			Expect(os.WriteFile(filepath.Join(rootPath, "hwc-services.json"), []byte(mappings), 0666)).To(Succeed())
+			Expect(os.Setenv("HWC_SERVICE_MAPPINGS", "hwc-services.json")).To(Succeed())
+
+			err, config := generate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.AppSettings.Add).To(HaveLen(1))
+			Expect(config.AppSettings.Add[0].Key).To(Equal("PaymentsUrl"))
+			Expect(config.AppSettings.Add[0].Value).To(Equal("https://payments.example.com"))
+		})
+
+		It("leaves connection strings the app's Web.config adds to the app", func() {
+			Expect(os.WriteFile(filepath.Join(rootPath, "Web.config"), []byte(`<configuration>
+  <connectionStrings>
+    <add name="orders-db" connectionString="Server=local" />
+  </connectionStrings>
+</configuration>`), 0666)).To(Succeed())
+
+			err, config := generate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.ConnectionStrings.Add).To(BeEmpty())
+		})
+
+		It("fails when two services produce the same connection string name", func() {
+			Expect(os.Setenv("VCAP_SERVICES", `{
+				"mssql": [
+					{"name": "orders-db", "label": "mssql", "tags": ["sqlserver"], "credentials": {"connectionString": "Server=a"}},
+					{"name": "ORDERS-DB", "label": "mssql", "tags": ["sqlserver"], "credentials": {"connectionString": "Server=b"}}
+				]
+			}`)).To(Succeed())
+
+			err, _ := generate()
+			Expect(err).To(MatchError(ContainSubstring("more than one bound service produces connection string")))
+		})
+
+		It("fails when the mapping file cannot be read", func() {
+			Expect(os.Setenv("HWC_SERVICE_MAPPINGS", "missing.json")).To(Succeed())
+
+			err, _ := generate()
+			Expect(err).To(MatchError(ContainSubstring("HWC_SERVICE_MAPPINGS")))
+		})
+	})
+
+	Context("When HWC_APPSETTINGS_PREFIX is set", func() {
+		BeforeEach(func() {
+			Expect(os.Setenv("HWC_APPSETTINGS_PREFIX", "APPSETTING_")).To(Succeed())
+			Expect(os.Setenv("APPSETTING_Mode", "fast")).To(Succeed())
+			Expect(os.Setenv("APPSETTING_Region", "eu")).To(Succeed())
+		})
+
+		It("injects the prefixed environment variables as app settings", func() {
+			err, config := generate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.AppSettings.Add).To(HaveLen(2))
+			Expect(config.AppSettings.Add[0].Key).To(Equal("Mode"))
+			Expect(config.AppSettings.Add[0].Value).To(Equal("fast"))
+			Expect(config.AppSettings.Add[1].Key).To(Equal("Region"))
+			Expect(config.AppSettings.Add[1].Value).To(Equal("eu"))
+		})
+
+		Context("and the app's Web.config defines one of the keys", func() {
+			BeforeEach(func() {
+				webConfig := `<configuration><appSettings><add key="Mode" value="slow" /></appSettings></configuration>`
+				Expect(os.WriteFile(filepath.Join(rootPath, "Web.config"), []byte(webConfig), 0666)).To(Succeed())
+			})
+
+			It("leaves that key to the app", func() {
+				err, config := generate()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(config.AppSettings.Add).To(HaveLen(1))
+				Expect(config.AppSettings.Add[0].Key).To(Equal("Region"))
+			})
+
+			It("fails when HWC_APPSETTINGS_CONFLICTS is error", func() {
+				Expect(os.Setenv("HWC_APPSETTINGS_CONFLICTS", "error")).To(Succeed())
+
+				err, _ := generate()
+				Expect(err).To(MatchError(ContainSubstring("app settings Mode are also defined by")))
+			})
+		})
+	})
+
+	Context("When a machineKey is configured", func() {
+		const (
+			validationKey = "0e1a7c5b9d2f4836a1c3e5b7d9f0a2c4e6b8d0f1a3c5e7b9d1f3a5c7e9b1d3f5"
+			decryptionKey = "4A6C8E0B2D4F6A8C0E2B4D6F8A0C2E4B"
+		)
+
+		It("does not render a machineKey by default", func() {
+			err, config := generate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.SystemWeb.MachineKey).To(BeNil())
+		})
+
+		It("renders the keys from the environment", func() {
+			Expect(os.Setenv("HWC_MACHINE_KEY_VALIDATION_KEY", validationKey)).To(Succeed())
+			Expect(os.Setenv("HWC_MACHINE_KEY_DECRYPTION_KEY", decryptionKey)).To(Succeed())
+			Expect(os.Setenv("HWC_MACHINE_KEY_VALIDATION", "hmacsha256")).To(Succeed())
+
+			err, config := generate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.SystemWeb.MachineKey).NotTo(BeNil())
+			Expect(config.SystemWeb.MachineKey.Validation).To(Equal("HMACSHA256"))
+			Expect(config.SystemWeb.MachineKey.ValidationKey).To(Equal(strings.ToUpper(validationKey)))
+			Expect(config.SystemWeb.MachineKey.Decryption).To(Equal("AES"))
+			Expect(config.SystemWeb.MachineKey.DecryptionKey).To(Equal(decryptionKey))
+		})
+
+		It("renders the keys from a bound machinekey service", func() {
+			Expect(os.Setenv("VCAP_APPLICATION", "{}")).To(Succeed())
+			Expect(os.Setenv("VCAP_SERVICES", `{
+				"user-provided": [{"name": "keys", "label": "user-provided", "tags": ["machinekey"],
+					"credentials": {"validation": "HMACSHA256", "validationKey": "`+validationKey+`", "decryptionKey": "`+decryptionKey+`"}}]
+			}`)).To(Succeed())
+
+			err, config := generate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.SystemWeb.MachineKey).NotTo(BeNil())
+			Expect(config.SystemWeb.MachineKey.DecryptionKey).To(Equal(decryptionKey))
+		})
+
+		It("fails when the named service is not bound", func() {
+			Expect(os.Setenv("HWC_MACHINE_KEY_SERVICE", "keys")).To(Succeed())
+
+			err, _ := generate()
+			Expect(err).To(MatchError("HWC_MACHINE_KEY_SERVICE: service keys is not bound"))
+		})
+
+		DescribeTable("rejects invalid keys without echoing them",
+			func(env map[string]string, message string) {
+				for name, value := range env {
+					Expect(os.Setenv(name, value)).To(Succeed())
+				}
+
+				err, _ := generate()
+				Expect(err).To(MatchError(ContainSubstring(message)))
+				Expect(err.Error()).NotTo(ContainSubstring(validationKey))
+				Expect(err.Error()).NotTo(ContainSubstring(decryptionKey))
+			},
+			Entry("missing decryption key", map[string]string{"HWC_MACHINE_KEY_VALIDATION_KEY": validationKey}, "decryptionKey is missing"),
+			Entry("weak validation algorithm", map[string]string{"HWC_MACHINE_KEY_VALIDATION_KEY": validationKey, "HWC_MACHINE_KEY_DECRYPTION_KEY": decryptionKey, "HWC_MACHINE_KEY_VALIDATION": "MD5"}, "validation must be HMACSHA256, HMACSHA384 or HMACSHA512"),
+			Entry("unsupported decryption algorithm", map[string]string{"HWC_MACHINE_KEY_VALIDATION_KEY": validationKey, "HWC_MACHINE_KEY_DECRYPTION_KEY": decryptionKey, "HWC_MACHINE_KEY_DECRYPTION": "3DES"}, "decryption must be AES"),
+			Entry("short validation key", map[string]string{"HWC_MACHINE_KEY_VALIDATION_KEY": validationKey, "HWC_MACHINE_KEY_DECRYPTION_KEY": decryptionKey, "HWC_MACHINE_KEY_VALIDATION": "HMACSHA512"}, "validationKey must be at least 128 hex characters for HMACSHA512, got 64"),
+			Entry("wrong decryption key length", map[string]string{"HWC_MACHINE_KEY_VALIDATION_KEY": validationKey, "HWC_MACHINE_KEY_DECRYPTION_KEY": decryptionKey[:30]}, "decryptionKey must be 32, 48 or 64 hex characters for AES, got 30"),
+			Entry("not hexadecimal", map[string]string{"HWC_MACHINE_KEY_VALIDATION_KEY": validationKey, "HWC_MACHINE_KEY_DECRYPTION_KEY": "zz" + decryptionKey[2:]}, "decryptionKey must be hexadecimal"),
+			Entry("auto-generated keys", map[string]string{"HWC_MACHINE_KEY_VALIDATION_KEY": "AutoGenerate,IsolateApps", "HWC_MACHINE_KEY_DECRYPTION_KEY": decryptionKey}, "validationKey must be a fixed key, not AutoGenerate"),
+			Entry("algorithm without keys", map[string]string{"HWC_MACHINE_KEY_VALIDATION": "HMACSHA256"}, "require HWC_MACHINE_KEY_VALIDATION_KEY and HWC_MACHINE_KEY_DECRYPTION_KEY"),
+		)
+	})
+})
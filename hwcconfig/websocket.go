@@ -0,0 +1,57 @@
+package hwcconfig
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// WebSocketConfig holds the webSocket settings rendered into the
+// applicationHost.config
+type WebSocketConfig struct {
+	Enabled bool
+	// PingInterval is an IIS timespan, e.g. 00:00:30
+	PingInterval       string
+	ReceiveBufferLimit int
+
+	// explicit is set when HWC_WEBSOCKETS was given
+	explicit bool
+}
+
+func webSocketConfigFromEnv() (WebSocketConfig, error) {
+	config := WebSocketConfig{Enabled: true}
+
+	if value, ok := os.LookupEnv("HWC_WEBSOCKETS"); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("HWC_WEBSOCKETS must be true or false, got %q", value)
+		}
+		config.Enabled = enabled
+		config.explicit = true
+	}
+
+	if value := os.Getenv("HWC_WEBSOCKET_PING_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return config, fmt.Errorf("HWC_WEBSOCKET_PING_INTERVAL must be a positive duration such as 30s, got %q", value)
+		}
+		config.PingInterval = formatTimeSpan(interval)
+	}
+
+	if value := os.Getenv("HWC_WEBSOCKET_RECEIVE_BUFFER_LIMIT"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return config, fmt.Errorf("HWC_WEBSOCKET_RECEIVE_BUFFER_LIMIT must be a positive number of bytes, got %q", value)
+		}
+		config.ReceiveBufferLimit = limit
+	}
+
+	return config, nil
+}
+
+// formatTimeSpan renders d in the hh:mm:ss form IIS expects for timespans
+func formatTimeSpan(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
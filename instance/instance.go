@@ -0,0 +1,126 @@
+// Package instance chooses the name of the Hosted Web Core instance, which
+// also names its temp directory and appears in every log event.
+package instance
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// MaxLength is the longest instance name accepted
+const MaxLength = 64
+
+// Sources of an instance name, in order of precedence
+const (
+	SourceFlag   = "-instance flag"
+	SourceEnv    = "HWC_INSTANCE_NAME"
+	SourceCF     = "CF_INSTANCE_GUID"
+	SourceStable = "app root and port"
+	SourceRandom = "random"
+)
+
+// Name is an instance name and where it came from
+type Name struct {
+	Value  string
+	Source string
+}
+
+// Resolve picks the instance name from the -instance flag, HWC_INSTANCE_NAME
+// or CF_INSTANCE_GUID. Failing those, it derives a stable name from the app
+// root and port when HWC_STABLE_INSTANCE_NAME is true, or generates a random
+// UUID.
+func Resolve(flagValue, rootPath string, port int, lookup func(string) (string, bool)) (Name, error) {
+	candidates := []Name{{flagValue, SourceFlag}}
+	if value, ok := lookup("HWC_INSTANCE_NAME"); ok {
+		candidates = append(candidates, Name{value, SourceEnv})
+	}
+	if value, ok := lookup("CF_INSTANCE_GUID"); ok {
+		candidates = append(candidates, Name{value, SourceCF})
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Value == "" {
+			continue
+		}
+		if err := Validate(candidate.Value); err != nil {
+			return Name{}, fmt.Errorf("%s: %v", candidate.Source, err)
+		}
+		return candidate, nil
+	}
+
+	if value, ok := lookup("HWC_STABLE_INSTANCE_NAME"); ok && value != "" {
+		stable, err := strconv.ParseBool(value)
+		if err != nil {
+			return Name{}, fmt.Errorf("HWC_STABLE_INSTANCE_NAME must be true or false, got %q", value)
+		}
+		if stable {
+			return Name{StableName(rootPath, port), SourceStable}, nil
+		}
+	}
+
+	uuid, err := generateUUID()
+	if err != nil {
+		return Name{}, fmt.Errorf("Generating UUID: %v", err)
+	}
+	return Name{uuid, SourceRandom}, nil
+}
+
+// StableName derives a name from the app root and port, which stays the same
+// across restarts. Paths differing only in case or a trailing separator give
+// the same name, as they do on Windows.
+func StableName(rootPath string, port int) string {
+	clean := strings.ToLower(path.Clean(strings.ReplaceAll(rootPath, `\`, "/")))
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", clean, port)))
+	return fmt.Sprintf("hwc-%d-%s", port, hex.EncodeToString(sum[:8]))
+}
+
+// reservedNames cannot name a directory on Windows
+var reservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// Validate checks that name is usable both by Hosted Web Core and as the name
+// of the instance's temp directory: letters, digits, '-', '_' and '.', not
+// starting or ending with '.', and at most MaxLength characters.
+func Validate(name string) error {
+	if name == "" {
+		return fmt.Errorf("instance name must not be empty")
+	}
+	if len(name) > MaxLength {
+		return fmt.Errorf("instance name %q is longer than %d characters", name, MaxLength)
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return fmt.Errorf("instance name %q contains %q; use letters, digits, '-', '_' and '.'", name, r)
+		}
+	}
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") {
+		return fmt.Errorf("instance name %q must not start or end with '.'", name)
+	}
+	if reservedNames[strings.ToLower(strings.SplitN(name, ".", 2)[0])] {
+		return fmt.Errorf("instance name %q is reserved on Windows", name)
+	}
+	return nil
+}
+
+func generateUUID() (string, error) {
+	const size = 128 / 8
+	const format = "%08x-%04x-%04x-%04x-%012x"
+	var u [size]byte
+	if _, err := io.ReadFull(rand.Reader, u[0:]); err != nil {
+		return "", fmt.Errorf("error reading random number generator: %v", err)
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf(format, u[:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
@@ -0,0 +1,127 @@
+package instance_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/instance"
+)
+
+var _ = Describe("Resolve", func() {
+	var env map[string]string
+
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	BeforeEach(func() {
+		env = map[string]string{}
+	})
+
+	It("prefers the flag", func() {
+		env["HWC_INSTANCE_NAME"] = "from-env"
+		env["CF_INSTANCE_GUID"] = "0b2a4f1e-7c3d-4e5f-8a9b-1c2d3e4f5a6b"
+		Expect(instance.Resolve("from-flag", `C:\app`, 8080, lookup)).To(Equal(instance.Name{Value: "from-flag", Source: instance.SourceFlag}))
+	})
+
+	It("uses HWC_INSTANCE_NAME before CF_INSTANCE_GUID", func() {
+		env["HWC_INSTANCE_NAME"] = "from-env"
+		env["CF_INSTANCE_GUID"] = "0b2a4f1e-7c3d-4e5f-8a9b-1c2d3e4f5a6b"
+		Expect(instance.Resolve("", `C:\app`, 8080, lookup)).To(Equal(instance.Name{Value: "from-env", Source: instance.SourceEnv}))
+	})
+
+	It("uses CF_INSTANCE_GUID", func() {
+		env["CF_INSTANCE_GUID"] = "0b2a4f1e-7c3d-4e5f-8a9b-1c2d3e4f5a6b"
+		env["HWC_STABLE_INSTANCE_NAME"] = "true"
+		Expect(instance.Resolve("", `C:\app`, 8080, lookup)).To(Equal(instance.Name{Value: "0b2a4f1e-7c3d-4e5f-8a9b-1c2d3e4f5a6b", Source: instance.SourceCF}))
+	})
+
+	It("derives a stable name when asked to", func() {
+		env["HWC_STABLE_INSTANCE_NAME"] = "true"
+		name, err := instance.Resolve("", `C:\app`, 8080, lookup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal(instance.Name{Value: instance.StableName(`C:\app`, 8080), Source: instance.SourceStable}))
+	})
+
+	It("falls back to a random UUID", func() {
+		first, err := instance.Resolve("", `C:\app`, 8080, lookup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first.Source).To(Equal(instance.SourceRandom))
+		Expect(first.Value).To(MatchRegexp(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`))
+
+		env["HWC_STABLE_INSTANCE_NAME"] = "false"
+		second, err := instance.Resolve("", `C:\app`, 8080, lookup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second.Source).To(Equal(instance.SourceRandom))
+		Expect(second.Value).NotTo(Equal(first.Value))
+	})
+
+	It("ignores empty values", func() {
+		env["HWC_INSTANCE_NAME"] = ""
+		env["CF_INSTANCE_GUID"] = ""
+		name, err := instance.Resolve("", `C:\app`, 8080, lookup)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name.Source).To(Equal(instance.SourceRandom))
+	})
+
+	It("names the source of an invalid name", func() {
+		env["HWC_INSTANCE_NAME"] = "my app"
+		_, err := instance.Resolve("", `C:\app`, 8080, lookup)
+		Expect(err).To(MatchError(`HWC_INSTANCE_NAME: instance name "my app" contains ' '; use letters, digits, '-', '_' and '.'`))
+
+		_, err = instance.Resolve("a/b", `C:\app`, 8080, lookup)
+		Expect(err).To(MatchError(HavePrefix("-instance flag: ")))
+	})
+
+	It("rejects an invalid HWC_STABLE_INSTANCE_NAME", func() {
+		env["HWC_STABLE_INSTANCE_NAME"] = "yes please"
+		_, err := instance.Resolve("", `C:\app`, 8080, lookup)
+		Expect(err).To(MatchError(`HWC_STABLE_INSTANCE_NAME must be true or false, got "yes please"`))
+	})
+})
+
+var _ = Describe("StableName", func() {
+	It("is the same for the same app root and port", func() {
+		name := instance.StableName(`C:\Users\vcap\app`, 8080)
+		Expect(name).To(MatchRegexp(`^hwc-8080-[0-9a-f]{16}$`))
+		Expect(instance.StableName(`C:\Users\vcap\app`, 8080)).To(Equal(name))
+		Expect(instance.StableName(`c:\users\VCAP\app\`, 8080)).To(Equal(name))
+		Expect(instance.StableName(`C:/Users/vcap/app`, 8080)).To(Equal(name))
+		Expect(instance.Validate(name)).To(Succeed())
+	})
+
+	It("differs by app root and port", func() {
+		name := instance.StableName(`C:\Users\vcap\app`, 8080)
+		Expect(instance.StableName(`C:\Users\vcap\other`, 8080)).NotTo(Equal(name))
+		Expect(instance.StableName(`C:\Users\vcap\app`, 8081)).NotTo(Equal(name))
+	})
+})
+
+var _ = Describe("Validate", func() {
+	DescribeTable("accepts",
+		func(name string) {
+			Expect(instance.Validate(name)).To(Succeed())
+		},
+		Entry("a UUID", "0b2a4f1e-7c3d-4e5f-8a9b-1c2d3e4f5a6b"),
+		Entry("dots and underscores", "orders_api.blue-2"),
+		Entry("the longest name", strings.Repeat("a", instance.MaxLength)),
+	)
+
+	DescribeTable("rejects",
+		func(name, message string) {
+			Expect(instance.Validate(name)).To(MatchError(message))
+		},
+		Entry("an empty name", "", "instance name must not be empty"),
+		Entry("a long name", strings.Repeat("a", instance.MaxLength+1), `instance name "`+strings.Repeat("a", instance.MaxLength+1)+`" is longer than 64 characters`),
+		Entry("a separator", `a\b`, `instance name "a\\b" contains '\\'; use letters, digits, '-', '_' and '.'`),
+		Entry("a colon", "site:1", `instance name "site:1" contains ':'; use letters, digits, '-', '_' and '.'`),
+		Entry("non-ASCII letters", "café", `instance name "café" contains 'é'; use letters, digits, '-', '_' and '.'`),
+		Entry("a leading dot", ".hidden", `instance name ".hidden" must not start or end with '.'`),
+		Entry("a parent directory", "..", `instance name ".." must not start or end with '.'`),
+		Entry("a reserved device name", "NUL", `instance name "NUL" is reserved on Windows`),
+		Entry("a reserved device name with an extension", "com1.log", `instance name "com1.log" is reserved on Windows`),
+	)
+})
@@ -0,0 +1,249 @@
+// Package logger writes hwc's own output as named events. In the default text
+// format each event is printed as its message, exactly as hwc always has; with
+// HWC_LOG_FORMAT=json each event is a timestamped JSON object.
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel parses the name of a level, e.g. from HWC_LOG_LEVEL
+func ParseLevel(name string) (Level, error) {
+	for _, l := range []Level{LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if strings.EqualFold(name, l.String()) {
+			return l, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("HWC_LOG_LEVEL must be debug, info, warn or error, got %q", name)
+}
+
+type Format int
+
+const (
+	Text Format = iota
+	JSON
+)
+
+// ParseFormat parses the name of a format, e.g. from HWC_LOG_FORMAT
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "text":
+		return Text, nil
+	case "json":
+		return JSON, nil
+	default:
+		return Text, fmt.Errorf("HWC_LOG_FORMAT must be text or json, got %q", name)
+	}
+}
+
+// Fields are attached to an event in the JSON format
+type Fields map[string]interface{}
+
+// Logger writes debug and info events to out and warnings and errors to
+// errOut
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	errOut io.Writer
+	format Format
+	level  Level
+	fields Fields
+	now    func() time.Time
+}
+
+func New(out, errOut io.Writer) *Logger {
+	return &Logger{
+		out:    out,
+		errOut: errOut,
+		level:  LevelInfo,
+		fields: Fields{},
+		now:    time.Now,
+	}
+}
+
+// SetFormat selects the output format
+func (l *Logger) SetFormat(format Format) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.format = format
+}
+
+// SetLevel drops events below level
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// SetClock replaces the source of event timestamps
+func (l *Logger) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+}
+
+// SetFields adds fields, such as the instance and port, to every later event
+func (l *Logger) SetFields(fields Fields) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for k, v := range fields {
+		l.fields[k] = v
+	}
+}
+
+func (l *Logger) Debugf(event string, fields Fields, format string, args ...interface{}) {
+	l.log(LevelDebug, event, fields, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Infof(event string, fields Fields, format string, args ...interface{}) {
+	l.log(LevelInfo, event, fields, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Warnf(event string, fields Fields, format string, args ...interface{}) {
+	l.log(LevelWarn, event, fields, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Errorf(event string, fields Fields, format string, args ...interface{}) {
+	l.log(LevelError, event, fields, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) log(level Level, event string, fields Fields, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if level < l.level {
+		return
+	}
+
+	writer := l.out
+	if level >= LevelWarn {
+		writer = l.errOut
+	}
+
+	if l.format == Text {
+		fmt.Fprintln(writer, message)
+		return
+	}
+
+	entry := map[string]interface{}{}
+	for k, v := range l.fields {
+		entry[k] = v
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["timestamp"] = l.now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["event"] = event
+	entry["message"] = strings.TrimSpace(message)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"timestamp": entry["timestamp"],
+			"level":     entry["level"],
+			"event":     event,
+			"message":   entry["message"],
+			"error":     fmt.Sprintf("marshalling fields: %v", err),
+		})
+	}
+	writer.Write(append(data, '\n'))
+}
+
+// Writer returns a writer that logs each line written to it as an event,
+// for code such as the validator that reports through an io.Writer
+func (l *Logger) Writer(level Level, event string) io.Writer {
+	return &lineWriter{logger: l, level: level, event: event}
+}
+
+type lineWriter struct {
+	logger *Logger
+	level  Level
+	event  string
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\r\n"), []byte("\n")) {
+		w.logger.log(w.level, w.event, nil, string(bytes.TrimRight(line, "\r")))
+	}
+	return len(p), nil
+}
+
+var std = New(os.Stdout, os.Stderr)
+
+// Default returns the logger the package level functions write to
+func Default() *Logger {
+	return std
+}
+
+// Configure sets the format and level of the default logger from their names
+func Configure(format, level string) error {
+	f, err := ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	l := LevelInfo
+	if level != "" {
+		l, err = ParseLevel(level)
+		if err != nil {
+			return err
+		}
+	}
+	std.SetFormat(f)
+	std.SetLevel(l)
+	return nil
+}
+
+func SetFields(fields Fields) {
+	std.SetFields(fields)
+}
+
+func Debugf(event string, fields Fields, format string, args ...interface{}) {
+	std.log(LevelDebug, event, fields, fmt.Sprintf(format, args...))
+}
+
+func Infof(event string, fields Fields, format string, args ...interface{}) {
+	std.log(LevelInfo, event, fields, fmt.Sprintf(format, args...))
+}
+
+func Warnf(event string, fields Fields, format string, args ...interface{}) {
+	std.log(LevelWarn, event, fields, fmt.Sprintf(format, args...))
+}
+
+func Errorf(event string, fields Fields, format string, args ...interface{}) {
+	std.log(LevelError, event, fields, fmt.Sprintf(format, args...))
+}
+
+// Writer returns a writer that logs each line to the default logger
+func Writer(level Level, event string) io.Writer {
+	return std.Writer(level, event)
+}
@@ -0,0 +1,155 @@
+package logger_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"code.cloudfoundry.org/hwc/logger"
+)
+
+var _ = Describe("Logger", func() {
+	var (
+		out    *gbytes.Buffer
+		errOut *gbytes.Buffer
+		log    *logger.Logger
+	)
+
+	BeforeEach(func() {
+		out = gbytes.NewBuffer()
+		errOut = gbytes.NewBuffer()
+		log = logger.New(out, errOut)
+		log.SetClock(func() time.Time {
+			return time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+		})
+	})
+
+	decode := func(line []byte) map[string]interface{} {
+		var entry map[string]interface{}
+		Expect(json.Unmarshal(line, &entry)).To(Succeed())
+		return entry
+	}
+
+	Context("in the text format", func() {
+		It("prints the message of info events to out", func() {
+			log.Infof("server_started", logger.Fields{"instance": "abc"}, "Server Started for %+v", "abc")
+			Expect(string(out.Contents())).To(Equal("Server Started for abc\n"))
+			Expect(errOut.Contents()).To(BeEmpty())
+		})
+
+		It("prints warnings and errors to errOut", func() {
+			log.Warnf("warning", nil, "Warning: careful")
+			log.Errorf("fatal_error", nil, "\n%s", "boom")
+			Expect(string(errOut.Contents())).To(Equal("Warning: careful\n\nboom\n"))
+			Expect(out.Contents()).To(BeEmpty())
+		})
+
+		It("drops events below the level", func() {
+			log.Debugf("debug", nil, "hidden")
+			Expect(out.Contents()).To(BeEmpty())
+
+			log.SetLevel(logger.LevelDebug)
+			log.Debugf("debug", nil, "shown")
+			Expect(string(out.Contents())).To(Equal("shown\n"))
+
+			log.SetLevel(logger.LevelError)
+			log.Warnf("warning", nil, "hidden")
+			Expect(errOut.Contents()).To(BeEmpty())
+		})
+	})
+
+	Context("in the JSON format", func() {
+		BeforeEach(func() {
+			log.SetFormat(logger.JSON)
+		})
+
+		It("writes timestamped events with their fields", func() {
+			log.SetFields(logger.Fields{"instance": "abc", "port": 8080})
+			log.Infof("native_module_loading", logger.Fields{"module": `C:\m\a.dll`}, "HWC loading native module: %s", `C:\m\a.dll`)
+
+			Expect(decode(out.Contents())).To(Equal(map[string]interface{}{
+				"timestamp": "2024-03-01T11:00:00Z",
+				"level":     "info",
+				"event":     "native_module_loading",
+				"message":   `HWC loading native module: C:\m\a.dll`,
+				"instance":  "abc",
+				"port":      float64(8080),
+				"module":    `C:\m\a.dll`,
+			}))
+		})
+
+		It("trims surrounding whitespace from messages", func() {
+			log.Errorf("fatal_error", logger.Fields{"exit_code": 1}, "\n%s", "boom")
+			entry := decode(errOut.Contents())
+			Expect(entry["message"]).To(Equal("boom"))
+			Expect(entry["level"]).To(Equal("error"))
+			Expect(entry["exit_code"]).To(Equal(float64(1)))
+		})
+
+		It("does not let event fields override the standard ones", func() {
+			log.Infof("real_event", logger.Fields{"event": "fake", "level": "fake"}, "message")
+			entry := decode(out.Contents())
+			Expect(entry["event"]).To(Equal("real_event"))
+			Expect(entry["level"]).To(Equal("info"))
+		})
+
+		It("still logs events whose fields cannot be marshalled", func() {
+			log.Infof("odd", logger.Fields{"fn": func() {}}, "message")
+			entry := decode(out.Contents())
+			Expect(entry["event"]).To(Equal("odd"))
+			Expect(entry["error"]).To(ContainSubstring("marshalling fields"))
+		})
+	})
+
+	Describe("Writer", func() {
+		It("logs each line as an event", func() {
+			log.SetFormat(logger.JSON)
+			w := log.Writer(logger.LevelWarn, "web_config_warning")
+			fmt.Fprintf(w, "Warning: one\nWarning: two\n")
+
+			Expect(errOut).To(gbytes.Say(`"event":"web_config_warning".*"message":"Warning: one"`))
+			Expect(errOut).To(gbytes.Say(`"message":"Warning: two"`))
+		})
+
+		It("keeps text output unchanged", func() {
+			w := log.Writer(logger.LevelWarn, "web_config_warning")
+			fmt.Fprintf(w, "Warning: <httpCompression> should not have any attributes\n")
+			Expect(string(errOut.Contents())).To(Equal("Warning: <httpCompression> should not have any attributes\n"))
+		})
+	})
+})
+
+var _ = DescribeTable("ParseFormat",
+	func(name string, expected logger.Format, valid bool) {
+		format, err := logger.ParseFormat(name)
+		if !valid {
+			Expect(err).To(MatchError(fmt.Sprintf("HWC_LOG_FORMAT must be text or json, got %q", name)))
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(format).To(Equal(expected))
+	},
+	Entry("default", "", logger.Text, true),
+	Entry("text", "text", logger.Text, true),
+	Entry("json", "JSON", logger.JSON, true),
+	Entry("invalid", "xml", logger.Text, false),
+)
+
+var _ = DescribeTable("ParseLevel",
+	func(name string, expected logger.Level, valid bool) {
+		level, err := logger.ParseLevel(name)
+		if !valid {
+			Expect(err).To(HaveOccurred())
+			return
+		}
+		Expect(err).ToNot(HaveOccurred())
+		Expect(level).To(Equal(expected))
+	},
+	Entry("debug", "debug", logger.LevelDebug, true),
+	Entry("warn", "WARN", logger.LevelWarn, true),
+	Entry("invalid", "verbose", logger.LevelInfo, false),
+)
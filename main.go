@@ -4,53 +4,114 @@
 package main
 
 import (
-	"crypto/rand"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	_ "runtime/cgo"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	cfenv "github.com/cloudfoundry-community/go-cfenv"
 
+	"code.cloudfoundry.org/hwc/binding"
+	"code.cloudfoundry.org/hwc/configwatch"
 	"code.cloudfoundry.org/hwc/contextpath"
+	"code.cloudfoundry.org/hwc/health"
 	"code.cloudfoundry.org/hwc/hwcconfig"
+	"code.cloudfoundry.org/hwc/instance"
+	"code.cloudfoundry.org/hwc/logger"
+	"code.cloudfoundry.org/hwc/metrics"
+	"code.cloudfoundry.org/hwc/probe"
+	"code.cloudfoundry.org/hwc/settings"
+	"code.cloudfoundry.org/hwc/tempdir"
 	"code.cloudfoundry.org/hwc/validator"
+	"code.cloudfoundry.org/hwc/warmup"
+	"code.cloudfoundry.org/hwc/watchdog"
+	"code.cloudfoundry.org/hwc/webconfig"
 	"code.cloudfoundry.org/hwc/webcore"
 )
 
-var appRootPath string
+var (
+	appRootPath  string
+	tempDirPath  string
+	instanceFlag string
+)
 
 func init() {
 	flag.StringVar(&appRootPath, "appRootPath", ".", "app web root path")
+	flag.StringVar(&instanceFlag, "instance", "", "name of the Hosted Web Core instance (default CF_INSTANCE_GUID or a random UUID)")
+	flag.StringVar(&tempDirPath, "temp-dir", "", "directory holding the temp directory of each instance (default %USERPROFILE%\\tmp)")
 }
 
 func main() {
+	start := time.Now()
 	flag.Parse()
 
-	if os.Getenv("PORT") == "" {
-		checkErr(errors.New("Missing PORT environment variable"))
+	rootPath, err := filepath.Abs(appRootPath)
+	checkErr(err)
+
+	settingsFile, err := settings.Load(rootPath)
+	checkErr(err)
+	var applied []string
+	if settingsFile != nil {
+		applied, err = settingsFile.Apply()
+		checkErr(err)
 	}
-	port, err := strconv.Atoi(os.Getenv("PORT"))
+
+	err = logger.Configure(os.Getenv("HWC_LOG_FORMAT"), os.Getenv("HWC_LOG_LEVEL"))
 	checkErr(err)
 
-	rootPath, err := filepath.Abs(appRootPath)
+	if settingsFile != nil {
+		logger.Infof("settings_loaded", logger.Fields{"path": settingsFile.Path, "applied": applied},
+			"HWC loaded settings from %s: %s", filepath.Base(settingsFile.Path), strings.Join(applied, ", "))
+	}
+
+	port, err := binding.ParsePort(os.Getenv("PORT"))
 	checkErr(err)
+	logger.SetFields(logger.Fields{"port": port})
+
+	bindAddresses, err := binding.ParseAddresses(os.Getenv("HWC_BIND_ADDRESS"))
+	if err != nil {
+		checkErr(fmt.Errorf("HWC_BIND_ADDRESS: %v", err))
+	}
+	for _, address := range bindAddresses {
+		err = binding.CheckAvailable(address, port)
+		checkErr(err)
+	}
 
-	if os.Getenv("USERPROFILE") == "" {
-		checkErr(errors.New("Missing USERPROFILE environment variable"))
+	basePath := tempDirPath
+	if basePath == "" {
+		basePath = os.Getenv("HWC_TEMP_DIR")
 	}
-	tmpPath, err := filepath.Abs(filepath.Join(os.Getenv("USERPROFILE"), "tmp"))
+	if basePath == "" {
+		if os.Getenv("USERPROFILE") == "" {
+			checkErr(errors.New("Missing USERPROFILE environment variable"))
+		}
+		basePath = filepath.Join(os.Getenv("USERPROFILE"), "tmp")
+	}
+	basePath, err = filepath.Abs(basePath)
 	checkErr(err)
 
-	err = os.MkdirAll(tmpPath, 0700)
+	err = os.MkdirAll(basePath, 0700)
 	checkErr(err)
 
+	cleanTemp := false
+	if value := os.Getenv("HWC_TEMP_CLEANUP"); value != "" {
+		cleanTemp, err = strconv.ParseBool(value)
+		if err != nil {
+			checkErr(fmt.Errorf("HWC_TEMP_CLEANUP must be true or false, got %q", value))
+		}
+	}
+
 	contextPath := contextpath.Default()
 	if cfenv.IsRunningOnCF() {
 		appEnv, err := cfenv.Current()
@@ -63,50 +124,288 @@ func main() {
 			checkErr(fmt.Errorf("Getting CF application context path: %v", err))
 		}
 
-		fmt.Printf("Context Path %s\n", contextPath)
+		logger.Infof("context_path", nil, "Context Path %s", contextPath)
 	}
+	logger.SetFields(logger.Fields{"context_path": contextPath})
 
-	uuid, err := generateUUID()
-	if err != nil {
-		checkErr(fmt.Errorf("Generating UUID: %v", err))
+	name, err := instance.Resolve(instanceFlag, rootPath, port, os.LookupEnv)
+	checkErr(err)
+	logger.SetFields(logger.Fields{"instance": name.Value})
+	logger.Infof("instance_name", logger.Fields{"source": name.Source}, "HWC instance %s (from %s)", name.Value, name.Source)
+
+	if cleanTemp {
+		removed, err := tempdir.Clean(basePath)
+		for _, dir := range removed {
+			logger.Infof("temp_directory_removed", logger.Fields{"path": dir}, "HWC removed stale instance directory %s", dir)
+		}
+		if err != nil {
+			logger.Warnf("temp_directory_cleanup_failed", logger.Fields{"error": err.Error()}, "Warning: %v", err)
+		}
+	}
+
+	tmpPath, err := tempdir.Create(basePath, name.Value)
+	checkErr(err)
+
+	var steps []webconfig.Step
+	if name := os.Getenv("HWC_WEB_CONFIG_TRANSFORM"); name != "" {
+		logger.Infof("web_config_transform", logger.Fields{"transform": name}, "HWC applying Web.config transform Web.%s.config", name)
+		steps = append(steps, webconfig.Transform(rootPath, name, logger.Writer(logger.LevelWarn, "web_config_transform_warning")))
+	}
+
+	substituteTokens := false
+	if value := os.Getenv("HWC_CONFIG_TOKENS"); value != "" {
+		substituteTokens, err = strconv.ParseBool(value)
+		if err != nil {
+			checkErr(fmt.Errorf("HWC_CONFIG_TOKENS must be true or false, got %q", value))
+		}
+	}
+	if substituteTokens {
+		steps = append(steps, webconfig.SubstituteTokens(os.LookupEnv))
+	}
+	err = webconfig.Rewrite(rootPath, steps...)
+	checkErr(err)
+
+	var tokenFiles []string
+	if list := os.Getenv("HWC_CONFIG_TOKEN_FILES"); list != "" && !substituteTokens {
+		logger.Warnf("config_token_files_ignored", logger.Fields{"files": list},
+			"Warning: ignoring HWC_CONFIG_TOKEN_FILES because HWC_CONFIG_TOKENS is not true")
+	} else {
+		tokenFiles, err = webconfig.ConfigFiles(rootPath, list)
+		if err != nil {
+			checkErr(fmt.Errorf("HWC_CONFIG_TOKEN_FILES: %v", err))
+		}
+	}
+	for _, path := range tokenFiles {
+		err = webconfig.RewriteFile(path, webconfig.SubstituteTokens(os.LookupEnv))
+		checkErr(err)
+	}
+
+	healthConfig, healthEnabled, err := health.ConfigFromEnv()
+	checkErr(err)
+
+	warmupConfig, warmupEnabled, err := warmup.ConfigFromEnv(rootPath)
+	checkErr(err)
+
+	metricsConfig, metricsEnabled, err := metrics.ConfigFromEnv()
+	checkErr(err)
+
+	watchdogConfig, watchdogEnabled, err := watchdog.ConfigFromEnv()
+	checkErr(err)
+
+	watchConfig, watchEnabled, err := configwatch.ConfigFromEnv()
+	checkErr(err)
+	var process *metrics.Process
+	if metricsEnabled {
+		// a random instance name changes on every start, so count the starts
+		// of the app root and port instead
+		key := name.Value
+		if name.Source == instance.SourceRandom {
+			key = instance.StableName(rootPath, port)
+		}
+		restarts, err := metrics.CountStart(basePath, key)
+		checkErr(err)
+		process = metrics.NewProcess(start, restarts)
 	}
 
-	err, config := hwcconfig.New(port, rootPath, tmpPath, contextPath, uuid)
+	generationStart := time.Now()
+	err, config := hwcconfig.New(port, rootPath, tmpPath, contextPath, name.Value)
 	checkErr(err)
+	generationDuration := time.Since(generationStart)
 
-	err = validator.ValidateWebConfig(filepath.Join(rootPath, "Web.config"), os.Stderr)
+	validationWarnings := logger.Writer(logger.LevelWarn, "web_config_warning")
+	err = validator.ValidateWebConfig(filepath.Join(rootPath, "Web.config"), validationWarnings)
 	checkErr(err)
 
+	if substituteTokens {
+		tokenFiles = append([]string{filepath.Join(rootPath, "Web.config")}, tokenFiles...)
+	}
+	for _, path := range tokenFiles {
+		err = validator.ValidateTokens(path, validationWarnings)
+		checkErr(err)
+	}
+
+	if config.IsModuleOmitted("WebSocketModule") {
+		err = validator.ValidateWebSocketSupport(filepath.Join(rootPath, "Web.config"), validationWarnings)
+		checkErr(err)
+	}
+
+	if !config.MachineKey.Enabled() && runsMultipleInstances() {
+		err = validator.ValidateMachineKey(filepath.Join(rootPath, "Web.config"), validationWarnings)
+		checkErr(err)
+	}
+
 	err, wc := webcore.New()
 	checkErr(err)
 	defer syscall.FreeLibrary(wc.Handle)
 
+	activationStart := time.Now()
 	checkErr(wc.Activate(
 		config.ApplicationHostConfigPath,
 		config.WebConfigPath,
 		config.Instance))
 
+	if metricsEnabled {
+		process.SetConfigGeneration(generationDuration)
+		process.SetActivation(time.Since(activationStart))
+		checkErr(serveMetrics(metricsConfig, process, filepath.Join(config.TempDirectory, "LogFiles")))
+	}
+
+	siteReady := false
+	warmupFailure := ""
+	if warmupEnabled {
+		report := warmup.Run(context.Background(), probe.SiteURL(config.BindAddress, port, contextPath, "/"), warmupConfig)
+		report.Log(logger.Default())
+		if !report.Succeeded() && warmupConfig.ExitOnFailure {
+			checkErr(errors.New("HWC warm-up failed and HWC_WARMUP_FAILURE is exit"))
+		}
+		if report.Succeeded() {
+			siteReady = true
+			logger.Infof("site_ready", nil, "HWC site ready: warm-up complete")
+		} else {
+			warmupFailure = report.Failure()
+		}
+	}
+
+	if healthEnabled {
+		checkErr(serveHealth(healthConfig, config.BindAddress, port, contextPath, siteReady, warmupFailure))
+	}
+
+	if watchEnabled {
+		webConfigPath := filepath.Join(rootPath, "Web.config")
+		watched := append([]string{webConfigPath}, tokenFiles...)
+		validate := configValidator(webConfigPath, substituteTokens, config.IsModuleOmitted("WebSocketModule"))
+		watcher, err := configwatch.New(watched, validate, watchConfig)
+		checkErr(err)
+		go watcher.Run(context.Background(), logger.Default())
+		logger.Infof("config_watch_started", logger.Fields{"files": len(watched), "mode": string(watchConfig.Mode)},
+			"HWC watching %d config file(s) for changes (%s)", len(watched), watchConfig.Mode)
+	}
+
+	if watchdogEnabled {
+		siteURL := probe.SiteURL(config.BindAddress, port, contextPath, watchdogConfig.Path)
+		w := watchdog.New(probe.New(siteURL, watchdogConfig.Timeout), watchdogConfig, logger.Default())
+		go func() {
+			checkErr(w.Run(context.Background()))
+		}()
+		logger.Infof("watchdog_started", logger.Fields{"url": siteURL, "interval": watchdogConfig.Interval.String(), "failures": watchdogConfig.Failures},
+			"HWC watchdog probing %s every %s", siteURL, watchdogConfig.Interval)
+	}
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	<-c
 	checkErr(wc.Shutdown(1, config.Instance))
+
+	if cleanTemp {
+		if err := tempdir.Remove(tmpPath); err != nil {
+			logger.Warnf("temp_directory_cleanup_failed", logger.Fields{"path": tmpPath, "error": err.Error()},
+				"Warning: could not remove instance directory: %v", err)
+		}
+	}
 }
 
-func checkErr(err error) {
+// configValidator validates changes to the config files with the checks
+// run at startup
+func configValidator(webConfigPath string, substituteTokens, webSocketsOmitted bool) configwatch.Validator {
+	return func(path string, writer io.Writer) error {
+		if path != webConfigPath {
+			if err := validator.ValidateXML(path, writer); err != nil {
+				return err
+			}
+			return validator.ValidateTokens(path, writer)
+		}
+
+		if err := validator.ValidateWebConfig(path, writer); err != nil {
+			return err
+		}
+		if webSocketsOmitted {
+			if err := validator.ValidateWebSocketSupport(path, writer); err != nil {
+				return err
+			}
+		}
+		if substituteTokens {
+			return validator.ValidateTokens(path, writer)
+		}
+		return nil
+	}
+}
+
+// serveHealth starts the health listener. Unless warm-up has already shown
+// the site to be ready, it is marked ready once a probe succeeds. After a
+// failed warm-up it is never ready, and /readyz reports the failure.
+func serveHealth(healthConfig health.Config, bindAddress string, port int, contextPath string, siteReady bool, warmupFailure string) error {
+	siteURL := probe.SiteURL(bindAddress, port, contextPath, healthConfig.Path)
+	healthServer := health.New(probe.New(siteURL, healthConfig.Timeout))
+	healthServer.SetWarmupFailure(warmupFailure)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", healthConfig.Port))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "\n%s\n", err)
-		os.Exit(1)
+		return fmt.Errorf("HWC_HEALTH_PORT: %v", err)
+	}
+	go func() {
+		checkErr(http.Serve(listener, healthServer.Handler()))
+	}()
+	logger.Infof("health_listening", logger.Fields{"health_port": healthConfig.Port, "url": siteURL},
+		"HWC serving /healthz and /readyz on port %d, probing %s", healthConfig.Port, siteURL)
+
+	if siteReady {
+		healthServer.SetReady(true)
+		return nil
 	}
+	if warmupFailure != "" {
+		logger.Warnf("site_not_ready", logger.Fields{"warmup": warmupFailure},
+			"HWC site not ready: %s", warmupFailure)
+		return nil
+	}
+
+	go func() {
+		result := healthServer.WaitUntilHealthy(context.Background(), time.Second)
+		logger.Infof("site_ready", logger.Fields{"url": result.URL, "status_code": result.StatusCode},
+			"HWC site ready: %s", result)
+	}()
+	return nil
 }
 
-func generateUUID() (string, error) {
-	const size = 128 / 8
-	const format = "%08x-%04x-%04x-%04x-%012x"
-	var u [size]byte
-	if _, err := io.ReadFull(rand.Reader, u[0:]); err != nil {
-		return "", fmt.Errorf("error reading random number generator: %v", err)
+// serveMetrics starts the metrics listener and follows the site's W3C log
+func serveMetrics(metricsConfig metrics.Config, process *metrics.Process, logDirectory string) error {
+	aggregator := metrics.NewAggregator(metricsConfig.PathPrefixes)
+	tailer := metrics.NewTailer(logDirectory, aggregator.Line)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", metricsConfig.Port))
+	if err != nil {
+		return fmt.Errorf("HWC_METRICS_PORT: %v", err)
+	}
+	go func() {
+		checkErr(http.Serve(listener, metrics.Handler(process, aggregator)))
+	}()
+	go func() {
+		err := tailer.Run(context.Background(), time.Second)
+		if err != nil {
+			logger.Warnf("metrics_log_failed", logger.Fields{"directory": logDirectory, "error": err.Error()},
+				"HWC stopped reading the W3C log for metrics: %v", err)
+		}
+	}()
+	logger.Infof("metrics_listening", logger.Fields{"metrics_port": metricsConfig.Port},
+		"HWC serving /metrics on port %d", metricsConfig.Port)
+	return nil
+}
+
+// runsMultipleInstances reports whether this is known to be one of several
+// instances of the app. Cloud Foundry does not expose the instance count, but
+// any instance other than the first implies there are more.
+func runsMultipleInstances() bool {
+	index, err := strconv.Atoi(os.Getenv("CF_INSTANCE_INDEX"))
+	return err == nil && index > 0
+}
+
+func checkErr(err error) {
+	if err != nil {
+		fields := logger.Fields{"error": err.Error(), "exit_code": 1}
+		var wcErr *webcore.Error
+		if errors.As(err, &wcErr) {
+			fields["error_code"] = fmt.Sprintf("0x%02x", wcErr.Code)
+		}
+		logger.Errorf("fatal_error", fields, "\n%s", err)
+		os.Exit(1)
 	}
-	u[6] = (u[6] & 0x0f) | 0x40
-	u[8] = (u[8] & 0x3f) | 0x80
-	return fmt.Sprintf(format, u[:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
 }
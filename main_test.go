@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -32,6 +33,38 @@ var _ = Describe("HWC", func() {
 		})
 	})
 
+	Context("when the app PORT is out of range", func() {
+		It("errors", func() {
+			app := startAppWithEnv("nora", []string{"PORT=70000"}, false)
+			Eventually(app.session).Should(gexec.Exit(1))
+			Eventually(app.session.Err).Should(gbytes.Say("PORT must be between 1 and 65535, got 70000"))
+			stopApp(app)
+		})
+	})
+
+	Context("when HWC_BIND_ADDRESS is a host name", func() {
+		It("errors", func() {
+			app := startAppWithEnv("nora", []string{"HWC_BIND_ADDRESS=localhost"}, false)
+			Eventually(app.session).Should(gexec.Exit(1))
+			Eventually(app.session.Err).Should(gbytes.Say(`HWC_BIND_ADDRESS: bind address "localhost" is a host name`))
+			stopApp(app)
+		})
+	})
+
+	Context("when the app PORT is already in use", func() {
+		It("errors", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer listener.Close()
+			port := listener.Addr().(*net.TCPAddr).Port
+
+			app := startAppWithEnv("nora", []string{"HWC_BIND_ADDRESS=127.0.0.1", fmt.Sprintf("PORT=%d", port)}, false)
+			Eventually(app.session).Should(gexec.Exit(1))
+			Eventually(app.session.Err).Should(gbytes.Say(fmt.Sprintf("port %d is already in use on 127.0.0.1", port)))
+			stopApp(app)
+		})
+	})
+
 	Context("when the app USERPROFILE is not set", func() {
 		It("errors", func() {
 			app := startAppWithEnv("nora", []string{"USERPROFILE="}, false)
@@ -80,12 +113,11 @@ var _ = Describe("HWC", func() {
 			Expect(os.RemoveAll(otherDir)).To(Succeed())
 		})
 
-		It("exits with an error when the module directory contains an invalid DLL", func() {
+		It("exits with an error when the module directory contains no PE images", func() {
 			app := startAppWithEnv("nora", []string{fmt.Sprintf("HWC_NATIVE_MODULES=%s;%s", someDir, otherDir)}, false)
 			Eventually(app.session).Should(gexec.Exit(1))
-			Eventually(app.session).Should(gbytes.Say("HWC loading native module: .*some-module.html"))
-			Eventually(app.session).Should(gbytes.Say("HWC loading native module: .*other-module.html"))
-			Eventually(app.session.Err).Should(gbytes.Say("HWC Failed to start: return code:"))
+			Eventually(app.session).Should(gbytes.Say("HWC skipping native module: .*some-module.html is not a PE image"))
+			Eventually(app.session.Err).Should(gbytes.Say("HWC_NATIVE_MODULES: .*some-modules-dir.* contains no PE images"))
 			stopApp(app)
 		})
 	})
@@ -116,7 +148,7 @@ var _ = Describe("HWC", func() {
 			Expect(header["Content-Encoding"]).To(ContainElement("gzip"))
 			Expect(header["Vary"]).To(ContainElement("Accept-Encoding"))
 
-			cachePath := filepath.Join(app.profileDir, "tmp", "IIS Temporary Compressed Files", fmt.Sprintf("AppPool%d", app.port), "$^_gzip_C^")
+			cachePath := filepath.Join(instanceTempDir(app.profileDir), "IIS Temporary Compressed Files", fmt.Sprintf("AppPool%d", app.port), "$^_gzip_C^")
 			cacheInfo, err := os.Stat(cachePath)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(cacheInfo.IsDir())
@@ -205,21 +237,22 @@ var _ = Describe("HWC", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(res.StatusCode).To(Equal(200))
 
-			Expect(filepath.Join(app.profileDir, "tmp", "root")).To(BeADirectory())
+			tmpDir := instanceTempDir(app.profileDir)
+			Expect(filepath.Join(tmpDir, "root")).To(BeADirectory())
 			Expect(err).ToNot(HaveOccurred())
 
-			By("placing config files in the temp directory", func() {
-				Expect(filepath.Join(app.profileDir, "tmp", "config", "Web.config")).To(BeAnExistingFile())
-				Expect(filepath.Join(app.profileDir, "tmp", "config", "ApplicationHost.config")).To(BeAnExistingFile())
-				Expect(filepath.Join(app.profileDir, "tmp", "config", "Aspnet.config")).To(BeAnExistingFile())
+			By("placing config files in the instance temp directory", func() {
+				Expect(filepath.Join(tmpDir, "config", "Web.config")).To(BeAnExistingFile())
+				Expect(filepath.Join(tmpDir, "config", "ApplicationHost.config")).To(BeAnExistingFile())
+				Expect(filepath.Join(tmpDir, "config", "Aspnet.config")).To(BeAnExistingFile())
 			})
 
 			By("creating an IIS Temporary Compressed Files directory", func() {
-				Expect(filepath.Join(app.profileDir, "tmp", "IIS Temporary Compressed Files")).To(BeADirectory())
+				Expect(filepath.Join(tmpDir, "IIS Temporary Compressed Files")).To(BeADirectory())
 			})
 
 			By("creating an ASP Compiled Templates directory", func() {
-				Expect(filepath.Join(app.profileDir, "tmp", "ASP Compiled Templates")).To(BeADirectory())
+				Expect(filepath.Join(tmpDir, "ASP Compiled Templates")).To(BeADirectory())
 			})
 		})
 
@@ -321,6 +354,123 @@ var _ = Describe("HWC", func() {
 		})
 	})
 
+	Context("when multiple hwc processes share a USERPROFILE", func() {
+		var (
+			profileDir string
+			app1       hwcApp
+			app2       hwcApp
+		)
+
+		BeforeEach(func() {
+			var err error
+			profileDir, err = os.MkdirTemp("", "hwcsharedprofile")
+			Expect(err).ToNot(HaveOccurred())
+
+			app1 = startAppWithEnv("nora", []string{"USERPROFILE=" + profileDir}, false)
+			Eventually(app1.session).Should(gbytes.Say("Server Started"))
+			app2 = startAppWithEnv("nora", []string{"USERPROFILE=" + profileDir}, false)
+			Eventually(app2.session).Should(gbytes.Say("Server Started"))
+		})
+
+		AfterEach(func() {
+			stopApp(app1)
+			Eventually(app1.session).Should(gexec.Exit(0))
+			stopApp(app2)
+			Eventually(app2.session).Should(gexec.Exit(0))
+			Eventually(func() error { return os.RemoveAll(profileDir) }, 10*time.Second, time.Second).Should(Succeed())
+		})
+
+		It("gives each instance its own config directory", func() {
+			pidFiles, err := filepath.Glob(filepath.Join(profileDir, "tmp", "*", "hwc.pid"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pidFiles).To(HaveLen(2))
+
+			for _, pidFile := range pidFiles {
+				config, err := os.ReadFile(filepath.Join(filepath.Dir(pidFile), "config", "ApplicationHost.config"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(config)).To(Or(
+					ContainSubstring(fmt.Sprintf(":%d:", app1.port)),
+					ContainSubstring(fmt.Sprintf(":%d:", app2.port))))
+			}
+
+			for _, app := range []hwcApp{app1, app2} {
+				res, err := http.Get(fmt.Sprintf("http://localhost:%d", app.port))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(res.StatusCode).To(Equal(200))
+			}
+		})
+	})
+
+	Context("when HWC_INSTANCE_NAME is set", func() {
+		It("names the instance and its temp directory", func() {
+			app := startAppWithEnv("nora", []string{"HWC_INSTANCE_NAME=nora-blue", "CF_INSTANCE_GUID=0b2a4f1e-7c3d-4e5f-8a9b-1c2d3e4f5a6b"}, false)
+			Eventually(app.session).Should(gbytes.Say("HWC instance nora-blue \\(from HWC_INSTANCE_NAME\\)"))
+			Eventually(app.session).Should(gbytes.Say("Server Started for nora-blue"))
+			Expect(filepath.Join(app.profileDir, "tmp", "nora-blue", "hwc.pid")).To(BeAnExistingFile())
+
+			stopApp(app)
+			Eventually(app.session).Should(gexec.Exit(0))
+		})
+
+		It("errors when the name is invalid", func() {
+			app := startAppWithEnv("nora", []string{"HWC_INSTANCE_NAME=nora blue"}, false)
+			Eventually(app.session).Should(gexec.Exit(1))
+			Eventually(app.session.Err).Should(gbytes.Say(`HWC_INSTANCE_NAME: instance name "nora blue" contains ' '`))
+			stopApp(app)
+		})
+	})
+
+	Context("when CF_INSTANCE_GUID is set", func() {
+		It("names the instance after it", func() {
+			app := startAppWithEnv("nora", []string{"CF_INSTANCE_GUID=0b2a4f1e-7c3d-4e5f-8a9b-1c2d3e4f5a6b"}, false)
+			Eventually(app.session).Should(gbytes.Say("Server Started for 0b2a4f1e-7c3d-4e5f-8a9b-1c2d3e4f5a6b"))
+
+			stopApp(app)
+			Eventually(app.session).Should(gexec.Exit(0))
+		})
+	})
+
+	Context("when HWC_TEMP_DIR and HWC_TEMP_CLEANUP are set", func() {
+		var (
+			tempDir  string
+			staleDir string
+			app      hwcApp
+		)
+
+		BeforeEach(func() {
+			var err error
+			tempDir, err = os.MkdirTemp("", "hwctempdir")
+			Expect(err).ToNot(HaveOccurred())
+
+			exited := exec.Command("cmd", "/c", "exit 0")
+			Expect(exited.Run()).To(Succeed())
+			staleDir = filepath.Join(tempDir, "stale-instance")
+			Expect(os.MkdirAll(filepath.Join(staleDir, "config"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(staleDir, "hwc.pid"), []byte(strconv.Itoa(exited.Process.Pid)), 0600)).To(Succeed())
+
+			app = startAppWithEnv("nora", []string{"HWC_TEMP_DIR=" + tempDir, "HWC_TEMP_CLEANUP=true"}, false)
+			Eventually(app.session).Should(gbytes.Say("Server Started"))
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tempDir)).To(Succeed())
+		})
+
+		It("uses the directory, removes stale instances and its own directory on shutdown", func() {
+			Expect(app.session.Out).To(gbytes.Say("HWC removed stale instance directory"))
+			Expect(staleDir).NotTo(BeADirectory())
+
+			tmpDir := instanceTempDir(tempDir)
+			Expect(strings.HasPrefix(tmpDir, tempDir)).To(BeTrue())
+			Expect(filepath.Join(tmpDir, "config", "ApplicationHost.config")).To(BeAnExistingFile())
+			Expect(filepath.Join(app.profileDir, "tmp")).NotTo(BeADirectory())
+
+			stopApp(app)
+			Eventually(app.session).Should(gexec.Exit(0))
+			Expect(tmpDir).NotTo(BeADirectory())
+		})
+	})
+
 	Context("The app has an infinite redirect loop", func() {
 		var app hwcApp
 
@@ -402,6 +552,27 @@ var _ = Describe("HWC", func() {
 				" and <dynamicTypes> but it has <scheme>"))
 		})
 	})
+
+	Context("when HWC_LOG_FORMAT is json", func() {
+		var app hwcApp
+
+		BeforeEach(func() {
+			app = startAppWithEnv("nora", []string{"HWC_LOG_FORMAT=json"}, true)
+			Eventually(app.session).Should(gbytes.Say(`"event":"server_started"`))
+		})
+
+		AfterEach(func() {
+			stopApp(app)
+			Eventually(app.session).Should(gbytes.Say(`"event":"server_shutdown"`))
+			Eventually(app.session).Should(gexec.Exit(0))
+		})
+
+		It("logs events as JSON with the instance and port", func() {
+			Expect(app.session.Out.Contents()).To(ContainSubstring(fmt.Sprintf(`"port":%d`, app.port)))
+			Expect(app.session.Out.Contents()).To(ContainSubstring(`"instance":"`))
+			Eventually(app.session.Err).Should(gbytes.Say(`"event":"web_config_warning".*"level":"warn"`))
+		})
+	})
 })
 
 type hwcApp struct {
@@ -424,6 +595,20 @@ func stopApp(app hwcApp) {
 	Expect(os.RemoveAll(app.profileDir)).To(Succeed())
 }
 
+// instanceTempDir returns the only instance directory under the temp
+// directory of profileDir, or under profileDir itself when it is a
+// HWC_TEMP_DIR
+func instanceTempDir(profileDir string) string {
+	pidFiles, err := filepath.Glob(filepath.Join(profileDir, "tmp", "*", "hwc.pid"))
+	Expect(err).ToNot(HaveOccurred())
+	if len(pidFiles) == 0 {
+		pidFiles, err = filepath.Glob(filepath.Join(profileDir, "*", "hwc.pid"))
+		Expect(err).ToNot(HaveOccurred())
+	}
+	Expect(pidFiles).To(HaveLen(1))
+	return filepath.Dir(pidFiles[0])
+}
+
 func startApp(fixtureName string) hwcApp {
 	return startAppWithEnv(fixtureName, []string{}, false)
 }
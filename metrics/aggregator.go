@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// otherPrefix labels requests beyond MaxPrefixes distinct prefixes
+const otherPrefix = "other"
+
+// Aggregator turns W3C log entries into request metrics
+type Aggregator struct {
+	// Prefixes group request latencies by the longest matching path prefix.
+	// Without prefixes, requests are grouped by their first path segment.
+	Prefixes []string
+	// MaxPrefixes bounds the number of first path segments tracked
+	MaxPrefixes int
+
+	mu          sync.Mutex
+	parser      *Parser
+	requests    map[int]uint64
+	latencies   map[string]*histogram
+	lines       uint64
+	parseErrors uint64
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     time.Duration
+}
+
+func NewAggregator(prefixes []string) *Aggregator {
+	return &Aggregator{
+		Prefixes:    prefixes,
+		MaxPrefixes: 50,
+		parser:      NewParser(),
+		requests:    map[int]uint64{},
+		latencies:   map[string]*histogram{},
+	}
+}
+
+// Line parses a line of the W3C log. When existing is set, the line was
+// logged before hwc started and only its directives are taken into account.
+func (a *Aggregator) Line(line string, existing bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok, err := a.parser.Parse(line)
+	if existing {
+		return
+	}
+	if err != nil {
+		a.parseErrors++
+		return
+	}
+	if !ok {
+		return
+	}
+
+	a.lines++
+	a.observe(entry)
+}
+
+// Observe records a request
+func (a *Aggregator) Observe(entry Entry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.observe(entry)
+}
+
+func (a *Aggregator) observe(entry Entry) {
+	a.requests[entry.Status]++
+
+	prefix := a.prefix(entry.Path)
+	h, ok := a.latencies[prefix]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		a.latencies[prefix] = h
+	}
+
+	seconds := entry.TimeTaken.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += entry.TimeTaken
+}
+
+func (a *Aggregator) prefix(path string) string {
+	if len(a.Prefixes) > 0 {
+		best := ""
+		for _, prefix := range a.Prefixes {
+			if matchesPrefix(path, prefix) && len(prefix) > len(best) {
+				best = prefix
+			}
+		}
+		if best == "" {
+			return otherPrefix
+		}
+		return best
+	}
+
+	prefix := "/"
+	if segment := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]; segment != "" && strings.Contains(path[1:], "/") {
+		prefix = "/" + strings.ToLower(segment)
+	}
+	if _, tracked := a.latencies[prefix]; !tracked && len(a.latencies) >= a.MaxPrefixes {
+		return otherPrefix
+	}
+	return prefix
+}
+
+// matchesPrefix matches whole path segments, so /api matches /api/orders
+// but not /apiary
+func matchesPrefix(path, prefix string) bool {
+	path = strings.ToLower(path)
+	prefix = strings.ToLower(strings.TrimSuffix(prefix, "/"))
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// WriteTo writes the request metrics in the Prometheus text format
+func (a *Aggregator) WriteTo(w io.Writer) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e := &exposition{w: w}
+
+	e.help("hwc_http_requests_total", "counter", "Requests served by the site, read from its W3C log, by status code.")
+	statuses := make([]int, 0, len(a.requests))
+	for status := range a.requests {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		e.sample("hwc_http_requests_total", labels{"status", strconv.Itoa(status)}, float64(a.requests[status]))
+	}
+
+	e.help("hwc_http_request_duration_seconds", "histogram", "Time taken to serve requests, read from the W3C log, by path prefix.")
+	prefixes := make([]string, 0, len(a.latencies))
+	for prefix := range a.latencies {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		h := a.latencies[prefix]
+		for i, bound := range latencyBuckets {
+			e.sample("hwc_http_request_duration_seconds_bucket", labels{"path_prefix", prefix, "le", formatFloat(bound)}, float64(h.buckets[i]))
+		}
+		e.sample("hwc_http_request_duration_seconds_bucket", labels{"path_prefix", prefix, "le", "+Inf"}, float64(h.count))
+		e.sample("hwc_http_request_duration_seconds_sum", labels{"path_prefix", prefix}, h.sum.Seconds())
+		e.sample("hwc_http_request_duration_seconds_count", labels{"path_prefix", prefix}, float64(h.count))
+	}
+
+	e.help("hwc_w3c_log_lines_total", "counter", "Request lines read from the W3C log.")
+	e.sample("hwc_w3c_log_lines_total", nil, float64(a.lines))
+	e.help("hwc_w3c_log_parse_errors_total", "counter", "Lines of the W3C log that could not be parsed.")
+	e.sample("hwc_w3c_log_parse_errors_total", nil, float64(a.parseErrors))
+
+	return e.n, e.err
+}
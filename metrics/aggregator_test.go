@@ -0,0 +1,104 @@
+package metrics_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/metrics"
+)
+
+func feedFixture(aggregator *metrics.Aggregator, name string) {
+	data, err := os.ReadFile(filepath.Join("..", "fixtures", "w3c", name))
+	Expect(err).NotTo(HaveOccurred())
+	for _, line := range strings.Split(string(data), "\n") {
+		aggregator.Line(line, false)
+	}
+}
+
+func exposition(aggregator *metrics.Aggregator) string {
+	var out bytes.Buffer
+	_, err := aggregator.WriteTo(&out)
+	Expect(err).NotTo(HaveOccurred())
+	return out.String()
+}
+
+var _ = Describe("Aggregator", func() {
+	It("counts requests by status", func() {
+		aggregator := metrics.NewAggregator(nil)
+		feedFixture(aggregator, "u_ex261019.log")
+
+		output := exposition(aggregator)
+		Expect(output).To(ContainSubstring("# TYPE hwc_http_requests_total counter\n"))
+		Expect(output).To(ContainSubstring("hwc_http_requests_total{status=\"200\"} 2\n" +
+			"hwc_http_requests_total{status=\"304\"} 1\n" +
+			"hwc_http_requests_total{status=\"404\"} 2\n" +
+			"hwc_http_requests_total{status=\"500\"} 1\n"))
+		Expect(output).To(ContainSubstring("hwc_w3c_log_lines_total 6\n"))
+		Expect(output).To(ContainSubstring("hwc_w3c_log_parse_errors_total 0\n"))
+	})
+
+	It("groups latencies by first path segment by default", func() {
+		aggregator := metrics.NewAggregator(nil)
+		feedFixture(aggregator, "u_ex261019.log")
+
+		output := exposition(aggregator)
+		Expect(output).To(ContainSubstring("# TYPE hwc_http_request_duration_seconds histogram\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_bucket{path_prefix="/",le="0.005"} 2` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_bucket{path_prefix="/api",le="0.01"} 1` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_bucket{path_prefix="/api",le="0.05"} 2` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_bucket{path_prefix="/api",le="1"} 2` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_bucket{path_prefix="/api",le="2.5"} 3` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_bucket{path_prefix="/api",le="+Inf"} 3` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_sum{path_prefix="/api"} 1.249` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_count{path_prefix="/api"} 3` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_count{path_prefix="/content"} 1` + "\n"))
+	})
+
+	It("groups latencies by the longest configured prefix", func() {
+		aggregator := metrics.NewAggregator([]string{"/api", "/api/orders"})
+		feedFixture(aggregator, "u_ex261019.log")
+
+		output := exposition(aggregator)
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_count{path_prefix="/api"} 1` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_count{path_prefix="/api/orders"} 2` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_count{path_prefix="other"} 3` + "\n"))
+	})
+
+	It("bounds the number of prefixes", func() {
+		aggregator := metrics.NewAggregator(nil)
+		aggregator.MaxPrefixes = 1
+		feedFixture(aggregator, "u_ex261019.log")
+
+		output := exposition(aggregator)
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_count{path_prefix="/"} 2` + "\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_count{path_prefix="other"} 4` + "\n"))
+	})
+
+	It("follows layout changes within a file and counts lines it cannot parse", func() {
+		aggregator := metrics.NewAggregator(nil)
+		feedFixture(aggregator, "u_ex261020.log")
+
+		output := exposition(aggregator)
+		Expect(output).To(ContainSubstring("hwc_http_requests_total{status=\"200\"} 2\n" +
+			"hwc_http_requests_total{status=\"503\"} 1\n"))
+		Expect(output).To(ContainSubstring(`hwc_http_request_duration_seconds_sum{path_prefix="/reports"} 3.1` + "\n"))
+		Expect(output).To(ContainSubstring("hwc_w3c_log_lines_total 3\n"))
+		Expect(output).To(ContainSubstring("hwc_w3c_log_parse_errors_total 1\n"))
+	})
+
+	It("only takes directives from lines logged before hwc started", func() {
+		aggregator := metrics.NewAggregator(nil)
+		aggregator.Line("#Fields: sc-status cs-uri-stem", true)
+		aggregator.Line("200 /old", true)
+		aggregator.Line("201 /new", false)
+
+		output := exposition(aggregator)
+		Expect(output).To(ContainSubstring("hwc_http_requests_total{status=\"201\"} 1\n"))
+		Expect(output).NotTo(ContainSubstring(`status="200"`))
+	})
+})
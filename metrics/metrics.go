@@ -0,0 +1,75 @@
+// Package metrics publishes hwc process metrics and request metrics read
+// from the site's W3C log in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Config configures the metrics listener
+type Config struct {
+	// Port the metrics listener listens on
+	Port int
+	// PathPrefixes group request latencies
+	PathPrefixes []string
+}
+
+// ConfigFromEnv reads HWC_METRICS_PORT and HWC_METRICS_PATH_PREFIXES. It
+// returns false when HWC_METRICS_PORT is unset.
+func ConfigFromEnv() (Config, bool, error) {
+	config := Config{}
+
+	value := os.Getenv("HWC_METRICS_PORT")
+	if value == "" {
+		return config, false, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return config, false, fmt.Errorf("HWC_METRICS_PORT must be a port number, got %q", value)
+	}
+	config.Port = port
+
+	for _, prefix := range strings.Split(os.Getenv("HWC_METRICS_PATH_PREFIXES"), ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+		if !strings.HasPrefix(prefix, "/") {
+			return config, false, fmt.Errorf("HWC_METRICS_PATH_PREFIXES entries must start with /, got %q", prefix)
+		}
+		config.PathPrefixes = append(config.PathPrefixes, prefix)
+	}
+
+	return config, true, nil
+}
+
+// Handler serves the metrics of each writer at /metrics
+func Handler(writers ...io.WriterTo) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method == http.MethodHead {
+			return
+		}
+		for _, writer := range writers {
+			if _, err := writer.WriteTo(w); err != nil {
+				return
+			}
+		}
+	})
+	return mux
+}
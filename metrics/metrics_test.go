@@ -0,0 +1,152 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/metrics"
+)
+
+var _ = Describe("ConfigFromEnv", func() {
+	BeforeEach(func() {
+		for _, name := range []string{"HWC_METRICS_PORT", "HWC_METRICS_PATH_PREFIXES"} {
+			value, set := os.LookupEnv(name)
+			DeferCleanup(func() {
+				if set {
+					os.Setenv(name, value)
+				} else {
+					os.Unsetenv(name)
+				}
+			})
+			os.Unsetenv(name)
+		}
+	})
+
+	It("is disabled without a port", func() {
+		_, enabled, err := metrics.ConfigFromEnv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeFalse())
+	})
+
+	It("reads the port and path prefixes", func() {
+		os.Setenv("HWC_METRICS_PORT", "9102")
+		os.Setenv("HWC_METRICS_PATH_PREFIXES", "/api, /admin,")
+
+		config, enabled, err := metrics.ConfigFromEnv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeTrue())
+		Expect(config).To(Equal(metrics.Config{Port: 9102, PathPrefixes: []string{"/api", "/admin"}}))
+	})
+
+	It("rejects an invalid port", func() {
+		os.Setenv("HWC_METRICS_PORT", "70000")
+		_, _, err := metrics.ConfigFromEnv()
+		Expect(err).To(MatchError(`HWC_METRICS_PORT must be a port number, got "70000"`))
+	})
+
+	It("rejects relative path prefixes", func() {
+		os.Setenv("HWC_METRICS_PORT", "9102")
+		os.Setenv("HWC_METRICS_PATH_PREFIXES", "api")
+		_, _, err := metrics.ConfigFromEnv()
+		Expect(err).To(MatchError(`HWC_METRICS_PATH_PREFIXES entries must start with /, got "api"`))
+	})
+})
+
+var _ = Describe("Process", func() {
+	It("writes the process metrics", func() {
+		start := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+		process := metrics.NewProcess(start, 2)
+		process.SetClock(func() time.Time { return start.Add(90 * time.Second) })
+		process.SetConfigGeneration(25 * time.Millisecond)
+		process.SetActivation(1500 * time.Millisecond)
+
+		var out bytes.Buffer
+		_, err := process.WriteTo(&out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.String()).To(Equal(`# HELP hwc_uptime_seconds Time since hwc started.
+# TYPE hwc_uptime_seconds gauge
+hwc_uptime_seconds 90
+# HELP hwc_config_generation_duration_seconds Time taken to generate the applicationHost.config and web.config.
+# TYPE hwc_config_generation_duration_seconds gauge
+hwc_config_generation_duration_seconds 0.025
+# HELP hwc_activation_duration_seconds Time taken by the Hostable Web Core to activate the site.
+# TYPE hwc_activation_duration_seconds gauge
+hwc_activation_duration_seconds 1.5
+# HELP hwc_restarts_total Times hwc has been restarted in this container.
+# TYPE hwc_restarts_total counter
+hwc_restarts_total 2
+`))
+	})
+
+	It("counts restarts in the temp directory", func() {
+		dir := GinkgoT().TempDir()
+		Expect(metrics.CountStart(dir, "instance-1")).To(Equal(0))
+		Expect(metrics.CountStart(dir, "instance-1")).To(Equal(1))
+		Expect(metrics.CountStart(dir, "instance-1")).To(Equal(2))
+
+		Expect(os.WriteFile(filepath.Join(dir, "hwc-starts-instance-1"), []byte("many"), 0600)).To(Succeed())
+		_, err := metrics.CountStart(dir, "instance-1")
+		Expect(err).To(MatchError(ContainSubstring("hwc-starts-instance-1")))
+	})
+
+	It("counts restarts under each key separately", func() {
+		dir := GinkgoT().TempDir()
+		Expect(metrics.CountStart(dir, "instance-1")).To(Equal(0))
+		Expect(metrics.CountStart(dir, "instance-1")).To(Equal(1))
+		Expect(metrics.CountStart(dir, "instance-2")).To(Equal(0))
+	})
+
+	It("removes the counts of keys that have not started for a long time", func() {
+		dir := GinkgoT().TempDir()
+		stale := filepath.Join(dir, "hwc-starts-old-key")
+		recent := filepath.Join(dir, "hwc-starts-other-key")
+		Expect(os.WriteFile(stale, []byte("3"), 0600)).To(Succeed())
+		Expect(os.WriteFile(recent, []byte("3"), 0600)).To(Succeed())
+		old := time.Now().Add(-31 * 24 * time.Hour)
+		Expect(os.Chtimes(stale, old, old)).To(Succeed())
+
+		Expect(metrics.CountStart(dir, "instance-1")).To(Equal(0))
+		Expect(stale).ToNot(BeAnExistingFile())
+		Expect(recent).To(BeAnExistingFile())
+	})
+})
+
+var _ = Describe("Handler", func() {
+	var handler http.Handler
+
+	BeforeEach(func() {
+		aggregator := metrics.NewAggregator(nil)
+		aggregator.Line("200 /", false)
+		aggregator.Line("#Fields: sc-status cs-uri-stem", false)
+		aggregator.Line("200 /", false)
+		handler = metrics.Handler(metrics.NewProcess(time.Now(), 0), aggregator)
+	})
+
+	It("serves every set of metrics at /metrics", func() {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+		Expect(recorder.Body.String()).To(ContainSubstring("hwc_restarts_total 0\n"))
+		Expect(recorder.Body.String()).To(ContainSubstring("hwc_http_requests_total{status=\"200\"} 1\n"))
+		Expect(recorder.Body.String()).To(ContainSubstring("hwc_w3c_log_parse_errors_total 1\n"))
+	})
+
+	It("only allows GET and HEAD", func() {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/other", nil))
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+})
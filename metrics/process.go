@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// startsFile prefixes the files counting the starts under each key
+const startsFile = "hwc-starts"
+
+// staleStartsAge is how long a key must have gone without a start before
+// CountStart removes its file
+const staleStartsAge = 30 * 24 * time.Hour
+
+// Process holds the metrics of the hwc process itself
+type Process struct {
+	Start    time.Time
+	Restarts int
+
+	mu               sync.Mutex
+	configGeneration time.Duration
+	activation       time.Duration
+	now              func() time.Time
+}
+
+func NewProcess(start time.Time, restarts int) *Process {
+	return &Process{Start: start, Restarts: restarts, now: time.Now}
+}
+
+func (p *Process) SetConfigGeneration(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.configGeneration = d
+}
+
+func (p *Process) SetActivation(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.activation = d
+}
+
+// SetClock replaces the clock used for the uptime
+func (p *Process) SetClock(now func() time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.now = now
+}
+
+// WriteTo writes the process metrics in the Prometheus text format
+func (p *Process) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e := &exposition{w: w}
+	e.help("hwc_uptime_seconds", "gauge", "Time since hwc started.")
+	e.sample("hwc_uptime_seconds", nil, p.now().Sub(p.Start).Seconds())
+	e.help("hwc_config_generation_duration_seconds", "gauge", "Time taken to generate the applicationHost.config and web.config.")
+	e.sample("hwc_config_generation_duration_seconds", nil, p.configGeneration.Seconds())
+	e.help("hwc_activation_duration_seconds", "gauge", "Time taken by the Hostable Web Core to activate the site.")
+	e.sample("hwc_activation_duration_seconds", nil, p.activation.Seconds())
+	e.help("hwc_restarts_total", "counter", "Times hwc has been restarted in this container.")
+	e.sample("hwc_restarts_total", nil, float64(p.Restarts))
+	return e.n, e.err
+}
+
+// CountStart records a start of hwc under key in dir and returns the number
+// of earlier starts under the same key, i.e. restarts. key must stay the same
+// across restarts. Files of keys that have not started for staleStartsAge,
+// e.g. after the app moved to another port, are removed. dir lives in the
+// container, so the count starts over in a new container.
+func CountStart(dir, key string) (int, error) {
+	path := filepath.Join(dir, startsFile+"-"+key)
+
+	starts := 0
+	data, err := os.ReadFile(path)
+	if err == nil {
+		starts, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	if err := os.WriteFile(path, []byte(strconv.Itoa(starts+1)), 0600); err != nil {
+		return 0, err
+	}
+	removeStaleStarts(dir, time.Now().Add(-staleStartsAge))
+	return starts, nil
+}
+
+// removeStaleStarts removes the start counts last written before cutoff. It
+// is best effort: a count left behind only takes up space.
+func removeStaleStarts(dir string, cutoff time.Time) {
+	paths, _ := filepath.Glob(filepath.Join(dir, startsFile+"-*"))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err == nil && info.Mode().IsRegular() && info.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Tailer follows the newest *.log file under Dir, handing each complete
+// line to Line. IIS starts a new log file every day, and the tailer moves to
+// it once the previous one has been read to the end.
+type Tailer struct {
+	Dir string
+	// Line receives each line; existing is set for lines that were already
+	// in the log when the tailer started
+	Line func(line string, existing bool)
+
+	path    string
+	offset  int64
+	partial []byte
+	started bool
+}
+
+func NewTailer(dir string, line func(string, bool)) *Tailer {
+	return &Tailer{Dir: dir, Line: line}
+}
+
+// Run polls the log directory every interval until ctx is done
+func (t *Tailer) Run(ctx context.Context, interval time.Duration) error {
+	for {
+		if err := t.Poll(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Poll reads whatever has been logged since the previous poll
+func (t *Tailer) Poll() error {
+	newest, err := t.newest()
+	if err != nil {
+		return err
+	}
+
+	existing := !t.started
+	t.started = true
+	if newest == "" {
+		return nil
+	}
+
+	if newest != t.path {
+		if t.path != "" {
+			if err := t.read(false); err != nil {
+				return err
+			}
+			t.flush(false)
+		}
+		t.path = newest
+		t.offset = 0
+		t.partial = nil
+	}
+
+	return t.read(existing)
+}
+
+func (t *Tailer) read(existing bool) error {
+	file, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < t.offset {
+		t.offset = 0
+		t.partial = nil
+	}
+
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	t.offset += int64(len(data))
+
+	data = append(t.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		t.partial = data
+		return nil
+	}
+	t.partial = append([]byte(nil), data[end+1:]...)
+
+	for _, line := range strings.Split(string(data[:end]), "\n") {
+		t.Line(line, existing)
+	}
+	return nil
+}
+
+// flush hands over a last line that was not terminated by a newline
+func (t *Tailer) flush(existing bool) {
+	if len(t.partial) > 0 {
+		t.Line(string(t.partial), existing)
+		t.partial = nil
+	}
+}
+
+func (t *Tailer) newest() (string, error) {
+	var newest string
+	var newestTime time.Time
+
+	err := filepath.Walk(t.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.EqualFold(filepath.Ext(path), ".log") {
+			return nil
+		}
+		if newest == "" || info.ModTime().After(newestTime) || (info.ModTime().Equal(newestTime) && path > newest) {
+			newest = path
+			newestTime = info.ModTime()
+		}
+		return nil
+	})
+	return newest, err
+}
@@ -0,0 +1,106 @@
+package metrics_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/metrics"
+)
+
+var _ = Describe("Tailer", func() {
+	type line struct {
+		text     string
+		existing bool
+	}
+
+	var (
+		dir    string
+		lines  []line
+		tailer *metrics.Tailer
+	)
+
+	appendTo := func(name, data string) {
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = file.WriteString(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(file.Close()).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		dir = filepath.Join(GinkgoT().TempDir(), "W3SVC8080")
+		Expect(os.MkdirAll(dir, 0700)).To(Succeed())
+		lines = nil
+		tailer = metrics.NewTailer(filepath.Dir(dir), func(text string, existing bool) {
+			lines = append(lines, line{text, existing})
+		})
+	})
+
+	It("waits for the log to be created", func() {
+		Expect(tailer.Poll()).To(Succeed())
+		Expect(lines).To(BeEmpty())
+
+		appendTo("u_ex261019.log", "#Fields: sc-status\r\n200\r\n")
+		Expect(tailer.Poll()).To(Succeed())
+		Expect(lines).To(Equal([]line{{"#Fields: sc-status\r", false}, {"200\r", false}}))
+	})
+
+	It("marks lines logged before it started as existing", func() {
+		appendTo("u_ex261019.log", "#Fields: sc-status\n200\n")
+		Expect(tailer.Poll()).To(Succeed())
+		appendTo("u_ex261019.log", "404\n")
+		Expect(tailer.Poll()).To(Succeed())
+
+		Expect(lines).To(Equal([]line{{"#Fields: sc-status", true}, {"200", true}, {"404", false}}))
+	})
+
+	It("holds back a line until it is complete", func() {
+		Expect(tailer.Poll()).To(Succeed())
+		appendTo("u_ex261019.log", "20")
+		Expect(tailer.Poll()).To(Succeed())
+		Expect(lines).To(BeEmpty())
+
+		appendTo("u_ex261019.log", "0\n")
+		Expect(tailer.Poll()).To(Succeed())
+		Expect(lines).To(Equal([]line{{"200", false}}))
+	})
+
+	It("finishes the old log before moving to a new one", func() {
+		Expect(tailer.Poll()).To(Succeed())
+		appendTo("u_ex261019.log", "200\n")
+		Expect(tailer.Poll()).To(Succeed())
+
+		appendTo("u_ex261019.log", "201\n202")
+		yesterday := time.Now().Add(-time.Hour)
+		Expect(os.Chtimes(filepath.Join(dir, "u_ex261019.log"), yesterday, yesterday)).To(Succeed())
+		appendTo("u_ex261020.log", "#Fields: sc-status\n203\n")
+		Expect(tailer.Poll()).To(Succeed())
+
+		Expect(lines).To(Equal([]line{
+			{"200", false}, {"201", false}, {"202", false},
+			{"#Fields: sc-status", false}, {"203", false},
+		}))
+	})
+
+	It("starts over when the log is truncated", func() {
+		Expect(tailer.Poll()).To(Succeed())
+		appendTo("u_ex261019.log", "200\n201\n")
+		Expect(tailer.Poll()).To(Succeed())
+
+		Expect(os.WriteFile(filepath.Join(dir, "u_ex261019.log"), []byte("500\n"), 0600)).To(Succeed())
+		Expect(tailer.Poll()).To(Succeed())
+		Expect(lines).To(Equal([]line{{"200", false}, {"201", false}, {"500", false}}))
+	})
+
+	It("ignores files that are not logs", func() {
+		appendTo("notes.txt", "200\n")
+		Expect(tailer.Poll()).To(Succeed())
+		appendTo("notes.txt", "201\n")
+		Expect(tailer.Poll()).To(Succeed())
+		Expect(lines).To(BeEmpty())
+	})
+})
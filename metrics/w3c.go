@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is a request read from a W3C extended log
+type Entry struct {
+	Method    string
+	Path      string
+	Status    int
+	TimeTaken time.Duration
+}
+
+// defaultFields are the fields IIS logs by default, used until a #Fields
+// directive says otherwise
+var defaultFields = []string{
+	"date", "time", "s-ip", "cs-method", "cs-uri-stem", "cs-uri-query", "s-port", "cs-username",
+	"c-ip", "cs(User-Agent)", "cs(Referer)", "sc-status", "sc-substatus", "sc-win32-status", "time-taken",
+}
+
+// Parser parses the lines of a W3C extended log. It follows #Fields
+// directives, which may change the layout part way through a file.
+type Parser struct {
+	fields []string
+}
+
+func NewParser() *Parser {
+	return &Parser{fields: defaultFields}
+}
+
+// Parse parses a single line. Directives and blank lines return false.
+func (p *Parser) Parse(line string) (Entry, bool, error) {
+	line = strings.TrimRight(strings.TrimPrefix(line, "\ufeff"), "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return Entry{}, false, nil
+	}
+
+	if strings.HasPrefix(line, "#") {
+		if fields, ok := strings.CutPrefix(line, "#Fields:"); ok {
+			p.fields = strings.Fields(fields)
+		}
+		return Entry{}, false, nil
+	}
+
+	values := strings.Fields(line)
+	if len(values) != len(p.fields) {
+		return Entry{}, false, fmt.Errorf("expected %d fields, got %d", len(p.fields), len(values))
+	}
+
+	entry := Entry{}
+	hasStatus := false
+	for i, field := range p.fields {
+		value := values[i]
+		switch field {
+		case "cs-method":
+			entry.Method = value
+		case "cs-uri-stem":
+			entry.Path = value
+		case "sc-status":
+			status, err := strconv.Atoi(value)
+			if err != nil {
+				return Entry{}, false, fmt.Errorf("invalid sc-status %q", value)
+			}
+			entry.Status = status
+			hasStatus = true
+		case "time-taken":
+			if value == "-" {
+				continue
+			}
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Entry{}, false, fmt.Errorf("invalid time-taken %q", value)
+			}
+			entry.TimeTaken = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	if !hasStatus {
+		return Entry{}, false, fmt.Errorf("log has no sc-status field")
+	}
+	return entry, true, nil
+}
@@ -0,0 +1,63 @@
+package metrics_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/metrics"
+)
+
+var _ = Describe("Parser", func() {
+	var parser *metrics.Parser
+
+	BeforeEach(func() {
+		parser = metrics.NewParser()
+	})
+
+	It("parses lines in the default IIS layout", func() {
+		entry, ok, err := parser.Parse("2026-10-19 08:00:02 127.0.0.1 POST /api/orders - 8080 - 10.0.0.4 Mozilla/5.0+(Windows+NT+10.0) - 500 0 0 1200\r\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(entry).To(Equal(metrics.Entry{Method: "POST", Path: "/api/orders", Status: 500, TimeTaken: 1200 * time.Millisecond}))
+	})
+
+	It("follows #Fields directives", func() {
+		_, ok, err := parser.Parse("#Fields: sc-status cs-uri-stem")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+
+		entry, ok, err := parser.Parse("404 /missing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(entry).To(Equal(metrics.Entry{Path: "/missing", Status: 404}))
+	})
+
+	It("skips other directives, blank lines and a byte order mark", func() {
+		for _, line := range []string{"\ufeff#Software: Microsoft Internet Information Services 10.0", "#Version: 1.0", "", "\r"} {
+			_, ok, err := parser.Parse(line)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		}
+	})
+
+	It("returns an error when the number of fields is wrong", func() {
+		_, _, err := parser.Parse("2026-10-19 08:00:02 GET /")
+		Expect(err).To(MatchError("expected 15 fields, got 4"))
+	})
+
+	It("returns an error for an invalid status or time taken", func() {
+		parser.Parse("#Fields: sc-status time-taken")
+		_, _, err := parser.Parse("OK 12")
+		Expect(err).To(MatchError(`invalid sc-status "OK"`))
+		_, _, err = parser.Parse("200 fast")
+		Expect(err).To(MatchError(`invalid time-taken "fast"`))
+	})
+
+	It("returns an error when the log has no status", func() {
+		parser.Parse("#Fields: cs-uri-stem time-taken")
+		_, _, err := parser.Parse("/ 12")
+		Expect(err).To(MatchError("log has no sc-status field"))
+	})
+})
@@ -0,0 +1,171 @@
+package nativemodule
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChecksumSuffix is the extension of sidecar files that pin the SHA-256 of
+// the module they sit next to, e.g. mymodule.dll.sha256
+const ChecksumSuffix = ".sha256"
+
+// Manifest maps absolute module paths to their pinned SHA-256 digests
+type Manifest map[string]string
+
+// Lookup returns the digest pinned for the module at path. Paths are compared
+// as absolute, cleaned paths and, as on Windows, case-insensitively.
+func (m Manifest) Lookup(path string) (string, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	for modulePath, digest := range m {
+		if strings.EqualFold(filepath.Clean(modulePath), absPath) {
+			return digest, true
+		}
+	}
+	return "", false
+}
+
+// LoadManifest reads a manifest in the format produced by sha256sum. Relative
+// paths are resolved against the directory containing the manifest.
+func LoadManifest(path string) (Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	manifestDir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	manifest := Manifest{}
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// the path is everything after the first run of whitespace, so it
+		// may itself contain spaces, e.g. C:\Program Files\...
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: expected \"<sha256> <path>\"", path, lineNumber)
+		}
+
+		digest, err := parseDigest(line[:i])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+
+		modulePath := filepath.FromSlash(strings.TrimPrefix(strings.TrimLeft(line[i:], " \t"), "*"))
+		if !filepath.IsAbs(modulePath) {
+			modulePath = filepath.Join(manifestDir, modulePath)
+		}
+		manifest[filepath.Clean(modulePath)] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// IsChecksumFile reports whether name is a sidecar checksum file rather than
+// a module image
+func IsChecksumFile(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ChecksumSuffix)
+}
+
+// VerifyChecksum compares the SHA-256 of the module at path against the
+// digest pinned for it. A non-nil manifest requires every module to be listed
+// in it; a sidecar checksum file, when present, must match as well.
+func VerifyChecksum(path string, manifest Manifest) error {
+	var pinned []string
+
+	if manifest != nil {
+		digest, ok := manifest.Lookup(path)
+		if !ok {
+			return fmt.Errorf("HWC refusing to load native module %s: it is not listed in the checksum manifest", path)
+		}
+		pinned = append(pinned, digest)
+	}
+
+	sidecar, err := readSidecar(path + ChecksumSuffix)
+	if err != nil {
+		return err
+	}
+	if sidecar != "" {
+		pinned = append(pinned, sidecar)
+	}
+
+	if len(pinned) == 0 {
+		return nil
+	}
+
+	actual, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+
+	for _, digest := range pinned {
+		if digest != actual {
+			return fmt.Errorf("HWC refusing to load native module %s: SHA-256 %s does not match pinned checksum %s", path, actual, digest)
+		}
+	}
+	return nil
+}
+
+func readSidecar(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s: checksum file is empty", path)
+	}
+
+	digest, err := parseDigest(fields[0])
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	return digest, nil
+}
+
+func parseDigest(digest string) (string, error) {
+	digest = strings.ToLower(digest)
+	decoded, err := hex.DecodeString(digest)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 digest %q", digest)
+	}
+	return digest, nil
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
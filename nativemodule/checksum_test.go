@@ -0,0 +1,131 @@
+package nativemodule_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/nativemodule"
+)
+
+var _ = Describe("Checksum", func() {
+	const otherDigest = "0000000000000000000000000000000000000000000000000000000000000000"
+
+	var (
+		tmpDir     string
+		modulePath string
+		digest     string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "nativemodule")
+		Expect(err).ToNot(HaveOccurred())
+
+		modulePath = filepath.Join(tmpDir, "SomeModule", "module.dll")
+		Expect(os.MkdirAll(filepath.Dir(modulePath), 0777)).To(Succeed())
+		Expect(os.WriteFile(modulePath, []byte("module contents"), 0666)).To(Succeed())
+
+		digest = sha256Of(modulePath)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Describe("IsChecksumFile", func() {
+		It("recognizes sidecar checksum files", func() {
+			Expect(nativemodule.IsChecksumFile("module.dll.sha256")).To(BeTrue())
+			Expect(nativemodule.IsChecksumFile("module.dll.SHA256")).To(BeTrue())
+			Expect(nativemodule.IsChecksumFile("module.dll")).To(BeFalse())
+		})
+	})
+
+	Describe("LoadManifest", func() {
+		It("resolves relative paths against the manifest directory", func() {
+			manifestPath := filepath.Join(tmpDir, "SHA256SUMS")
+			contents := "# pinned modules\n\n" + strings.ToUpper(digest) + "  SomeModule/module.dll\n" + otherDigest + " */abs/other.dll\n"
+			Expect(os.WriteFile(manifestPath, []byte(contents), 0666)).To(Succeed())
+
+			manifest, err := nativemodule.LoadManifest(manifestPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest).To(HaveKeyWithValue(modulePath, digest))
+			Expect(manifest).To(HaveKeyWithValue(filepath.FromSlash("/abs/other.dll"), otherDigest))
+		})
+
+		It("accepts paths containing spaces", func() {
+			spacedPath := filepath.Join(tmpDir, "Program Files", "Some Module", "module.dll")
+			manifestPath := filepath.Join(tmpDir, "SHA256SUMS")
+			Expect(os.WriteFile(manifestPath, []byte(digest+"  *Program Files/Some Module/module.dll\n"), 0666)).To(Succeed())
+
+			manifest, err := nativemodule.LoadManifest(manifestPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest).To(HaveKeyWithValue(spacedPath, digest))
+		})
+
+		It("reports malformed lines", func() {
+			manifestPath := filepath.Join(tmpDir, "SHA256SUMS")
+			Expect(os.WriteFile(manifestPath, []byte("abc SomeModule/module.dll\n"), 0666)).To(Succeed())
+
+			_, err := nativemodule.LoadManifest(manifestPath)
+			Expect(err).To(MatchError(manifestPath + `:1: invalid SHA-256 digest "abc"`))
+		})
+	})
+
+	Describe("VerifyChecksum", func() {
+		It("succeeds when nothing is pinned", func() {
+			Expect(nativemodule.VerifyChecksum(modulePath, nil)).To(Succeed())
+		})
+
+		It("succeeds when the sidecar checksum matches", func() {
+			Expect(os.WriteFile(modulePath+".sha256", []byte(digest+"  module.dll\n"), 0666)).To(Succeed())
+			Expect(nativemodule.VerifyChecksum(modulePath, nil)).To(Succeed())
+		})
+
+		It("refuses a module whose sidecar checksum does not match", func() {
+			Expect(os.WriteFile(modulePath+".sha256", []byte(otherDigest), 0666)).To(Succeed())
+			err := nativemodule.VerifyChecksum(modulePath, nil)
+			Expect(err).To(MatchError("HWC refusing to load native module " + modulePath + ": SHA-256 " + digest + " does not match pinned checksum " + otherDigest))
+		})
+
+		It("succeeds when the manifest checksum matches", func() {
+			Expect(nativemodule.VerifyChecksum(modulePath, nativemodule.Manifest{modulePath: digest})).To(Succeed())
+		})
+
+		It("matches manifest paths case-insensitively", func() {
+			manifest := nativemodule.Manifest{strings.ToUpper(modulePath): digest}
+			Expect(nativemodule.VerifyChecksum(modulePath, manifest)).To(Succeed())
+		})
+
+		It("matches a relative module path against its absolute manifest entry", func() {
+			cwd, err := os.Getwd()
+			Expect(err).ToNot(HaveOccurred())
+			relativePath, err := filepath.Rel(cwd, modulePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(nativemodule.VerifyChecksum(relativePath, nativemodule.Manifest{modulePath: digest})).To(Succeed())
+		})
+
+		It("refuses a module whose manifest checksum does not match", func() {
+			err := nativemodule.VerifyChecksum(modulePath, nativemodule.Manifest{modulePath: otherDigest})
+			Expect(err).To(MatchError(ContainSubstring("does not match pinned checksum " + otherDigest)))
+		})
+
+		It("refuses a module missing from the manifest", func() {
+			err := nativemodule.VerifyChecksum(modulePath, nativemodule.Manifest{})
+			Expect(err).To(MatchError("HWC refusing to load native module " + modulePath + ": it is not listed in the checksum manifest"))
+		})
+	})
+})
+
+func sha256Of(path string) string {
+	contents, err := os.ReadFile(path)
+	Expect(err).ToNot(HaveOccurred())
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package nativemodule
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotPEImage is returned by CheckImage when a file does not carry a
+// valid DOS/PE header and therefore cannot be a native module.
+var ErrNotPEImage = errors.New("not a PE image")
+
+// Machine returns the PE machine type that a native module must be built for
+// in order to be loaded into a process of the given GOARCH.
+func Machine(goarch string) (uint16, error) {
+	switch goarch {
+	case "386":
+		return pe.IMAGE_FILE_MACHINE_I386, nil
+	case "amd64":
+		return pe.IMAGE_FILE_MACHINE_AMD64, nil
+	case "arm64":
+		return pe.IMAGE_FILE_MACHINE_ARM64, nil
+	}
+	return 0, fmt.Errorf("no PE machine type known for architecture %s", goarch)
+}
+
+// CheckImage verifies that the file at path is a PE image built for the
+// given machine type. Files without PE headers produce an error wrapping
+// ErrNotPEImage.
+func CheckImage(path string, machine uint16) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	imageMachine, err := readMachine(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if imageMachine != machine {
+		return fmt.Errorf("%s: built for machine type %s, expected %s", path, machineName(imageMachine), machineName(machine))
+	}
+	return nil
+}
+
+func readMachine(r io.ReaderAt) (uint16, error) {
+	var dosHeader [64]byte
+	if _, err := r.ReadAt(dosHeader[:], 0); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, ErrNotPEImage
+		}
+		return 0, err
+	}
+	if dosHeader[0] != 'M' || dosHeader[1] != 'Z' {
+		return 0, ErrNotPEImage
+	}
+
+	// e_lfanew holds the offset of the PE signature followed by the COFF header
+	peOffset := int64(binary.LittleEndian.Uint32(dosHeader[0x3c:]))
+	var peHeader [6]byte
+	if _, err := r.ReadAt(peHeader[:], peOffset); err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, ErrNotPEImage
+		}
+		return 0, err
+	}
+	if string(peHeader[:4]) != "PE\x00\x00" {
+		return 0, ErrNotPEImage
+	}
+
+	return binary.LittleEndian.Uint16(peHeader[4:]), nil
+}
+
+func machineName(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "x86"
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "x64"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "arm"
+	}
+	return fmt.Sprintf("0x%04x", machine)
+}
@@ -0,0 +1,13 @@
+package nativemodule_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestNativemodule(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Nativemodule Suite")
+}
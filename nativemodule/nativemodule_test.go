@@ -0,0 +1,84 @@
+package nativemodule_test
+
+import (
+	"debug/pe"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/nativemodule"
+)
+
+var _ = Describe("Nativemodule", func() {
+	const (
+		x64Module = "../fixtures/aspnet-win32/dist/bin/lib/x64/VersionDll.dll"
+		x86Module = "../fixtures/aspnet-win32/dist/bin/lib/Win32/VersionDll.dll"
+		symbols   = "../fixtures/aspnet-win32/dist/bin/AspnetWebApp.pdb"
+	)
+
+	Describe("Machine", func() {
+		It("maps process architectures to PE machine types", func() {
+			Expect(nativemodule.Machine("amd64")).To(Equal(uint16(pe.IMAGE_FILE_MACHINE_AMD64)))
+			Expect(nativemodule.Machine("386")).To(Equal(uint16(pe.IMAGE_FILE_MACHINE_I386)))
+			Expect(nativemodule.Machine("arm64")).To(Equal(uint16(pe.IMAGE_FILE_MACHINE_ARM64)))
+		})
+
+		It("errors for unknown architectures", func() {
+			_, err := nativemodule.Machine("mips")
+			Expect(err).To(MatchError("no PE machine type known for architecture mips"))
+		})
+	})
+
+	Describe("CheckImage", func() {
+		It("accepts an image built for the expected machine", func() {
+			Expect(nativemodule.CheckImage(x64Module, pe.IMAGE_FILE_MACHINE_AMD64)).To(Succeed())
+			Expect(nativemodule.CheckImage(x86Module, pe.IMAGE_FILE_MACHINE_I386)).To(Succeed())
+		})
+
+		It("rejects an image built for another machine", func() {
+			err := nativemodule.CheckImage(x86Module, pe.IMAGE_FILE_MACHINE_AMD64)
+			Expect(err).To(MatchError(x86Module + ": built for machine type x86, expected x64"))
+			Expect(err).NotTo(MatchError(nativemodule.ErrNotPEImage))
+		})
+
+		Context("when the file is not a PE image", func() {
+			var tmpDir string
+
+			BeforeEach(func() {
+				var err error
+				tmpDir, err = os.MkdirTemp("", "nativemodule")
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(tmpDir)).To(Succeed())
+			})
+
+			It("rejects symbol files", func() {
+				Expect(nativemodule.CheckImage(symbols, pe.IMAGE_FILE_MACHINE_AMD64)).To(MatchError(nativemodule.ErrNotPEImage))
+			})
+
+			It("rejects empty files", func() {
+				path := filepath.Join(tmpDir, "empty.dll")
+				Expect(os.WriteFile(path, nil, 0666)).To(Succeed())
+				Expect(nativemodule.CheckImage(path, pe.IMAGE_FILE_MACHINE_AMD64)).To(MatchError(nativemodule.ErrNotPEImage))
+			})
+
+			It("rejects DOS executables without a PE signature", func() {
+				header := make([]byte, 128)
+				copy(header, "MZ")
+				header[0x3c] = 0x40
+				path := filepath.Join(tmpDir, "dos.dll")
+				Expect(os.WriteFile(path, header, 0666)).To(Succeed())
+				Expect(nativemodule.CheckImage(path, pe.IMAGE_FILE_MACHINE_AMD64)).To(MatchError(nativemodule.ErrNotPEImage))
+			})
+		})
+
+		It("returns an error when the file does not exist", func() {
+			err := nativemodule.CheckImage("some/file/that/does/not/exist.dll", pe.IMAGE_FILE_MACHINE_AMD64)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,60 @@
+package overlay
+
+import "strings"
+
+// ConnectionStringsSection summarizes the connectionStrings section of an
+// app's Web.config
+type ConnectionStringsSection struct {
+	// Added lists the names the app adds
+	Added []string
+	// Removed lists the names the app removes before adding its own
+	Removed []string
+	// Cleared is set when the app clears the inherited connection strings
+	Cleared bool
+}
+
+// Conflicts reports whether the app adds name without removing the one
+// inherited from the root Web.config, which .NET rejects as a duplicate entry
+func (s ConnectionStringsSection) Conflicts(name string) bool {
+	if s.Cleared || containsFold(s.Removed, name) {
+		return false
+	}
+	return containsFold(s.Added, name)
+}
+
+// ReadConnectionStrings reads the connectionStrings section of the Web.config
+// at path. A missing file yields an empty section.
+func ReadConnectionStrings(path string) (ConnectionStringsSection, error) {
+	var config struct {
+		ConnectionStrings struct {
+			Add []struct {
+				Name string `xml:"name,attr"`
+			} `xml:"add"`
+			Remove []struct {
+				Name string `xml:"name,attr"`
+			} `xml:"remove"`
+			Clear []struct{} `xml:"clear"`
+		} `xml:"connectionStrings"`
+	}
+	if err := readWebConfig(path, &config); err != nil {
+		return ConnectionStringsSection{}, err
+	}
+
+	section := ConnectionStringsSection{Cleared: len(config.ConnectionStrings.Clear) > 0}
+	for _, add := range config.ConnectionStrings.Add {
+		section.Added = append(section.Added, add.Name)
+	}
+	for _, remove := range config.ConnectionStrings.Remove {
+		section.Removed = append(section.Removed, remove.Name)
+	}
+	return section, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package overlay
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FromEnvironment returns an app setting for every variable in environ whose
+// name starts with prefix, keyed by the remainder of the name. The prefix is
+// matched case-insensitively, as Windows environment variable names are.
+func FromEnvironment(prefix string, environ []string) []AppSetting {
+	var settings []AppSetting
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || len(name) <= len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+			continue
+		}
+		settings = append(settings, AppSetting{Key: name[len(prefix):], Value: value})
+	}
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Key < settings[j].Key
+	})
+	return settings
+}
+
+// SetAppSettings adds settings to the overlay, replacing existing settings
+// with the same key
+func (o *Overlay) SetAppSettings(settings []AppSetting) {
+	for _, setting := range settings {
+		replaced := false
+		for i := range o.AppSettings {
+			if strings.EqualFold(o.AppSettings[i].Key, setting.Key) {
+				o.AppSettings[i] = setting
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			o.AppSettings = append(o.AppSettings, setting)
+		}
+	}
+}
+
+// AppSettingsSection summarizes the appSettings section of an app's
+// Web.config
+type AppSettingsSection struct {
+	// Keys lists the keys the app adds or removes
+	Keys []string
+	// Cleared is set when the app clears the inherited settings
+	Cleared bool
+}
+
+// Defines reports whether the app adds or removes key, hiding a setting
+// inherited from the root Web.config
+func (s AppSettingsSection) Defines(key string) bool {
+	if s.Cleared {
+		return true
+	}
+	for _, k := range s.Keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadAppSettings reads the appSettings section of the Web.config at path. A
+// missing file yields an empty section.
+func ReadAppSettings(path string) (AppSettingsSection, error) {
+	var config struct {
+		AppSettings struct {
+			Add []struct {
+				Key string `xml:"key,attr"`
+			} `xml:"add"`
+			Remove []struct {
+				Key string `xml:"key,attr"`
+			} `xml:"remove"`
+			Clear []struct{} `xml:"clear"`
+		} `xml:"appSettings"`
+	}
+	if err := readWebConfig(path, &config); err != nil {
+		return AppSettingsSection{}, err
+	}
+
+	section := AppSettingsSection{Cleared: len(config.AppSettings.Clear) > 0}
+	for _, add := range config.AppSettings.Add {
+		section.Keys = append(section.Keys, add.Key)
+	}
+	for _, remove := range config.AppSettings.Remove {
+		section.Keys = append(section.Keys, remove.Key)
+	}
+	return section, nil
+}
+
+// readWebConfig decodes the Web.config at path into v, leaving v untouched
+// when the file is missing
+func readWebConfig(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder.Decode(v)
+}
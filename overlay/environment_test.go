@@ -0,0 +1,135 @@
+package overlay_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/overlay"
+)
+
+var _ = Describe("FromEnvironment", func() {
+	It("returns the prefixed variables sorted by key", func() {
+		settings := overlay.FromEnvironment("APPSETTING_", []string{
+			"PATH=C:\\Windows",
+			"APPSETTING_Zeta=last",
+			"appsetting_Alpha=a=b",
+			"APPSETTING_=empty",
+		})
+		Expect(settings).To(Equal([]overlay.AppSetting{
+			{Key: "Alpha", Value: "a=b"},
+			{Key: "Zeta", Value: "last"},
+		}))
+	})
+})
+
+var _ = Describe("SetAppSettings", func() {
+	It("replaces settings with the same key and appends new ones", func() {
+		o := overlay.Overlay{AppSettings: []overlay.AppSetting{{Key: "Url", Value: "from-service"}}}
+		o.SetAppSettings([]overlay.AppSetting{{Key: "url", Value: "from-env"}, {Key: "Mode", Value: "fast"}})
+		Expect(o.AppSettings).To(Equal([]overlay.AppSetting{
+			{Key: "url", Value: "from-env"},
+			{Key: "Mode", Value: "fast"},
+		}))
+	})
+})
+
+var _ = Describe("ReadAppSettings", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "overlay")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	write := func(contents string) string {
+		path := filepath.Join(dir, "Web.config")
+		Expect(os.WriteFile(path, []byte(contents), 0666)).To(Succeed())
+		return path
+	}
+
+	It("returns the keys the app adds or removes", func() {
+		section, err := overlay.ReadAppSettings(write("\xef\xbb\xbf" + `<?xml version="1.0" encoding="utf-8"?>
+<configuration>
+  <appSettings>
+    <add key="Mode" value="slow" />
+    <remove key="Legacy" />
+  </appSettings>
+</configuration>`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(section.Cleared).To(BeFalse())
+		Expect(section.Defines("mode")).To(BeTrue())
+		Expect(section.Defines("Legacy")).To(BeTrue())
+		Expect(section.Defines("Other")).To(BeFalse())
+	})
+
+	It("treats every key as defined when the app clears appSettings", func() {
+		section, err := overlay.ReadAppSettings(write(`<configuration><appSettings><clear /></appSettings></configuration>`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(section.Defines("Anything")).To(BeTrue())
+	})
+
+	It("returns an empty section when there is no Web.config", func() {
+		section, err := overlay.ReadAppSettings(filepath.Join(dir, "Web.config"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(section.Defines("Anything")).To(BeFalse())
+	})
+
+	It("fails on malformed XML", func() {
+		_, err := overlay.ReadAppSettings(write(`<configuration><appSettings>`))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("ReadConnectionStrings", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "overlay")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	write := func(contents string) string {
+		path := filepath.Join(dir, "Web.config")
+		Expect(os.WriteFile(path, []byte(contents), 0666)).To(Succeed())
+		return path
+	}
+
+	It("reports names the app adds without removing them first", func() {
+		section, err := overlay.ReadConnectionStrings(write(`<configuration>
+  <connectionStrings>
+    <add name="Orders" connectionString="Server=local" />
+    <remove name="Catalog" />
+    <add name="Catalog" connectionString="Server=local" />
+  </connectionStrings>
+</configuration>`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(section.Conflicts("orders")).To(BeTrue())
+		Expect(section.Conflicts("Catalog")).To(BeFalse())
+		Expect(section.Conflicts("Other")).To(BeFalse())
+	})
+
+	It("reports no conflicts when the app clears connectionStrings", func() {
+		section, err := overlay.ReadConnectionStrings(write(`<configuration><connectionStrings><clear /><add name="Orders" connectionString="x" /></connectionStrings></configuration>`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(section.Conflicts("Orders")).To(BeFalse())
+	})
+
+	It("returns an empty section when there is no Web.config", func() {
+		section, err := overlay.ReadConnectionStrings(filepath.Join(dir, "Web.config"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(section.Conflicts("Orders")).To(BeFalse())
+	})
+})
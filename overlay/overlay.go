@@ -0,0 +1,23 @@
+package overlay
+
+// ConnectionString is rendered as an <add> element of <connectionStrings>
+// in the generated root Web.config
+type ConnectionString struct {
+	Name             string
+	ConnectionString string
+	ProviderName     string
+}
+
+// AppSetting is rendered as an <add> element of <appSettings> in the
+// generated root Web.config
+type AppSetting struct {
+	Key   string
+	Value string
+}
+
+// Overlay holds the settings hwc injects into the generated root Web.config
+// so that apps pick them up through ConfigurationManager
+type Overlay struct {
+	ConnectionStrings []ConnectionString
+	AppSettings       []AppSetting
+}
@@ -0,0 +1,267 @@
+package overlay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/cloudfoundry-community/go-cfenv"
+)
+
+// Mapping describes how a bound service is turned into a connection string
+// and app settings. ConnectionString and AppSettings values are text/template
+// strings evaluated against the service credentials, e.g. {{.hostname}}.
+type Mapping struct {
+	// Service matches the name of a service instance
+	Service string `json:"service"`
+	// Tag matches a tag or the label of a service instance
+	Tag string `json:"tag"`
+
+	ConnectionStringName string            `json:"connectionStringName"`
+	ProviderName         string            `json:"providerName"`
+	ConnectionString     string            `json:"connectionString"`
+	AppSettings          map[string]string `json:"appSettings"`
+}
+
+// defaultMappings are used for services that no user mapping matches
+var defaultMappings = []struct {
+	tags         []string
+	providerName string
+	build        func(credentials) string
+}{
+	{
+		tags:         []string{"sqlserver", "mssql", "mssql-server"},
+		providerName: "System.Data.SqlClient",
+		build: func(c credentials) string {
+			server := c.lookup("hostname", "host")
+			if port := c.lookup("port"); port != "" {
+				server += "," + port
+			}
+			return connectionString(
+				"Server", server,
+				"Database", c.lookup("name", "database", "db"),
+				"User Id", c.lookup("username", "user"),
+				"Password", c.lookup("password"),
+			)
+		},
+	},
+	{
+		tags:         []string{"mysql"},
+		providerName: "MySql.Data.MySqlClient",
+		build: func(c credentials) string {
+			return connectionString(
+				"Server", c.lookup("hostname", "host"),
+				"Port", c.lookup("port"),
+				"Database", c.lookup("name", "database", "db"),
+				"Uid", c.lookup("username", "user"),
+				"Pwd", c.lookup("password"),
+			)
+		},
+	},
+	{
+		tags:         []string{"postgres", "postgresql", "elephantsql"},
+		providerName: "Npgsql",
+		build: func(c credentials) string {
+			return connectionString(
+				"Host", c.lookup("hostname", "host"),
+				"Port", c.lookup("port"),
+				"Database", c.lookup("name", "database", "db"),
+				"Username", c.lookup("username", "user"),
+				"Password", c.lookup("password"),
+			)
+		},
+	},
+}
+
+// LoadMappings reads a JSON array of mappings from path
+func LoadMappings(path string) ([]Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []Mapping
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for i, m := range mappings {
+		if (m.Service == "") == (m.Tag == "") {
+			return nil, fmt.Errorf("%s: mapping %d must set exactly one of service or tag", path, i)
+		}
+	}
+	return mappings, nil
+}
+
+// FromServices builds the connection strings and app settings for the bound
+// services. Services matched by a user mapping use it; other services fall
+// back to the built-in mappings for their tags or label, and services that
+// match nothing are skipped.
+func FromServices(services cfenv.Services, mappings []Mapping) (Overlay, error) {
+	var overlay Overlay
+
+	for _, service := range sortedServices(services) {
+		creds := credentials(service.Credentials)
+
+		if mapping, ok := findMapping(service, mappings); ok {
+			if err := overlay.applyMapping(service, creds, mapping); err != nil {
+				return Overlay{}, err
+			}
+			continue
+		}
+
+		if connStr, ok := creds["connectionString"].(string); ok && connStr != "" {
+			overlay.ConnectionStrings = append(overlay.ConnectionStrings, ConnectionString{
+				Name:             service.Name,
+				ConnectionString: connStr,
+			})
+			continue
+		}
+
+		for _, d := range defaultMappings {
+			if hasTag(service, d.tags...) {
+				overlay.ConnectionStrings = append(overlay.ConnectionStrings, ConnectionString{
+					Name:             service.Name,
+					ConnectionString: d.build(creds),
+					ProviderName:     d.providerName,
+				})
+				break
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, cs := range overlay.ConnectionStrings {
+		if seen[strings.ToLower(cs.Name)] {
+			return Overlay{}, fmt.Errorf("more than one bound service produces connection string %s, set connectionStringName in HWC_SERVICE_MAPPINGS to tell them apart", cs.Name)
+		}
+		seen[strings.ToLower(cs.Name)] = true
+	}
+
+	return overlay, nil
+}
+
+func (o *Overlay) applyMapping(service cfenv.Service, creds credentials, mapping Mapping) error {
+	if mapping.ConnectionString != "" {
+		connStr, err := render(service.Name, mapping.ConnectionString, creds)
+		if err != nil {
+			return err
+		}
+
+		name := mapping.ConnectionStringName
+		if name == "" {
+			name = service.Name
+		}
+		o.ConnectionStrings = append(o.ConnectionStrings, ConnectionString{
+			Name:             name,
+			ConnectionString: connStr,
+			ProviderName:     mapping.ProviderName,
+		})
+	}
+
+	keys := make([]string, 0, len(mapping.AppSettings))
+	for key := range mapping.AppSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, err := render(service.Name, mapping.AppSettings[key], creds)
+		if err != nil {
+			return err
+		}
+		o.AppSettings = append(o.AppSettings, AppSetting{Key: key, Value: value})
+	}
+	return nil
+}
+
+func findMapping(service cfenv.Service, mappings []Mapping) (Mapping, bool) {
+	for _, m := range mappings {
+		if m.Service != "" && m.Service == service.Name {
+			return m, true
+		}
+	}
+	for _, m := range mappings {
+		if m.Tag != "" && hasTag(service, m.Tag) {
+			return m, true
+		}
+	}
+	return Mapping{}, false
+}
+
+func hasTag(service cfenv.Service, tags ...string) bool {
+	for _, tag := range tags {
+		if strings.EqualFold(service.Label, tag) {
+			return true
+		}
+		for _, t := range service.Tags {
+			if strings.EqualFold(t, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sortedServices(services cfenv.Services) []cfenv.Service {
+	labels := make([]string, 0, len(services))
+	for label := range services {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	var sorted []cfenv.Service
+	for _, label := range labels {
+		sorted = append(sorted, services[label]...)
+	}
+	return sorted
+}
+
+func render(serviceName, text string, creds credentials) (string, error) {
+	tmpl, err := template.New(serviceName).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("mapping for service %s: %v", serviceName, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]interface{}(creds)); err != nil {
+		return "", fmt.Errorf("mapping for service %s: %v", serviceName, err)
+	}
+	return buf.String(), nil
+}
+
+type credentials map[string]interface{}
+
+// lookup returns the first of keys present in the credentials
+func (c credentials) lookup(keys ...string) string {
+	for _, key := range keys {
+		if value, ok := c[key]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// connectionString joins key/value pairs, skipping empty values and quoting
+// values that contain separators
+func connectionString(pairs ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			continue
+		}
+		parts = append(parts, pairs[i]+"="+quoteValue(pairs[i+1]))
+	}
+	return strings.Join(parts, ";") + ";"
+}
+
+func quoteValue(value string) string {
+	if !strings.ContainsAny(value, ";'\"") && strings.TrimSpace(value) == value {
+		return value
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
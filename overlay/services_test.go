@@ -0,0 +1,208 @@
+package overlay_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/overlay"
+	"github.com/cloudfoundry-community/go-cfenv"
+)
+
+const vcapServices = `{
+  "user-provided": [
+    {
+      "name": "legacy-db",
+      "label": "user-provided",
+      "tags": [],
+      "credentials": {
+        "connectionString": "Server=legacy;Database=app;Integrated Security=true"
+      }
+    },
+    {
+      "name": "payments-api",
+      "label": "user-provided",
+      "tags": ["payments"],
+      "credentials": {
+        "url": "https://payments.example.com",
+        "apiKey": "s3cr3t"
+      }
+    }
+  ],
+  "csb-azure-mssql": [
+    {
+      "name": "orders-db",
+      "label": "csb-azure-mssql",
+      "tags": ["mssql", "sqlserver"],
+      "credentials": {
+        "hostname": "orders.database.windows.net",
+        "port": 1433,
+        "name": "orders",
+        "username": "orders-user",
+        "password": "p;ss\"word"
+      }
+    }
+  ],
+  "p.mysql": [
+    {
+      "name": "catalog-db",
+      "label": "p.mysql",
+      "tags": ["mysql"],
+      "credentials": {
+        "hostname": "10.0.0.5",
+        "port": 3306,
+        "name": "catalog",
+        "username": "catalog-user",
+        "password": "catalog-pass"
+      }
+    }
+  ],
+  "redis": [
+    {
+      "name": "cache",
+      "label": "redis",
+      "tags": ["redis"],
+      "credentials": {
+        "host": "10.0.0.6"
+      }
+    }
+  ]
+}`
+
+var _ = Describe("FromServices", func() {
+	var services cfenv.Services
+
+	BeforeEach(func() {
+		appEnv, err := cfenv.New(map[string]string{
+			"VCAP_APPLICATION": "{}",
+			"VCAP_SERVICES":    vcapServices,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		services = appEnv.Services
+	})
+
+	Context("without user mappings", func() {
+		var result overlay.Overlay
+
+		BeforeEach(func() {
+			var err error
+			result, err = overlay.FromServices(services, nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("builds a SqlClient connection string for sqlserver services", func() {
+			Expect(result.ConnectionStrings).To(ContainElement(overlay.ConnectionString{
+				Name:             "orders-db",
+				ConnectionString: `Server=orders.database.windows.net,1433;Database=orders;User Id=orders-user;Password="p;ss""word";`,
+				ProviderName:     "System.Data.SqlClient",
+			}))
+		})
+
+		It("builds a MySQL connection string for mysql services", func() {
+			Expect(result.ConnectionStrings).To(ContainElement(overlay.ConnectionString{
+				Name:             "catalog-db",
+				ConnectionString: "Server=10.0.0.5;Port=3306;Database=catalog;Uid=catalog-user;Pwd=catalog-pass;",
+				ProviderName:     "MySql.Data.MySqlClient",
+			}))
+		})
+
+		It("uses a connectionString credential verbatim", func() {
+			Expect(result.ConnectionStrings).To(ContainElement(overlay.ConnectionString{
+				Name:             "legacy-db",
+				ConnectionString: "Server=legacy;Database=app;Integrated Security=true",
+			}))
+		})
+
+		It("skips services without a mapping", func() {
+			Expect(result.ConnectionStrings).To(HaveLen(3))
+			Expect(result.AppSettings).To(BeEmpty())
+		})
+
+		It("orders the connection strings by service label", func() {
+			Expect(result.ConnectionStrings[0].Name).To(Equal("orders-db"))
+			Expect(result.ConnectionStrings[1].Name).To(Equal("catalog-db"))
+			Expect(result.ConnectionStrings[2].Name).To(Equal("legacy-db"))
+		})
+	})
+
+	Context("with user mappings", func() {
+		It("renders connection strings and app settings from the credentials", func() {
+			result, err := overlay.FromServices(services, []overlay.Mapping{
+				{
+					Service:              "orders-db",
+					ConnectionStringName: "OrdersContext",
+					ProviderName:         "System.Data.SqlClient",
+					ConnectionString:     "Data Source={{.hostname}};Initial Catalog={{.name}}",
+				},
+				{
+					Tag: "payments",
+					AppSettings: map[string]string{
+						"Payments:Url":    "{{.url}}",
+						"Payments:ApiKey": "{{.apiKey}}",
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(result.ConnectionStrings).To(ContainElement(overlay.ConnectionString{
+				Name:             "OrdersContext",
+				ConnectionString: "Data Source=orders.database.windows.net;Initial Catalog=orders",
+				ProviderName:     "System.Data.SqlClient",
+			}))
+			Expect(result.AppSettings).To(Equal([]overlay.AppSetting{
+				{Key: "Payments:ApiKey", Value: "s3cr3t"},
+				{Key: "Payments:Url", Value: "https://payments.example.com"},
+			}))
+		})
+
+		It("errors when a template references a missing credential", func() {
+			_, err := overlay.FromServices(services, []overlay.Mapping{
+				{Service: "cache", ConnectionString: "{{.hostname}}"},
+			})
+			Expect(err).To(MatchError(ContainSubstring("mapping for service cache")))
+		})
+
+		It("errors when two services produce the same connection string name", func() {
+			_, err := overlay.FromServices(services, []overlay.Mapping{
+				{Service: "orders-db", ConnectionStringName: "Default", ConnectionString: "{{.hostname}}"},
+				{Service: "catalog-db", ConnectionStringName: "default", ConnectionString: "{{.hostname}}"},
+			})
+			Expect(err).To(MatchError(ContainSubstring("more than one bound service produces connection string")))
+		})
+	})
+})
+
+var _ = Describe("LoadMappings", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "overlay")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("reads mappings from a JSON file", func() {
+		path := filepath.Join(tmpDir, "mappings.json")
+		Expect(os.WriteFile(path, []byte(`[{"tag": "mssql", "connectionStringName": "Default", "connectionString": "{{.hostname}}"}]`), 0666)).To(Succeed())
+
+		mappings, err := overlay.LoadMappings(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mappings).To(Equal([]overlay.Mapping{
+			{Tag: "mssql", ConnectionStringName: "Default", ConnectionString: "{{.hostname}}"},
+		}))
+	})
+
+	It("rejects mappings without a service or tag", func() {
+		path := filepath.Join(tmpDir, "mappings.json")
+		Expect(os.WriteFile(path, []byte(`[{"connectionString": "{{.hostname}}"}]`), 0666)).To(Succeed())
+
+		_, err := overlay.LoadMappings(path)
+		Expect(err).To(MatchError(path + ": mapping 0 must set exactly one of service or tag"))
+	})
+})
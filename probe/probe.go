@@ -0,0 +1,118 @@
+// Package probe sends HTTP requests to the site hwc is serving, over
+// loopback, to find out whether it is actually serving requests.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is the outcome of a single probe
+type Result struct {
+	URL        string
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// Healthy reports whether the site answered without a server error. Client
+// errors such as 401 or 404 still show that the site is serving.
+func (r Result) Healthy() bool {
+	return r.Err == nil && r.StatusCode > 0 && r.StatusCode < 500
+}
+
+func (r Result) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%s: %v", r.URL, r.Err)
+	}
+	return fmt.Sprintf("%s returned %d in %s", r.URL, r.StatusCode, r.Duration.Round(time.Millisecond))
+}
+
+// Prober probes a single URL
+type Prober struct {
+	URL string
+	// Method defaults to GET
+	Method string
+	// Header is added to each request; a Host header sets the request host
+	Header  http.Header
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+func New(url string, timeout time.Duration) *Prober {
+	return &Prober{
+		URL:     url,
+		Timeout: timeout,
+		Client: &http.Client{
+			// a redirect, e.g. to a login page, already shows the site is up
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Probe sends a request to the URL and waits for the response status
+func (p *Prober) Probe(ctx context.Context) Result {
+	result := Result{URL: p.URL}
+
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.URL, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	req.Header.Set("User-Agent", "hwc-probe")
+	for name, values := range p.Header {
+		if http.CanonicalHeaderKey(name) == "Host" {
+			req.Host = values[0]
+			continue
+		}
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+
+	start := time.Now()
+	resp, err := p.Client.Do(req)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	result.StatusCode = resp.StatusCode
+	return result
+}
+
+// SiteURL returns the loopback URL of path in the site bound to bindAddress
+// and port. A wildcard bind address is reached through 127.0.0.1.
+func SiteURL(bindAddress string, port int, contextPath, path string) string {
+	host := strings.Trim(bindAddress, "[]")
+	if host == "" || host == "*" || host == "0.0.0.0" {
+		host = "127.0.0.1"
+	} else if host == "::" {
+		host = "::1"
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(port)) + strings.TrimSuffix(contextPath, "/") + path
+}
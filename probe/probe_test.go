@@ -0,0 +1,109 @@
+package probe_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/probe"
+)
+
+var _ = Describe("Prober", func() {
+	var (
+		site   *httptest.Server
+		status int
+		delay  time.Duration
+		agent  string
+		host   string
+		method string
+		custom string
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		delay = 0
+		site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			agent = r.UserAgent()
+			host = r.Host
+			method = r.Method
+			custom = r.Header.Get("X-Warmup")
+			time.Sleep(delay)
+			if status == http.StatusFound {
+				http.Redirect(w, r, "/login", status)
+				return
+			}
+			w.WriteHeader(status)
+		}))
+	})
+
+	AfterEach(func() {
+		site.Close()
+	})
+
+	It("reports the status of a serving site", func() {
+		result := probe.New(site.URL+"/", time.Second).Probe(context.Background())
+		Expect(result.Err).ToNot(HaveOccurred())
+		Expect(result.StatusCode).To(Equal(http.StatusOK))
+		Expect(result.Healthy()).To(BeTrue())
+		Expect(agent).To(Equal("hwc-probe"))
+	})
+
+	DescribeTable("healthiness by status",
+		func(code int, healthy bool) {
+			status = code
+			result := probe.New(site.URL+"/", time.Second).Probe(context.Background())
+			Expect(result.StatusCode).To(Equal(code))
+			Expect(result.Healthy()).To(Equal(healthy))
+		},
+		Entry("redirects are not followed", http.StatusFound, true),
+		Entry("unauthorized", http.StatusUnauthorized, true),
+		Entry("not found", http.StatusNotFound, true),
+		Entry("server error", http.StatusInternalServerError, false),
+		Entry("service unavailable", http.StatusServiceUnavailable, false),
+	)
+
+	It("sends the method and headers", func() {
+		p := probe.New(site.URL+"/", time.Second)
+		p.Method = http.MethodHead
+		p.Header = http.Header{"Host": {"app.example.com"}, "x-warmup": {"1"}}
+
+		result := p.Probe(context.Background())
+		Expect(result.Healthy()).To(BeTrue())
+		Expect(method).To(Equal(http.MethodHead))
+		Expect(host).To(Equal("app.example.com"))
+		Expect(custom).To(Equal("1"))
+	})
+
+	It("times out slow responses", func() {
+		delay = 200 * time.Millisecond
+		result := probe.New(site.URL+"/", 20*time.Millisecond).Probe(context.Background())
+		Expect(result.Err).To(HaveOccurred())
+		Expect(result.Healthy()).To(BeFalse())
+		Expect(result.String()).To(ContainSubstring(site.URL))
+	})
+
+	It("fails when nothing is listening", func() {
+		url := site.URL
+		site.Close()
+		result := probe.New(url, time.Second).Probe(context.Background())
+		Expect(result.Err).To(HaveOccurred())
+		Expect(result.Healthy()).To(BeFalse())
+	})
+})
+
+var _ = DescribeTable("SiteURL",
+	func(bindAddress, contextPath, path, expected string) {
+		Expect(probe.SiteURL(bindAddress, 8080, contextPath, path)).To(Equal(expected))
+	},
+	Entry("wildcard", "*", "/", "/", "http://127.0.0.1:8080/"),
+	Entry("empty", "", "/", "/health", "http://127.0.0.1:8080/health"),
+	Entry("IPv4 address", "10.0.0.5", "/", "/", "http://10.0.0.5:8080/"),
+	Entry("IPv6 wildcard", "::", "/", "/", "http://[::1]:8080/"),
+	Entry("IPv6 wildcard in brackets", "[::]", "/", "/", "http://[::1]:8080/"),
+	Entry("IPv6 address", "[fe80::1]", "/", "/", "http://[fe80::1]:8080/"),
+	Entry("context path", "*", "/app/", "status", "http://127.0.0.1:8080/app/status"),
+)
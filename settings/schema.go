@@ -0,0 +1,108 @@
+package settings
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindBool
+	kindInt
+	kindDuration
+	kindList
+	kindEnum
+)
+
+// Setting is a key of the settings file and the environment variable it
+// stands in for
+type Setting struct {
+	// Key is the dotted path of the setting in the file, e.g. webSockets.enabled
+	Key string
+	// Env is the environment variable the setting provides a value for
+	Env string
+
+	kind kind
+	// min and max bound kindInt settings
+	min, max int
+	// values are the allowed values of kindEnum settings
+	values []string
+	// separator joins the items of kindList settings
+	separator string
+}
+
+// Schema lists every setting the settings file accepts
+var Schema = []Setting{
+	{Key: "port", Env: "PORT", kind: kindInt, min: 1, max: 65535},
+	{Key: "bindAddress", Env: "HWC_BIND_ADDRESS", kind: kindList, separator: ","},
+	{Key: "virtualDirectories", Env: "HWC_VIRTUAL_DIRECTORIES", kind: kindList, separator: ","},
+	{Key: "nativeModules", Env: "HWC_NATIVE_MODULES", kind: kindList, separator: ";"},
+	{Key: "nativeModulesManifest", Env: "HWC_NATIVE_MODULES_MANIFEST", kind: kindString},
+	{Key: "disableOptionalModules", Env: "HWC_DISABLE_OPTIONAL_MODULES", kind: kindList, separator: ","},
+	{Key: "webSockets.enabled", Env: "HWC_WEBSOCKETS", kind: kindBool},
+	{Key: "webSockets.pingInterval", Env: "HWC_WEBSOCKET_PING_INTERVAL", kind: kindDuration},
+	{Key: "webSockets.receiveBufferLimit", Env: "HWC_WEBSOCKET_RECEIVE_BUFFER_LIMIT", kind: kindInt, min: 1, max: 1<<31 - 1},
+	{Key: "windowsAuth.providers", Env: "HWC_WINDOWS_AUTH", kind: kindString},
+	{Key: "windowsAuth.kernelMode", Env: "HWC_WINDOWS_AUTH_KERNEL_MODE", kind: kindBool},
+	{Key: "windowsAuth.extendedProtection", Env: "HWC_WINDOWS_AUTH_EXTENDED_PROTECTION", kind: kindEnum, values: []string{"none", "allow", "require"}},
+	{Key: "anonymousAuth.enabled", Env: "HWC_ANONYMOUS_AUTH", kind: kindBool},
+	{Key: "anonymousAuth.userName", Env: "HWC_ANONYMOUS_AUTH_USER", kind: kindString},
+	{Key: "ipSecurity.allow", Env: "HWC_IP_ALLOW", kind: kindList, separator: ","},
+	{Key: "ipSecurity.deny", Env: "HWC_IP_DENY", kind: kindList, separator: ","},
+	{Key: "ipSecurity.maxConcurrentRequests", Env: "HWC_IP_MAX_CONCURRENT_REQUESTS", kind: kindInt, min: 1, max: 1<<31 - 1},
+	{Key: "ipSecurity.maxRequests", Env: "HWC_IP_MAX_REQUESTS", kind: kindInt, min: 1, max: 1<<31 - 1},
+	{Key: "ipSecurity.requestInterval", Env: "HWC_IP_REQUEST_INTERVAL", kind: kindDuration},
+	{Key: "forwardedFor.enabled", Env: "HWC_FORWARDED_FOR", kind: kindBool},
+	{Key: "forwardedFor.trustedProxies", Env: "HWC_TRUSTED_PROXIES", kind: kindList, separator: ","},
+	{Key: "redirect.forceHttps", Env: "HWC_FORCE_HTTPS", kind: kindBool},
+	{Key: "redirect.canonicalHost", Env: "HWC_CANONICAL_HOST", kind: kindString},
+	{Key: "serviceMappings", Env: "HWC_SERVICE_MAPPINGS", kind: kindString},
+	{Key: "machineKey.validation", Env: "HWC_MACHINE_KEY_VALIDATION", kind: kindEnum, values: []string{"HMACSHA256", "HMACSHA384", "HMACSHA512"}},
+	{Key: "machineKey.decryption", Env: "HWC_MACHINE_KEY_DECRYPTION", kind: kindEnum, values: []string{"AES"}},
+	{Key: "machineKey.service", Env: "HWC_MACHINE_KEY_SERVICE", kind: kindString},
+	{Key: "appSettings.prefix", Env: "HWC_APPSETTINGS_PREFIX", kind: kindString},
+	{Key: "appSettings.conflicts", Env: "HWC_APPSETTINGS_CONFLICTS", kind: kindEnum, values: []string{"app", "error"}},
+	{Key: "webConfigTransform", Env: "HWC_WEB_CONFIG_TRANSFORM", kind: kindString},
+	{Key: "configTokens.enabled", Env: "HWC_CONFIG_TOKENS", kind: kindBool},
+	{Key: "configTokens.files", Env: "HWC_CONFIG_TOKEN_FILES", kind: kindList, separator: ";"},
+	{Key: "log.format", Env: "HWC_LOG_FORMAT", kind: kindEnum, values: []string{"text", "json"}},
+	{Key: "log.level", Env: "HWC_LOG_LEVEL", kind: kindEnum, values: []string{"debug", "info", "warn", "error"}},
+	{Key: "health.port", Env: "HWC_HEALTH_PORT", kind: kindInt, min: 1, max: 65535},
+	{Key: "health.path", Env: "HWC_HEALTH_CHECK_PATH", kind: kindString},
+	{Key: "health.timeout", Env: "HWC_HEALTH_CHECK_TIMEOUT", kind: kindDuration},
+	{Key: "warmup.paths", Env: "HWC_WARMUP_PATHS", kind: kindList, separator: ","},
+	{Key: "warmup.file", Env: "HWC_WARMUP_FILE", kind: kindString},
+	{Key: "warmup.attempts", Env: "HWC_WARMUP_ATTEMPTS", kind: kindInt, min: 1, max: 1000},
+	{Key: "warmup.interval", Env: "HWC_WARMUP_INTERVAL", kind: kindDuration},
+	{Key: "warmup.timeout", Env: "HWC_WARMUP_TIMEOUT", kind: kindDuration},
+	{Key: "warmup.failure", Env: "HWC_WARMUP_FAILURE", kind: kindEnum, values: []string{"continue", "exit"}},
+	{Key: "metrics.port", Env: "HWC_METRICS_PORT", kind: kindInt, min: 1, max: 65535},
+	{Key: "metrics.pathPrefixes", Env: "HWC_METRICS_PATH_PREFIXES", kind: kindList, separator: ","},
+	{Key: "watchdog.interval", Env: "HWC_WATCHDOG_INTERVAL", kind: kindDuration},
+	{Key: "watchdog.failures", Env: "HWC_WATCHDOG_FAILURES", kind: kindInt, min: 1, max: 1000},
+	{Key: "watchdog.path", Env: "HWC_WATCHDOG_PATH", kind: kindString},
+	{Key: "watchdog.timeout", Env: "HWC_WATCHDOG_TIMEOUT", kind: kindDuration},
+	{Key: "configWatch.mode", Env: "HWC_CONFIG_WATCH", kind: kindEnum, values: []string{"off", "log", "strict"}},
+	{Key: "configWatch.interval", Env: "HWC_CONFIG_WATCH_INTERVAL", kind: kindDuration},
+	{Key: "configWatch.debounce", Env: "HWC_CONFIG_WATCH_DEBOUNCE", kind: kindDuration},
+	{Key: "instance.name", Env: "HWC_INSTANCE_NAME", kind: kindString},
+	{Key: "instance.stable", Env: "HWC_STABLE_INSTANCE_NAME", kind: kindBool},
+	{Key: "temp.directory", Env: "HWC_TEMP_DIR", kind: kindString},
+	{Key: "temp.cleanup", Env: "HWC_TEMP_CLEANUP", kind: kindBool},
+}
+
+func lookupSetting(key string) (Setting, bool) {
+	for _, s := range Schema {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// isGroup reports whether key is a prefix of nested settings, e.g. webSockets
+func isGroup(key string) bool {
+	for _, s := range Schema {
+		if len(s.Key) > len(key) && s.Key[:len(key)] == key && s.Key[len(key)] == '.' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+// Package settings reads hwc settings from an hwc.yml or hwc.json file in the
+// app root. Each setting stands in for an environment variable, which takes
+// precedence over the file when it is set.
+package settings
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the names the settings file may have in the app root
+var FileNames = []string{"hwc.yml", "hwc.yaml", "hwc.json"}
+
+// File holds the settings read from a settings file
+type File struct {
+	Path string
+	// Values maps environment variable names to the values the file sets
+	// for them
+	Values map[string]string
+}
+
+// Load reads the settings file in rootPath. It returns nil when there is no
+// settings file and fails when there is more than one.
+func Load(rootPath string) (*File, error) {
+	var found []string
+	for _, name := range FileNames {
+		path := filepath.Join(rootPath, name)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+	default:
+		return nil, fmt.Errorf("Found more than one settings file: %s", strings.Join(found, ", "))
+	}
+
+	data, err := os.ReadFile(found[0])
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(found[0]), err)
+	}
+	return &File{Path: found[0], Values: values}, nil
+}
+
+// Parse validates a YAML or JSON settings document against Schema and
+// returns the environment variable values it sets
+func Parse(data []byte) (map[string]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	if len(doc.Content) == 0 {
+		return values, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: settings must be a mapping", root.Line)
+	}
+	if err := parseMapping(root, "", values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func parseMapping(mapping *yaml.Node, prefix string, values map[string]string) error {
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		key := prefix + keyNode.Value
+
+		if seen[key] {
+			return fmt.Errorf("line %d: duplicate key %s", keyNode.Line, key)
+		}
+		seen[key] = true
+
+		if setting, ok := lookupSetting(key); ok {
+			value, err := setting.parse(valueNode)
+			if err != nil {
+				return fmt.Errorf("line %d: %s: %v", valueNode.Line, key, err)
+			}
+			values[setting.Env] = value
+			continue
+		}
+
+		if isGroup(key) {
+			if valueNode.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: %s: must be a mapping", valueNode.Line, key)
+			}
+			if err := parseMapping(valueNode, key+".", values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		return fmt.Errorf("line %d: unknown key %s", keyNode.Line, key)
+	}
+	return nil
+}
+
+func (s Setting) parse(node *yaml.Node) (string, error) {
+	switch s.kind {
+	case kindList:
+		if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+			return node.Value, nil
+		}
+		if node.Kind != yaml.SequenceNode {
+			return "", fmt.Errorf("must be a list of strings")
+		}
+		var items []string
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode || item.Tag != "!!str" {
+				return "", fmt.Errorf("must be a list of strings")
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, s.separator), nil
+	}
+
+	if node.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("must be a %s", s.kindName())
+	}
+
+	switch s.kind {
+	case kindBool:
+		if node.Tag != "!!bool" {
+			return "", fmt.Errorf("must be true or false, got %q", node.Value)
+		}
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	case kindInt:
+		var n int
+		if node.Tag != "!!int" || node.Decode(&n) != nil {
+			return "", fmt.Errorf("must be an integer, got %q", node.Value)
+		}
+		if n < s.min || n > s.max {
+			return "", fmt.Errorf("must be between %d and %d, got %d", s.min, s.max, n)
+		}
+		return strconv.Itoa(n), nil
+	case kindDuration:
+		d, err := time.ParseDuration(node.Value)
+		if node.Tag != "!!str" || err != nil || d <= 0 {
+			return "", fmt.Errorf("must be a positive duration such as 30s, got %q", node.Value)
+		}
+		return node.Value, nil
+	case kindEnum:
+		for _, v := range s.values {
+			if node.Value == v {
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("must be one of %s, got %q", strings.Join(s.values, ", "), node.Value)
+	default:
+		if node.Tag == "!!null" || node.Tag == "!!bool" {
+			return "", fmt.Errorf("must be a string, got %q", node.Value)
+		}
+		return node.Value, nil
+	}
+}
+
+func (s Setting) kindName() string {
+	switch s.kind {
+	case kindBool:
+		return "boolean"
+	case kindInt:
+		return "integer"
+	case kindDuration:
+		return "duration"
+	default:
+		return "string"
+	}
+}
+
+// Apply sets the environment variables the file provides values for, except
+// those already set, since the environment takes precedence over the file.
+// It returns the names of the variables it set.
+func (f *File) Apply() ([]string, error) {
+	var applied []string
+	for _, setting := range Schema {
+		value, ok := f.Values[setting.Env]
+		if !ok {
+			continue
+		}
+		if _, set := os.LookupEnv(setting.Env); set {
+			continue
+		}
+		if err := os.Setenv(setting.Env, value); err != nil {
+			return applied, err
+		}
+		applied = append(applied, setting.Env)
+	}
+	return applied, nil
+}
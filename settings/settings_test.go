@@ -0,0 +1,174 @@
+package settings_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/settings"
+)
+
+var _ = Describe("Parse", func() {
+	It("maps YAML settings to environment variables", func() {
+		values, err := settings.Parse([]byte(`
+port: 8080
+bindAddress: 127.0.0.1
+nativeModules:
+  - C:\modules\a
+  - C:\modules\b
+disableOptionalModules: CorsModule
+webSockets:
+  enabled: false
+  pingInterval: 30s
+  receiveBufferLimit: 65536
+appSettings:
+  prefix: APPSETTING_
+  conflicts: error
+configTokens:
+  enabled: true
+  files: [connectionStrings.config, App_Config/settings.config]
+`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(values).To(Equal(map[string]string{
+			"PORT":                               "8080",
+			"HWC_BIND_ADDRESS":                   "127.0.0.1",
+			"HWC_NATIVE_MODULES":                 `C:\modules\a;C:\modules\b`,
+			"HWC_DISABLE_OPTIONAL_MODULES":       "CorsModule",
+			"HWC_WEBSOCKETS":                     "false",
+			"HWC_WEBSOCKET_PING_INTERVAL":        "30s",
+			"HWC_WEBSOCKET_RECEIVE_BUFFER_LIMIT": "65536",
+			"HWC_APPSETTINGS_PREFIX":             "APPSETTING_",
+			"HWC_APPSETTINGS_CONFLICTS":          "error",
+			"HWC_CONFIG_TOKENS":                  "true",
+			"HWC_CONFIG_TOKEN_FILES":             "connectionStrings.config;App_Config/settings.config",
+		}))
+	})
+
+	It("joins a list of bind addresses", func() {
+		values, err := settings.Parse([]byte("bindAddress:\n  - 10.0.0.5\n  - fd00::1\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(values).To(Equal(map[string]string{"HWC_BIND_ADDRESS": "10.0.0.5,fd00::1"}))
+	})
+
+	It("accepts JSON", func() {
+		values, err := settings.Parse([]byte(`{"port": 8080, "webSockets": {"enabled": true}}`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(values).To(Equal(map[string]string{"PORT": "8080", "HWC_WEBSOCKETS": "true"}))
+	})
+
+	It("accepts an empty document", func() {
+		values, err := settings.Parse([]byte("# nothing here\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(values).To(BeEmpty())
+	})
+
+	DescribeTable("names the key of invalid settings",
+		func(document, message string) {
+			_, err := settings.Parse([]byte(document))
+			Expect(err).To(MatchError(message))
+		},
+		Entry("unknown key", "port: 80\nbindAdress: 127.0.0.1", "line 2: unknown key bindAdress"),
+		Entry("unknown nested key", "webSockets:\n  enabeld: true", "line 2: unknown key webSockets.enabeld"),
+		Entry("non-integer port", "port: eighty", `line 1: port: must be an integer, got "eighty"`),
+		Entry("port out of range", "port: 70000", "line 1: port: must be between 1 and 65535, got 70000"),
+		Entry("non-boolean", "webSockets:\n  enabled: sometimes", `line 2: webSockets.enabled: must be true or false, got "sometimes"`),
+		Entry("invalid duration", "webSockets:\n  pingInterval: 30", `line 2: webSockets.pingInterval: must be a positive duration such as 30s, got "30"`),
+		Entry("invalid enum", "appSettings:\n  conflicts: env", `line 2: appSettings.conflicts: must be one of app, error, got "env"`),
+		Entry("list of non-strings", "nativeModules: [1, 2]", "line 1: nativeModules: must be a list of strings"),
+		Entry("mapping for a scalar", "webConfigTransform:\n  name: x", "line 2: webConfigTransform: must be a string"),
+		Entry("null string", "webConfigTransform:", `line 1: webConfigTransform: must be a string, got ""`),
+		Entry("mapping for a list", "bindAddress:\n  host: x", "line 2: bindAddress: must be a list of strings"),
+		Entry("scalar for a group", "webSockets: true", "line 1: webSockets: must be a mapping"),
+		Entry("non-mapping document", "- port", "line 1: settings must be a mapping"),
+	)
+
+	It("fails on malformed documents", func() {
+		_, err := settings.Parse([]byte("port: [80"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("fails on duplicate keys", func() {
+		_, err := settings.Parse([]byte("port: 80\nport: 81"))
+		Expect(err).To(MatchError("line 2: duplicate key port"))
+	})
+})
+
+var _ = Describe("Load", func() {
+	var rootPath string
+
+	BeforeEach(func() {
+		var err error
+		rootPath, err = os.MkdirTemp("", "settings")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(rootPath)).To(Succeed())
+	})
+
+	It("returns nil without a settings file", func() {
+		file, err := settings.Load(rootPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(file).To(BeNil())
+	})
+
+	It("reads hwc.json", func() {
+		Expect(os.WriteFile(filepath.Join(rootPath, "hwc.json"), []byte(`{"bindAddress": "::1"}`), 0644)).To(Succeed())
+
+		file, err := settings.Load(rootPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(file.Path).To(Equal(filepath.Join(rootPath, "hwc.json")))
+		Expect(file.Values).To(Equal(map[string]string{"HWC_BIND_ADDRESS": "::1"}))
+	})
+
+	It("prefixes errors with the file name", func() {
+		Expect(os.WriteFile(filepath.Join(rootPath, "hwc.yml"), []byte("prot: 80"), 0644)).To(Succeed())
+
+		_, err := settings.Load(rootPath)
+		Expect(err).To(MatchError("hwc.yml: line 1: unknown key prot"))
+	})
+
+	It("fails when there is more than one settings file", func() {
+		Expect(os.WriteFile(filepath.Join(rootPath, "hwc.yml"), []byte("port: 80"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(rootPath, "hwc.json"), []byte(`{"port": 80}`), 0644)).To(Succeed())
+
+		_, err := settings.Load(rootPath)
+		Expect(err).To(MatchError(ContainSubstring("Found more than one settings file")))
+	})
+})
+
+var _ = Describe("Apply", func() {
+	AfterEach(func() {
+		Expect(os.Unsetenv("HWC_BIND_ADDRESS")).To(Succeed())
+		Expect(os.Unsetenv("HWC_WEB_CONFIG_TRANSFORM")).To(Succeed())
+	})
+
+	It("sets variables that are not already set", func() {
+		Expect(os.Setenv("HWC_BIND_ADDRESS", "10.0.0.1")).To(Succeed())
+
+		file := &settings.File{Values: map[string]string{
+			"HWC_BIND_ADDRESS":         "127.0.0.1",
+			"HWC_WEB_CONFIG_TRANSFORM": "Cloud",
+		}}
+		applied, err := file.Apply()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(applied).To(Equal([]string{"HWC_WEB_CONFIG_TRANSFORM"}))
+		Expect(os.Getenv("HWC_BIND_ADDRESS")).To(Equal("10.0.0.1"))
+		Expect(os.Getenv("HWC_WEB_CONFIG_TRANSFORM")).To(Equal("Cloud"))
+	})
+})
+
+var _ = Describe("Schema", func() {
+	It("has unique keys and environment variables", func() {
+		keys := map[string]bool{}
+		envs := map[string]bool{}
+		for _, s := range settings.Schema {
+			Expect(keys).ToNot(HaveKey(s.Key))
+			Expect(envs).ToNot(HaveKey(s.Env))
+			keys[s.Key] = true
+			envs[s.Env] = true
+		}
+	})
+})
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package tempdir
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive reports whether a process with pid exists. A process owned by
+// another user, which may not be signalled, exists too.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
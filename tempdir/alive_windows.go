@@ -0,0 +1,29 @@
+//go:build windows
+// +build windows
+
+package tempdir
+
+import (
+	"errors"
+	"syscall"
+)
+
+// stillActive is the exit code GetExitCodeProcess returns for a running
+// process
+const stillActive = 259
+
+// processAlive reports whether a process with pid is running. A process that
+// may not be opened, e.g. one owned by another user, is running too.
+func processAlive(pid int) bool {
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	defer syscall.CloseHandle(handle)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
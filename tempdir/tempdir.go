@@ -0,0 +1,123 @@
+// Package tempdir gives each hwc instance its own directory under the temp
+// directory, so that processes sharing a USERPROFILE do not overwrite each
+// other's configs, and removes the directories of instances that are gone.
+package tempdir
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PIDFile is written to each instance directory while its hwc process runs
+const PIDFile = "hwc.pid"
+
+// Create creates the directory of the instance name under base and records
+// the current process in it. It fails when another running process already
+// uses the directory, i.e. when two instances are given the same name.
+func Create(base, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return "", fmt.Errorf("invalid instance directory name %q", name)
+	}
+
+	dir := filepath.Join(base, name)
+	if pid, ok := readPID(dir); ok && pid != os.Getpid() && processAlive(pid) {
+		return "", fmt.Errorf("instance directory %s is in use by process %d", dir, pid)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	// Written through a temporary file so that Clean never reads a partial PID
+	tmp := filepath.Join(dir, PIDFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(os.Getpid())), 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, PIDFile)); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return dir, nil
+}
+
+// Stale lists the instance directories under base whose process has exited.
+// Directories without a readable PID file are left alone: they either belong
+// to an instance that is still starting or were not created by Create.
+func Stale(base string) ([]string, error) {
+	entries, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(base, entry.Name())
+
+		pid, ok := readPID(dir)
+		if !ok || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		stale = append(stale, dir)
+	}
+	return stale, nil
+}
+
+// Clean removes the stale instance directories under base. Directories that
+// cannot be removed, e.g. because a file in them is still open, are reported
+// in the error and left for a later start.
+func Clean(base string) ([]string, error) {
+	stale, err := Stale(base)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed, failed []string
+	for _, dir := range stale {
+		// The PID file goes first so that a partly removed directory is not
+		// mistaken for a live one, nor removed twice concurrently
+		if err := os.Remove(filepath.Join(dir, PIDFile)); err != nil {
+			if !os.IsNotExist(err) {
+				failed = append(failed, fmt.Sprintf("%s: %v", filepath.Base(dir), err))
+			}
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", filepath.Base(dir), err))
+			continue
+		}
+		removed = append(removed, dir)
+	}
+
+	if len(failed) > 0 {
+		return removed, fmt.Errorf("could not remove stale instance directories: %s", strings.Join(failed, "; "))
+	}
+	return removed, nil
+}
+
+// readPID reads the PID file of an instance directory
+func readPID(dir string) (int, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, PIDFile))
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
+
+// Remove removes the directory of the current instance when hwc exits
+func Remove(dir string) error {
+	if err := os.Remove(filepath.Join(dir, PIDFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
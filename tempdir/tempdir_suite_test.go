@@ -0,0 +1,13 @@
+package tempdir_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTempdir(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tempdir Suite")
+}
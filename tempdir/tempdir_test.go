@@ -0,0 +1,158 @@
+package tempdir_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/tempdir"
+)
+
+// deadPID returns the PID of a process that has exited
+func deadPID() int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	Expect(cmd.Run()).To(Succeed())
+	return cmd.Process.Pid
+}
+
+var _ = Describe("tempdir", func() {
+	var base string
+
+	writeInstance := func(name string, pid int) string {
+		dir := filepath.Join(base, name)
+		Expect(os.MkdirAll(filepath.Join(dir, "config"), 0700)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "config", "ApplicationHost.config"), []byte("<configuration />"), 0600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, tempdir.PIDFile), []byte(strconv.Itoa(pid)), 0600)).To(Succeed())
+		return dir
+	}
+
+	BeforeEach(func() {
+		base = GinkgoT().TempDir()
+	})
+
+	Describe("Create", func() {
+		It("creates the instance directory with a PID file", func() {
+			dir, err := tempdir.Create(base, "instance-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dir).To(Equal(filepath.Join(base, "instance-1")))
+
+			data, err := os.ReadFile(filepath.Join(dir, tempdir.PIDFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(Equal(strconv.Itoa(os.Getpid())))
+			Expect(filepath.Join(dir, tempdir.PIDFile+".tmp")).NotTo(BeAnExistingFile())
+		})
+
+		It("creates the base directory", func() {
+			dir, err := tempdir.Create(filepath.Join(base, "tmp"), "8080")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dir).To(BeADirectory())
+		})
+
+		It("reuses the directory of a restarted instance", func() {
+			dir := writeInstance("8080", deadPID())
+			Expect(tempdir.Create(base, "8080")).To(Equal(dir))
+			Expect(filepath.Join(dir, "config", "ApplicationHost.config")).To(BeAnExistingFile())
+		})
+
+		It("refuses a directory in use by another running instance", func() {
+			dir := writeInstance("busy", os.Getppid())
+			_, err := tempdir.Create(base, "busy")
+			Expect(err).To(MatchError(fmt.Sprintf("instance directory %s is in use by process %d", dir, os.Getppid())))
+		})
+
+		DescribeTable("rejects names that are not a single directory",
+			func(name string) {
+				_, err := tempdir.Create(base, name)
+				Expect(err).To(MatchError(fmt.Sprintf("invalid instance directory name %q", name)))
+			},
+			Entry("empty", ""),
+			Entry("parent", ".."),
+			Entry("nested", "a/b"),
+			Entry("windows separator", `a\b`),
+			Entry("drive", "C:"),
+		)
+	})
+
+	Describe("Stale", func() {
+		It("lists the directories of exited instances", func() {
+			stale := writeInstance("stale", deadPID())
+			writeInstance("current", os.Getpid())
+			writeInstance("parent", os.Getppid())
+
+			Expect(tempdir.Stale(base)).To(Equal([]string{stale}))
+		})
+
+		It("leaves directories without a valid PID file alone", func() {
+			Expect(os.MkdirAll(filepath.Join(base, "config"), 0700)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(base, "LogFiles"), 0700)).To(Succeed())
+			writeInstance("garbled", 1)
+			Expect(os.WriteFile(filepath.Join(base, "garbled", tempdir.PIDFile), []byte("12ab"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(base, "hwc-starts"), []byte("1"), 0600)).To(Succeed())
+
+			Expect(tempdir.Stale(base)).To(BeEmpty())
+		})
+
+		It("returns nothing when base does not exist", func() {
+			Expect(tempdir.Stale(filepath.Join(base, "missing"))).To(BeEmpty())
+		})
+	})
+
+	Describe("Clean", func() {
+		It("removes stale instance directories", func() {
+			stale := writeInstance("stale", deadPID())
+			live := writeInstance("live", os.Getpid())
+
+			Expect(tempdir.Clean(base)).To(Equal([]string{stale}))
+			Expect(stale).NotTo(BeAnExistingFile())
+			Expect(live).To(BeADirectory())
+		})
+
+		It("keeps the instances that run concurrently", func() {
+			pid := deadPID()
+			var stale []string
+			for i := 0; i < 10; i++ {
+				stale = append(stale, writeInstance(fmt.Sprintf("stale-%d", i), pid))
+			}
+
+			var wg sync.WaitGroup
+			dirs := make([]string, 10)
+			errs := make([]error, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+					dir, err := tempdir.Create(base, fmt.Sprintf("instance-%d", i))
+					Expect(err).NotTo(HaveOccurred())
+					dirs[i] = dir
+					_, errs[i] = tempdir.Clean(base)
+				}(i)
+			}
+			wg.Wait()
+
+			for i := range dirs {
+				Expect(errs[i]).NotTo(HaveOccurred())
+				Expect(filepath.Join(dirs[i], tempdir.PIDFile)).To(BeAnExistingFile())
+			}
+			for _, dir := range stale {
+				Expect(dir).NotTo(BeAnExistingFile())
+			}
+		})
+	})
+
+	Describe("Remove", func() {
+		It("removes the instance directory", func() {
+			dir, err := tempdir.Create(base, "instance-1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tempdir.Remove(dir)).To(Succeed())
+			Expect(dir).NotTo(BeAnExistingFile())
+			Expect(base).To(BeADirectory())
+		})
+	})
+})
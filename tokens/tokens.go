@@ -0,0 +1,158 @@
+// Package tokens substitutes #{NAME} and ${NAME} placeholders in XML config
+// files, escaping each value for the context the token appears in.
+package tokens
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+var pattern = regexp.MustCompile(`[#$]\{([A-Za-z_][A-Za-z0-9_.]*)\}`)
+
+type context int
+
+const (
+	// markupContext covers tag names, comments, processing instructions and
+	// declarations, where tokens are left alone
+	markupContext context = iota
+	textContext
+	attrContext
+	cdataContext
+)
+
+// Replace replaces the tokens in data with the values lookup returns for
+// their names. Tokens lookup has no value for are left in place and returned,
+// in order of appearance and without duplicates.
+func Replace(data []byte, lookup func(name string) (string, bool)) ([]byte, []string) {
+	var out bytes.Buffer
+	var unresolved []string
+	seen := map[string]bool{}
+
+	scan(data, func(region []byte, ctx context) {
+		if ctx == markupContext {
+			out.Write(region)
+			return
+		}
+
+		out.Write(pattern.ReplaceAllFunc(region, func(token []byte) []byte {
+			name := string(pattern.FindSubmatch(token)[1])
+			value, ok := lookup(name)
+			if !ok {
+				if !seen[string(token)] {
+					seen[string(token)] = true
+					unresolved = append(unresolved, string(token))
+				}
+				return token
+			}
+			return []byte(escape(value, ctx))
+		}))
+	})
+
+	return out.Bytes(), unresolved
+}
+
+// Find returns the tokens in data, in order of appearance and without
+// duplicates
+func Find(data []byte) []string {
+	_, found := Replace(data, func(string) (string, bool) { return "", false })
+	return found
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		`"`, "&quot;",
+		"'", "&apos;",
+		"\n", "&#xA;",
+		"\r", "&#xD;",
+		"\t", "&#x9;",
+	)
+)
+
+func escape(value string, ctx context) string {
+	switch ctx {
+	case attrContext:
+		return attrEscaper.Replace(value)
+	case cdataContext:
+		return strings.ReplaceAll(value, "]]>", "]]]]><![CDATA[>")
+	default:
+		return textEscaper.Replace(value)
+	}
+}
+
+// scan splits data into consecutive regions and reports the context of each
+func scan(data []byte, visit func(region []byte, ctx context)) {
+	for len(data) > 0 {
+		lt := bytes.IndexByte(data, '<')
+		if lt < 0 {
+			visit(data, textContext)
+			return
+		}
+		if lt > 0 {
+			visit(data[:lt], textContext)
+			data = data[lt:]
+		}
+
+		switch {
+		case bytes.HasPrefix(data, []byte("<!--")):
+			data = visitUntil(data, "-->", visit)
+		case bytes.HasPrefix(data, []byte("<![CDATA[")):
+			visit(data[:9], markupContext)
+			data = data[9:]
+			end := bytes.Index(data, []byte("]]>"))
+			if end < 0 {
+				visit(data, markupContext)
+				return
+			}
+			visit(data[:end], cdataContext)
+			data = data[end:]
+		case bytes.HasPrefix(data, []byte("<?")):
+			data = visitUntil(data, "?>", visit)
+		case bytes.HasPrefix(data, []byte("<!")):
+			data = visitUntil(data, ">", visit)
+		default:
+			data = scanTag(data, visit)
+		}
+	}
+}
+
+// visitUntil reports data up to and including end as markup
+func visitUntil(data []byte, end string, visit func([]byte, context)) []byte {
+	i := bytes.Index(data, []byte(end))
+	if i < 0 {
+		visit(data, markupContext)
+		return nil
+	}
+	visit(data[:i+len(end)], markupContext)
+	return data[i+len(end):]
+}
+
+// scanTag reports a tag starting at data[0], separating its attribute values
+func scanTag(data []byte, visit func([]byte, context)) []byte {
+	start := 0
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '>':
+			visit(data[start:i+1], markupContext)
+			return data[i+1:]
+		case '"', '\'':
+			visit(data[start:i+1], markupContext)
+			end := bytes.IndexByte(data[i+1:], c)
+			if end < 0 {
+				visit(data[i+1:], markupContext)
+				return nil
+			}
+			visit(data[i+1:i+1+end], attrContext)
+			start = i + 1 + end
+			i = start
+			visit(data[start:start+1], markupContext)
+			start++
+		}
+	}
+	visit(data[start:], markupContext)
+	return nil
+}
@@ -0,0 +1,93 @@
+package tokens_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/tokens"
+)
+
+var _ = Describe("Replace", func() {
+	values := map[string]string{
+		"DB_HOST":     "db.internal",
+		"DB_PASSWORD": `p&ss"w<rd>'`,
+		"EMPTY":       "",
+		"app.name":    "orders",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+
+	replace := func(data string) (string, []string) {
+		result, unresolved := tokens.Replace([]byte(data), lookup)
+		return string(result), unresolved
+	}
+
+	It("replaces both token forms", func() {
+		result, unresolved := replace(`<add key="host" value="#{DB_HOST}" /><add key="app" value="${app.name}" />`)
+		Expect(result).To(Equal(`<add key="host" value="db.internal" /><add key="app" value="orders" />`))
+		Expect(unresolved).To(BeEmpty())
+	})
+
+	It("escapes values in attributes", func() {
+		result, _ := replace(`<add connectionString="Password=#{DB_PASSWORD}" />`)
+		Expect(result).To(Equal(`<add connectionString="Password=p&amp;ss&quot;w&lt;rd&gt;&apos;" />`))
+	})
+
+	It("escapes values in single-quoted attributes", func() {
+		result, _ := replace(`<add value='#{DB_PASSWORD}' />`)
+		Expect(result).To(Equal(`<add value='p&amp;ss&quot;w&lt;rd&gt;&apos;' />`))
+	})
+
+	It("escapes values in text", func() {
+		result, _ := replace(`<password>#{DB_PASSWORD}</password>`)
+		Expect(result).To(Equal(`<password>p&amp;ss"w&lt;rd&gt;'</password>`))
+	})
+
+	It("keeps CDATA sections well formed", func() {
+		values["CDATA"] = "a]]>b"
+		defer delete(values, "CDATA")
+
+		result, _ := replace(`<script><![CDATA[#{CDATA}]]></script>`)
+		Expect(result).To(Equal(`<script><![CDATA[a]]]]><![CDATA[>b]]></script>`))
+	})
+
+	It("replaces tokens with empty values", func() {
+		result, unresolved := replace(`<add value="#{EMPTY}" />`)
+		Expect(result).To(Equal(`<add value="" />`))
+		Expect(unresolved).To(BeEmpty())
+	})
+
+	It("leaves tokens in comments, processing instructions and tag names alone", func() {
+		source := `<?xml version="1.0" encoding="#{DB_HOST}"?><!-- #{DB_HOST} --><a #{DB_HOST}="x" />`
+		result, unresolved := replace(source)
+		Expect(result).To(Equal(source))
+		Expect(unresolved).To(BeEmpty())
+	})
+
+	It("reports unresolved tokens once, in order, and leaves them in place", func() {
+		result, unresolved := replace(`<a b="${MISSING}">#{ALSO_MISSING} ${MISSING} #{DB_HOST}</a>`)
+		Expect(result).To(Equal(`<a b="${MISSING}">#{ALSO_MISSING} ${MISSING} db.internal</a>`))
+		Expect(unresolved).To(Equal([]string{"${MISSING}", "#{ALSO_MISSING}"}))
+	})
+
+	It("ignores text that is not a token", func() {
+		source := `<a b="{DB_HOST} #DB_HOST ${1DB} #{}">$ # {}</a>`
+		result, unresolved := replace(source)
+		Expect(result).To(Equal(source))
+		Expect(unresolved).To(BeEmpty())
+	})
+
+	It("copies malformed documents through", func() {
+		source := `<a b="#{DB_HOST}`
+		result, _ := replace(source)
+		Expect(result).To(Equal(source))
+	})
+})
+
+var _ = Describe("Find", func() {
+	It("returns the tokens in a document", func() {
+		Expect(tokens.Find([]byte(`<a b="#{ONE}"><!-- #{COMMENTED} -->${TWO}</a>`))).To(Equal([]string{"#{ONE}", "${TWO}"}))
+	})
+})
@@ -0,0 +1,64 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ValidateMachineKey warns when the Web.config at path leaves the machineKey
+// keys to be auto-generated. It is used when the app runs more than one
+// instance and hwc was not given a machineKey, in which case forms
+// authentication cookies, ViewState and anti-forgery tokens issued by one
+// instance are rejected by the others.
+func ValidateMachineKey(path string, writer io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fixed, err := setsMachineKey(data)
+	if err != nil {
+		return err
+	}
+
+	if !fixed {
+		fmt.Fprintf(writer, "Warning: Web.config relies on auto-generated machineKey keys but the app runs more than one instance, set HWC_MACHINE_KEY_VALIDATION_KEY and HWC_MACHINE_KEY_DECRYPTION_KEY or bind a machinekey service\n")
+	}
+	return nil
+}
+
+// setsMachineKey reports whether a machineKey element sets both keys to
+// fixed values
+func setsMachineKey(data []byte) (bool, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok || !strings.EqualFold(element.Name.Local, "machineKey") {
+			continue
+		}
+
+		keys := 0
+		for _, attr := range element.Attr {
+			switch attr.Name.Local {
+			case "validationKey", "decryptionKey":
+				if attr.Value != "" && !strings.Contains(strings.ToLower(attr.Value), "autogenerate") {
+					keys++
+				}
+			}
+		}
+		if keys == 2 {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package validator_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/hwc/validator"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("ValidateMachineKey", func() {
+	var (
+		buf *gbytes.Buffer
+	)
+
+	BeforeEach(func() {
+		buf = gbytes.NewBuffer()
+	})
+
+	Context("when the web.config does not set a machineKey", func() {
+		BeforeEach(func() {
+			webConfig := "../fixtures/webconfigs/Web.config.good"
+			Expect(validator.ValidateMachineKey(webConfig, buf)).To(Succeed())
+		})
+
+		It("warns that the keys are auto-generated", func() {
+			Eventually(buf).Should(gbytes.Say("Warning: Web.config relies on auto-generated machineKey keys"))
+		})
+	})
+
+	Context("when the web.config sets both keys", func() {
+		BeforeEach(func() {
+			webConfig := "../fixtures/webconfigs/Web.config.machinekey"
+			Expect(validator.ValidateMachineKey(webConfig, buf)).To(Succeed())
+		})
+
+		It("does not print any warnings", func() {
+			Eventually(buf.Contents()).Should(BeEmpty())
+		})
+	})
+
+	Context("when the web.config asks for auto-generated keys", func() {
+		It("warns that the keys are auto-generated", func() {
+			dir, err := os.MkdirTemp("", "machinekey")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			webConfig := filepath.Join(dir, "Web.config")
+			contents := `<configuration><system.web><machineKey validationKey="AutoGenerate,IsolateApps" decryptionKey="AutoGenerate,IsolateApps" /></system.web></configuration>`
+			Expect(os.WriteFile(webConfig, []byte(contents), 0600)).To(Succeed())
+
+			Expect(validator.ValidateMachineKey(webConfig, buf)).To(Succeed())
+			Eventually(buf).Should(gbytes.Say("auto-generated machineKey keys"))
+		})
+	})
+
+	Context("when the web.config has invalid xml", func() {
+		It("returns an error", func() {
+			webConfig := "../fixtures/webconfigs/Web.config.invalid"
+			Expect(validator.ValidateMachineKey(webConfig, buf)).NotTo(Succeed())
+		})
+	})
+})
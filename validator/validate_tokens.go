@@ -0,0 +1,24 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/hwc/tokens"
+)
+
+// ValidateTokens warns about #{NAME} and ${NAME} tokens left in the config
+// file at path after substitution, which name unset environment variables
+func ValidateTokens(path string, writer io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens.Find(data) {
+		fmt.Fprintf(writer, "Warning: %s contains unresolved token %s\n", filepath.Base(path), token)
+	}
+	return nil
+}
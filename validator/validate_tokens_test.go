@@ -0,0 +1,45 @@
+package validator_test
+
+import (
+	"code.cloudfoundry.org/hwc/validator"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("ValidateTokens", func() {
+	var (
+		buf *gbytes.Buffer
+	)
+
+	BeforeEach(func() {
+		buf = gbytes.NewBuffer()
+	})
+
+	Context("when the web.config contains unresolved tokens", func() {
+		BeforeEach(func() {
+			Expect(validator.ValidateTokens("../fixtures/webconfigs/Web.config.tokens", buf)).To(Succeed())
+		})
+
+		It("warns about each token", func() {
+			Eventually(buf).Should(gbytes.Say(`Warning: Web.config.tokens contains unresolved token #\{API_URL\}`))
+			Eventually(buf).Should(gbytes.Say(`Warning: Web.config.tokens contains unresolved token \$\{REGION\}`))
+		})
+	})
+
+	Context("when the web.config contains no tokens", func() {
+		BeforeEach(func() {
+			Expect(validator.ValidateTokens("../fixtures/webconfigs/Web.config.good", buf)).To(Succeed())
+		})
+
+		It("does not print any warnings", func() {
+			Eventually(buf.Contents()).Should(BeEmpty())
+		})
+	})
+
+	Context("when the file does not exist", func() {
+		It("returns an error", func() {
+			Expect(validator.ValidateTokens("../fixtures/webconfigs/Web.config.missing", buf)).ToNot(Succeed())
+		})
+	})
+})
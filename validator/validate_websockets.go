@@ -0,0 +1,55 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ValidateWebSocketSupport warns when the Web.config at path references
+// websockets. It is used when WebSocketModule is not installed, in which case
+// websocket requests fail and clients such as SignalR fall back to polling.
+func ValidateWebSocketSupport(path string, writer io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	references, err := referencesWebSockets(data)
+	if err != nil {
+		return err
+	}
+
+	if references {
+		fmt.Fprintf(writer, "Warning: Web.config references websockets but WebSocketModule is not installed, websocket requests will fail\n")
+	}
+	return nil
+}
+
+func referencesWebSockets(data []byte) (bool, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(element.Name.Local, "webSocket") {
+			return true, nil
+		}
+		for _, attr := range element.Attr {
+			if strings.Contains(strings.ToLower(attr.Value), "websocket") {
+				return true, nil
+			}
+		}
+	}
+}
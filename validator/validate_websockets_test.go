@@ -0,0 +1,47 @@
+package validator_test
+
+import (
+	"code.cloudfoundry.org/hwc/validator"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("ValidateWebSocketSupport", func() {
+	var (
+		buf *gbytes.Buffer
+	)
+
+	BeforeEach(func() {
+		buf = gbytes.NewBuffer()
+	})
+
+	Context("when the web.config references websockets", func() {
+		BeforeEach(func() {
+			webConfig := "../fixtures/webconfigs/Web.config.websockets"
+			Expect(validator.ValidateWebSocketSupport(webConfig, buf)).To(Succeed())
+		})
+
+		It("warns that websocket requests will fail", func() {
+			Eventually(buf).Should(gbytes.Say("Warning: Web.config references websockets but WebSocketModule is not installed"))
+		})
+	})
+
+	Context("when the web.config does not reference websockets", func() {
+		BeforeEach(func() {
+			webConfig := "../fixtures/webconfigs/Web.config.good"
+			Expect(validator.ValidateWebSocketSupport(webConfig, buf)).To(Succeed())
+		})
+
+		It("does not print any warnings", func() {
+			Eventually(buf.Contents()).Should(BeEmpty())
+		})
+	})
+
+	Context("when the web.config has invalid xml", func() {
+		It("returns an error", func() {
+			webConfig := "../fixtures/webconfigs/Web.config.invalid"
+			Expect(validator.ValidateWebSocketSupport(webConfig, buf)).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,38 @@
+package validator_test
+
+import (
+	"code.cloudfoundry.org/hwc/validator"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("ValidateXML", func() {
+	var (
+		buf *gbytes.Buffer
+	)
+
+	BeforeEach(func() {
+		buf = gbytes.NewBuffer()
+	})
+
+	Context("when the config file is well formed", func() {
+		It("succeeds without warnings", func() {
+			Expect(validator.ValidateXML("../fixtures/webconfigs/Web.config.good", buf)).To(Succeed())
+			Expect(buf.Contents()).To(BeEmpty())
+		})
+	})
+
+	Context("when the config file is not well formed", func() {
+		It("returns an error naming the file and line", func() {
+			err := validator.ValidateXML("../fixtures/webconfigs/Web.config.invalid", buf)
+			Expect(err).To(MatchError(HavePrefix("Web.config.invalid: XML syntax error on line")))
+		})
+	})
+
+	Context("when the file does not exist", func() {
+		It("returns an error", func() {
+			Expect(validator.ValidateXML("../fixtures/webconfigs/Web.config.missing", buf)).ToNot(Succeed())
+		})
+	})
+})
@@ -0,0 +1,46 @@
+package warmup
+
+import (
+	"time"
+
+	"code.cloudfoundry.org/hwc/logger"
+)
+
+// Log writes the report to log as one event per request and a summary
+func (r Report) Log(log *logger.Logger) {
+	succeeded := 0
+	for _, request := range r.Requests {
+		fields := logger.Fields{
+			"path":        request.Request.Path,
+			"url":         request.Result.URL,
+			"attempts":    request.Attempts,
+			"status_code": request.Result.StatusCode,
+			"duration_ms": request.Result.Duration.Milliseconds(),
+		}
+		if request.Succeeded {
+			succeeded++
+			log.Infof("warmup_request", fields, "HWC warm-up request %s succeeded after %d attempt(s): %s",
+				request.Request.Path, request.Attempts, request.Result)
+			continue
+		}
+
+		if request.Result.Err != nil {
+			fields["error"] = request.Result.Err.Error()
+		}
+		log.Warnf("warmup_request_failed", fields, "HWC warm-up request %s failed after %d attempt(s): %s",
+			request.Request.Path, request.Attempts, request.Result)
+	}
+
+	fields := logger.Fields{
+		"requests":    len(r.Requests),
+		"succeeded":   succeeded,
+		"duration_ms": r.Duration.Milliseconds(),
+	}
+	if r.Succeeded() {
+		log.Infof("warmup_complete", fields, "HWC warm-up complete: %d request(s) succeeded in %s",
+			succeeded, r.Duration.Round(time.Millisecond))
+	} else {
+		log.Warnf("warmup_failed", fields, "HWC warm-up failed: %d of %d request(s) succeeded in %s",
+			succeeded, len(r.Requests), r.Duration.Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,227 @@
+// Package warmup sends warm-up requests to the site after activation so that
+// ASP.NET pays its first-request compilation cost before traffic arrives.
+package warmup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/hwc/probe"
+)
+
+// Request is a single warm-up request
+type Request struct {
+	Path    string            `json:"path"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	// ExpectStatus lists the acceptable response codes; by default any 2xx
+	// or 3xx response is
+	ExpectStatus []int `json:"expectStatus"`
+}
+
+func (r Request) accepts(statusCode int) bool {
+	if len(r.ExpectStatus) == 0 {
+		return statusCode >= 200 && statusCode < 400
+	}
+	for _, code := range r.ExpectStatus {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Request) validate() error {
+	if !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path must start with /, got %q", r.Path)
+	}
+	for _, code := range r.ExpectStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("%s: expectStatus must be HTTP status codes, got %d", r.Path, code)
+		}
+	}
+	return nil
+}
+
+// Config configures warm-up
+type Config struct {
+	Requests []Request
+	// Attempts is the number of times each request is tried
+	Attempts int
+	// Interval is the wait between attempts
+	Interval time.Duration
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// ExitOnFailure makes hwc exit when warm-up fails rather than carry on
+	ExitOnFailure bool
+}
+
+// ConfigFromEnv reads the warm-up requests from HWC_WARMUP_PATHS, a comma
+// separated list of paths, or HWC_WARMUP_FILE, a JSON array of requests
+// relative to rootPath. It returns false when neither is set.
+func ConfigFromEnv(rootPath string) (Config, bool, error) {
+	config := Config{Attempts: 5, Interval: 2 * time.Second, Timeout: 60 * time.Second}
+
+	paths := os.Getenv("HWC_WARMUP_PATHS")
+	file := os.Getenv("HWC_WARMUP_FILE")
+	switch {
+	case paths != "" && file != "":
+		return config, false, fmt.Errorf("Set only one of HWC_WARMUP_PATHS and HWC_WARMUP_FILE")
+	case paths != "":
+		for _, path := range strings.Split(paths, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				config.Requests = append(config.Requests, Request{Path: path})
+			}
+		}
+	case file != "":
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(rootPath, file)
+		}
+		requests, err := LoadRequests(file)
+		if err != nil {
+			return config, false, fmt.Errorf("HWC_WARMUP_FILE: %v", err)
+		}
+		config.Requests = requests
+	default:
+		return config, false, nil
+	}
+
+	for _, r := range config.Requests {
+		if err := r.validate(); err != nil {
+			return config, false, fmt.Errorf("Invalid warm-up request: %v", err)
+		}
+	}
+
+	if value := os.Getenv("HWC_WARMUP_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			return config, false, fmt.Errorf("HWC_WARMUP_ATTEMPTS must be a positive integer, got %q", value)
+		}
+		config.Attempts = attempts
+	}
+
+	for name, target := range map[string]*time.Duration{
+		"HWC_WARMUP_INTERVAL": &config.Interval,
+		"HWC_WARMUP_TIMEOUT":  &config.Timeout,
+	} {
+		if value := os.Getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return config, false, fmt.Errorf("%s must be a positive duration such as 10s, got %q", name, value)
+			}
+			*target = d
+		}
+	}
+
+	switch value := os.Getenv("HWC_WARMUP_FAILURE"); value {
+	case "", "continue":
+	case "exit":
+		config.ExitOnFailure = true
+	default:
+		return config, false, fmt.Errorf("HWC_WARMUP_FAILURE must be continue or exit, got %q", value)
+	}
+
+	return config, len(config.Requests) > 0, nil
+}
+
+// LoadRequests reads a JSON array of requests from path
+func LoadRequests(path string) ([]Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []Request
+	if err := json.Unmarshal(data, &requests); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return requests, nil
+}
+
+// RequestReport is the outcome of one warm-up request
+type RequestReport struct {
+	Request   Request
+	Attempts  int
+	Result    probe.Result
+	Succeeded bool
+}
+
+// Report is the outcome of warm-up
+type Report struct {
+	Requests []RequestReport
+	Duration time.Duration
+}
+
+func (r Report) Succeeded() bool {
+	for _, request := range r.Requests {
+		if !request.Succeeded {
+			return false
+		}
+	}
+	return true
+}
+
+// Failure describes the requests that failed, or is empty when warm-up
+// succeeded
+func (r Report) Failure() string {
+	var failed []string
+	for _, request := range r.Requests {
+		if !request.Succeeded {
+			failed = append(failed, fmt.Sprintf("%s: %s", request.Request.Path, request.Result))
+		}
+	}
+	if len(failed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d warm-up request(s) failed: %s", len(failed), len(r.Requests), strings.Join(failed, "; "))
+}
+
+// Run sends each request in turn to the site at baseURL, retrying failed
+// attempts, and reports how each one went. Requests after one that failed
+// every attempt are still sent.
+func Run(ctx context.Context, baseURL string, config Config) Report {
+	start := time.Now()
+	report := Report{}
+
+	for _, request := range config.Requests {
+		prober := probe.New(strings.TrimSuffix(baseURL, "/")+request.Path, config.Timeout)
+		prober.Method = request.Method
+		prober.Header = http.Header{}
+		for name, value := range request.Headers {
+			prober.Header.Set(name, value)
+		}
+
+		requestReport := RequestReport{Request: request}
+		for attempt := 1; attempt <= config.Attempts; attempt++ {
+			requestReport.Attempts = attempt
+			requestReport.Result = prober.Probe(ctx)
+			if requestReport.Result.Err == nil && request.accepts(requestReport.Result.StatusCode) {
+				requestReport.Succeeded = true
+				break
+			}
+			if attempt == config.Attempts || !sleep(ctx, config.Interval) {
+				break
+			}
+		}
+		report.Requests = append(report.Requests, requestReport)
+	}
+
+	report.Duration = time.Since(start)
+	return report
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
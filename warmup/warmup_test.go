@@ -0,0 +1,225 @@
+package warmup_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"code.cloudfoundry.org/hwc/logger"
+	"code.cloudfoundry.org/hwc/warmup"
+)
+
+var _ = Describe("Run", func() {
+	var (
+		site     *httptest.Server
+		mu       sync.Mutex
+		hits     map[string]int
+		failures map[string]int
+		headers  http.Header
+		config   warmup.Config
+	)
+
+	BeforeEach(func() {
+		hits = map[string]int{}
+		failures = map[string]int{}
+		site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			hits[r.URL.Path]++
+			headers = r.Header.Clone()
+			switch {
+			case r.URL.Path == "/missing":
+				w.WriteHeader(http.StatusNotFound)
+			case r.URL.Path == "/slow":
+				time.Sleep(100 * time.Millisecond)
+			case hits[r.URL.Path] <= failures[r.URL.Path]:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		config = warmup.Config{Attempts: 3, Interval: time.Millisecond, Timeout: time.Second}
+	})
+
+	AfterEach(func() {
+		site.Close()
+	})
+
+	It("sends each request to the site", func() {
+		config.Requests = []warmup.Request{{Path: "/"}, {Path: "/api/orders", Headers: map[string]string{"X-Warmup": "true"}}}
+
+		report := warmup.Run(context.Background(), site.URL+"/app/", config)
+		Expect(report.Succeeded()).To(BeTrue())
+		Expect(report.Requests).To(HaveLen(2))
+		Expect(report.Failure()).To(BeEmpty())
+		Expect(report.Requests[1].Result.URL).To(Equal(site.URL + "/app/api/orders"))
+		Expect(hits).To(Equal(map[string]int{"/app/": 1, "/app/api/orders": 1}))
+		Expect(headers.Get("X-Warmup")).To(Equal("true"))
+	})
+
+	It("retries failed attempts", func() {
+		failures["/"] = 2
+		config.Requests = []warmup.Request{{Path: "/"}}
+
+		report := warmup.Run(context.Background(), site.URL, config)
+		Expect(report.Succeeded()).To(BeTrue())
+		Expect(report.Requests[0].Attempts).To(Equal(3))
+	})
+
+	It("fails a request after the last attempt and carries on", func() {
+		failures["/"] = 5
+		config.Requests = []warmup.Request{{Path: "/"}, {Path: "/next"}}
+
+		report := warmup.Run(context.Background(), site.URL, config)
+		Expect(report.Succeeded()).To(BeFalse())
+		Expect(report.Requests[0].Succeeded).To(BeFalse())
+		Expect(report.Requests[0].Attempts).To(Equal(3))
+		Expect(report.Requests[0].Result.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(report.Requests[1].Succeeded).To(BeTrue())
+		Expect(report.Failure()).To(HavePrefix("1 of 2 warm-up request(s) failed: /: "))
+	})
+
+	It("checks the expected status", func() {
+		config.Requests = []warmup.Request{{Path: "/missing"}}
+		Expect(warmup.Run(context.Background(), site.URL, config).Succeeded()).To(BeFalse())
+
+		config.Requests = []warmup.Request{{Path: "/missing", ExpectStatus: []int{404}}}
+		Expect(warmup.Run(context.Background(), site.URL, config).Succeeded()).To(BeTrue())
+	})
+
+	It("times out slow attempts", func() {
+		config.Timeout = 10 * time.Millisecond
+		config.Attempts = 1
+		config.Requests = []warmup.Request{{Path: "/slow"}}
+
+		report := warmup.Run(context.Background(), site.URL, config)
+		Expect(report.Succeeded()).To(BeFalse())
+		Expect(report.Requests[0].Result.Err).To(HaveOccurred())
+	})
+
+	It("stops retrying when the context is done", func() {
+		failures["/"] = 100
+		config.Attempts = 100
+		config.Interval = time.Hour
+		config.Requests = []warmup.Request{{Path: "/"}}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		report := warmup.Run(ctx, site.URL, config)
+		Expect(report.Succeeded()).To(BeFalse())
+		Expect(report.Requests[0].Attempts).To(Equal(1))
+	})
+})
+
+var _ = Describe("Report", func() {
+	It("logs each request and a summary", func() {
+		out := gbytes.NewBuffer()
+		errOut := gbytes.NewBuffer()
+		site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/broken" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer site.Close()
+
+		report := warmup.Run(context.Background(), site.URL, warmup.Config{
+			Requests: []warmup.Request{{Path: "/"}, {Path: "/broken"}},
+			Attempts: 2,
+			Interval: time.Millisecond,
+			Timeout:  time.Second,
+		})
+		report.Log(logger.New(out, errOut))
+
+		Expect(out).To(gbytes.Say(`HWC warm-up request / succeeded after 1 attempt\(s\): .* returned 200`))
+		Expect(errOut).To(gbytes.Say(`HWC warm-up request /broken failed after 2 attempt\(s\): .* returned 500`))
+		Expect(errOut).To(gbytes.Say(`HWC warm-up failed: 1 of 2 request\(s\) succeeded`))
+	})
+})
+
+var _ = Describe("ConfigFromEnv", func() {
+	var rootPath string
+
+	BeforeEach(func() {
+		var err error
+		rootPath, err = os.MkdirTemp("", "warmup")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		for _, name := range []string{"HWC_WARMUP_PATHS", "HWC_WARMUP_FILE", "HWC_WARMUP_ATTEMPTS", "HWC_WARMUP_INTERVAL", "HWC_WARMUP_TIMEOUT", "HWC_WARMUP_FAILURE"} {
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+		Expect(os.RemoveAll(rootPath)).To(Succeed())
+	})
+
+	It("is disabled without requests", func() {
+		_, enabled, err := warmup.ConfigFromEnv(rootPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(enabled).To(BeFalse())
+	})
+
+	It("reads paths and defaults the rest", func() {
+		Expect(os.Setenv("HWC_WARMUP_PATHS", "/, /api/ping")).To(Succeed())
+
+		config, enabled, err := warmup.ConfigFromEnv(rootPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(enabled).To(BeTrue())
+		Expect(config).To(Equal(warmup.Config{
+			Requests: []warmup.Request{{Path: "/"}, {Path: "/api/ping"}},
+			Attempts: 5,
+			Interval: 2 * time.Second,
+			Timeout:  60 * time.Second,
+		}))
+	})
+
+	It("reads requests from a file relative to the app root", func() {
+		Expect(os.WriteFile(filepath.Join(rootPath, "warmup.json"), []byte(`[
+			{"path": "/", "headers": {"Host": "app.example.com"}, "expectStatus": [200, 302]}
+		]`), 0644)).To(Succeed())
+		Expect(os.Setenv("HWC_WARMUP_FILE", "warmup.json")).To(Succeed())
+		Expect(os.Setenv("HWC_WARMUP_ATTEMPTS", "2")).To(Succeed())
+		Expect(os.Setenv("HWC_WARMUP_TIMEOUT", "5m")).To(Succeed())
+		Expect(os.Setenv("HWC_WARMUP_FAILURE", "exit")).To(Succeed())
+
+		config, _, err := warmup.ConfigFromEnv(rootPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.Requests).To(Equal([]warmup.Request{{
+			Path:         "/",
+			Headers:      map[string]string{"Host": "app.example.com"},
+			ExpectStatus: []int{200, 302},
+		}}))
+		Expect(config.Attempts).To(Equal(2))
+		Expect(config.Timeout).To(Equal(5 * time.Minute))
+		Expect(config.ExitOnFailure).To(BeTrue())
+	})
+
+	DescribeTable("rejects invalid settings",
+		func(env map[string]string, message string) {
+			for name, value := range env {
+				Expect(os.Setenv(name, value)).To(Succeed())
+			}
+			_, _, err := warmup.ConfigFromEnv(rootPath)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("both sources", map[string]string{"HWC_WARMUP_PATHS": "/", "HWC_WARMUP_FILE": "w.json"}, "Set only one of"),
+		Entry("relative path", map[string]string{"HWC_WARMUP_PATHS": "api"}, `path must start with /, got "api"`),
+		Entry("missing file", map[string]string{"HWC_WARMUP_FILE": "missing.json"}, "HWC_WARMUP_FILE:"),
+		Entry("attempts", map[string]string{"HWC_WARMUP_PATHS": "/", "HWC_WARMUP_ATTEMPTS": "0"}, "HWC_WARMUP_ATTEMPTS must be a positive integer"),
+		Entry("interval", map[string]string{"HWC_WARMUP_PATHS": "/", "HWC_WARMUP_INTERVAL": "soon"}, "HWC_WARMUP_INTERVAL must be a positive duration"),
+		Entry("failure", map[string]string{"HWC_WARMUP_PATHS": "/", "HWC_WARMUP_FAILURE": "retry"}, "HWC_WARMUP_FAILURE must be continue or exit"),
+	)
+
+	It("rejects invalid expected statuses", func() {
+		Expect(os.WriteFile(filepath.Join(rootPath, "warmup.json"), []byte(`[{"path": "/", "expectStatus": [42]}]`), 0644)).To(Succeed())
+		Expect(os.Setenv("HWC_WARMUP_FILE", "warmup.json")).To(Succeed())
+
+		_, _, err := warmup.ConfigFromEnv(rootPath)
+		Expect(err).To(MatchError("Invalid warm-up request: /: expectStatus must be HTTP status codes, got 42"))
+	})
+})
@@ -0,0 +1,154 @@
+// Package watchdog probes the site while hwc runs and gives up once it has
+// stopped answering, so that the platform restarts the instance instead of
+// leaving a hung Hosted Web Core in place.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/hwc/logger"
+	"code.cloudfoundry.org/hwc/probe"
+)
+
+// Config configures the watchdog
+type Config struct {
+	// Interval between probes
+	Interval time.Duration
+	// Failures is the number of consecutive failed probes after which the
+	// watchdog gives up
+	Failures int
+	// Path of the site that is probed, relative to the context path
+	Path string
+	// Timeout of each probe
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads HWC_WATCHDOG_INTERVAL, HWC_WATCHDOG_FAILURES,
+// HWC_WATCHDOG_PATH and HWC_WATCHDOG_TIMEOUT. It returns false when
+// HWC_WATCHDOG_INTERVAL is unset.
+func ConfigFromEnv() (Config, bool, error) {
+	config := Config{Failures: 3, Path: "/", Timeout: 10 * time.Second}
+
+	value := os.Getenv("HWC_WATCHDOG_INTERVAL")
+	if value == "" {
+		return config, false, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return config, false, fmt.Errorf("HWC_WATCHDOG_INTERVAL must be a positive duration such as 30s, got %q", value)
+	}
+	config.Interval = interval
+
+	if value := os.Getenv("HWC_WATCHDOG_FAILURES"); value != "" {
+		failures, err := strconv.Atoi(value)
+		if err != nil || failures < 1 {
+			return config, false, fmt.Errorf("HWC_WATCHDOG_FAILURES must be a positive integer, got %q", value)
+		}
+		config.Failures = failures
+	}
+
+	if path := os.Getenv("HWC_WATCHDOG_PATH"); path != "" {
+		if !strings.HasPrefix(path, "/") {
+			return config, false, fmt.Errorf("HWC_WATCHDOG_PATH must start with /, got %q", path)
+		}
+		config.Path = path
+	}
+
+	if value := os.Getenv("HWC_WATCHDOG_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return config, false, fmt.Errorf("HWC_WATCHDOG_TIMEOUT must be a positive duration such as 10s, got %q", value)
+		}
+		config.Timeout = timeout
+	}
+
+	return config, true, nil
+}
+
+// Host is probed by the watchdog; *probe.Prober is one
+type Host interface {
+	Probe(ctx context.Context) probe.Result
+}
+
+// Failure is returned by Run once the site is considered dead
+type Failure struct {
+	// Results of the consecutive failed probes, oldest first
+	Results []probe.Result
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("site stopped answering: %d consecutive probes failed, last: %s",
+		len(f.Results), f.Results[len(f.Results)-1])
+}
+
+// Watchdog probes a host every interval
+type Watchdog struct {
+	host   Host
+	config Config
+	log    *logger.Logger
+}
+
+func New(host Host, config Config, log *logger.Logger) *Watchdog {
+	return &Watchdog{host: host, config: config, log: log}
+}
+
+// Run probes the host until ctx is done or the host has failed
+// config.Failures probes in a row. Failures only count once the host has
+// answered a probe, so a slow start is left to the platform health check,
+// and so is a host that never answers at all. There is no failure event
+// from Hosted Web Core to watch instead: it reports none after activation.
+func (w *Watchdog) Run(ctx context.Context) error {
+	armed := false
+	var failures []probe.Result
+
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		result := w.host.Probe(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if result.Healthy() {
+			if len(failures) > 0 {
+				w.log.Infof("watchdog_recovered", logger.Fields{"url": result.URL, "failures": len(failures)},
+					"HWC watchdog: site answering again after %d failed probe(s)", len(failures))
+			}
+			armed = true
+			failures = nil
+			continue
+		}
+		if !armed {
+			continue
+		}
+
+		failures = append(failures, result)
+		fields := logger.Fields{
+			"url":         result.URL,
+			"status_code": result.StatusCode,
+			"duration_ms": result.Duration.Milliseconds(),
+			"failures":    len(failures),
+		}
+		if result.Err != nil {
+			fields["error"] = result.Err.Error()
+		}
+		w.log.Warnf("watchdog_probe_failed", fields, "HWC watchdog: probe %d of %d failed: %s",
+			len(failures), w.config.Failures, result)
+
+		if len(failures) >= w.config.Failures {
+			return &Failure{Results: failures}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package watchdog_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"code.cloudfoundry.org/hwc/logger"
+	"code.cloudfoundry.org/hwc/probe"
+	"code.cloudfoundry.org/hwc/watchdog"
+)
+
+// fakeHost answers probes with scripted status codes, repeating the last one
+type fakeHost struct {
+	mu       sync.Mutex
+	statuses []int
+	probes   int
+}
+
+func (h *fakeHost) Probe(ctx context.Context) probe.Result {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.statuses[len(h.statuses)-1]
+	if h.probes < len(h.statuses) {
+		status = h.statuses[h.probes]
+	}
+	h.probes++
+
+	if status == 0 {
+		return probe.Result{URL: "http://127.0.0.1:8080/", Err: errors.New("connection refused")}
+	}
+	return probe.Result{URL: "http://127.0.0.1:8080/", StatusCode: status}
+}
+
+func (h *fakeHost) Probes() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.probes
+}
+
+var _ = Describe("Watchdog", func() {
+	var (
+		out    *gbytes.Buffer
+		errOut *gbytes.Buffer
+		log    *logger.Logger
+		config watchdog.Config
+	)
+
+	BeforeEach(func() {
+		out = gbytes.NewBuffer()
+		errOut = gbytes.NewBuffer()
+		log = logger.New(out, errOut)
+		config = watchdog.Config{Interval: time.Millisecond, Failures: 3}
+	})
+
+	It("gives up after consecutive failures", func() {
+		host := &fakeHost{statuses: []int{200, 500, 0, 503}}
+		err := watchdog.New(host, config, log).Run(context.Background())
+
+		var failure *watchdog.Failure
+		Expect(errors.As(err, &failure)).To(BeTrue())
+		Expect(failure.Results).To(HaveLen(3))
+		Expect(err).To(MatchError("site stopped answering: 3 consecutive probes failed, last: http://127.0.0.1:8080/ returned 503 in 0s"))
+		Expect(host.Probes()).To(Equal(4))
+
+		Expect(errOut).To(gbytes.Say(`HWC watchdog: probe 1 of 3 failed: http://127.0.0.1:8080/ returned 500`))
+		Expect(errOut).To(gbytes.Say(`HWC watchdog: probe 2 of 3 failed: .*connection refused`))
+		Expect(errOut).To(gbytes.Say(`HWC watchdog: probe 3 of 3 failed`))
+	})
+
+	It("starts counting again when the site recovers", func() {
+		host := &fakeHost{statuses: []int{200, 500, 500, 200, 500, 500, 500}}
+		err := watchdog.New(host, config, log).Run(context.Background())
+
+		Expect(err).To(HaveOccurred())
+		Expect(host.Probes()).To(Equal(7))
+		Expect(out).To(gbytes.Say("HWC watchdog: site answering again after 2 failed probe"))
+	})
+
+	It("does not count failures before the site has answered", func() {
+		host := &fakeHost{statuses: []int{0, 0, 0, 0, 200, 0, 0, 0}}
+		err := watchdog.New(host, config, log).Run(context.Background())
+
+		Expect(err).To(HaveOccurred())
+		Expect(host.Probes()).To(Equal(8))
+	})
+
+	It("treats client errors as answers", func() {
+		host := &fakeHost{statuses: []int{404}}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- watchdog.New(host, config, log).Run(ctx) }()
+
+		Eventually(host.Probes).Should(BeNumerically(">", 5))
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(errOut.Contents()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ConfigFromEnv", func() {
+	BeforeEach(func() {
+		for _, name := range []string{"HWC_WATCHDOG_INTERVAL", "HWC_WATCHDOG_FAILURES", "HWC_WATCHDOG_PATH", "HWC_WATCHDOG_TIMEOUT"} {
+			value, set := os.LookupEnv(name)
+			DeferCleanup(func() {
+				if set {
+					os.Setenv(name, value)
+				} else {
+					os.Unsetenv(name)
+				}
+			})
+			os.Unsetenv(name)
+		}
+	})
+
+	It("is disabled without an interval", func() {
+		_, enabled, err := watchdog.ConfigFromEnv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeFalse())
+	})
+
+	It("uses defaults", func() {
+		os.Setenv("HWC_WATCHDOG_INTERVAL", "30s")
+		config, enabled, err := watchdog.ConfigFromEnv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(enabled).To(BeTrue())
+		Expect(config).To(Equal(watchdog.Config{Interval: 30 * time.Second, Failures: 3, Path: "/", Timeout: 10 * time.Second}))
+	})
+
+	It("reads every setting", func() {
+		os.Setenv("HWC_WATCHDOG_INTERVAL", "1m")
+		os.Setenv("HWC_WATCHDOG_FAILURES", "5")
+		os.Setenv("HWC_WATCHDOG_PATH", "/ping")
+		os.Setenv("HWC_WATCHDOG_TIMEOUT", "2s")
+		config, _, err := watchdog.ConfigFromEnv()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(Equal(watchdog.Config{Interval: time.Minute, Failures: 5, Path: "/ping", Timeout: 2 * time.Second}))
+	})
+
+	DescribeTable("rejects invalid values",
+		func(name, value, message string) {
+			os.Setenv("HWC_WATCHDOG_INTERVAL", "30s")
+			os.Setenv(name, value)
+			_, _, err := watchdog.ConfigFromEnv()
+			Expect(err).To(MatchError(message))
+		},
+		Entry("interval", "HWC_WATCHDOG_INTERVAL", "often", `HWC_WATCHDOG_INTERVAL must be a positive duration such as 30s, got "often"`),
+		Entry("failures", "HWC_WATCHDOG_FAILURES", "0", `HWC_WATCHDOG_FAILURES must be a positive integer, got "0"`),
+		Entry("path", "HWC_WATCHDOG_PATH", "ping", `HWC_WATCHDOG_PATH must start with /, got "ping"`),
+		Entry("timeout", "HWC_WATCHDOG_TIMEOUT", "-1s", `HWC_WATCHDOG_TIMEOUT must be a positive duration such as 10s, got "-1s"`),
+	)
+})
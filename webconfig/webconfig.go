@@ -0,0 +1,141 @@
+// Package webconfig rewrites the app's Web.config at startup. The file the
+// app shipped with is preserved so that every start rewrites it afresh.
+package webconfig
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/hwc/tokens"
+	"code.cloudfoundry.org/hwc/xdt"
+)
+
+// OriginalName is the name the app's Web.config is preserved under once hwc
+// rewrites it. Its .config extension keeps IIS from serving it.
+const OriginalName = "Web.hwc-original.config"
+
+// Step rewrites the contents of Web.config
+type Step func(data []byte) ([]byte, error)
+
+// Rewrite runs steps over the app's Web.config as shipped and writes the
+// result to Web.config. Without steps, a previously rewritten Web.config is
+// restored.
+func Rewrite(rootPath string, steps ...Step) error {
+	return RewriteFile(filepath.Join(rootPath, "Web.config"), steps...)
+}
+
+// RewriteFile is Rewrite for any config file. The file as shipped is
+// preserved at OriginalPath(path).
+func RewriteFile(path string, steps ...Step) error {
+	originalPath := OriginalPath(path)
+
+	data, err := os.ReadFile(originalPath)
+	preserved := err == nil
+	if os.IsNotExist(err) {
+		data, err = os.ReadFile(path)
+		if os.IsNotExist(err) && len(steps) == 0 {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(steps) == 0 {
+		if !preserved {
+			return nil
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+		return os.Remove(originalPath)
+	}
+
+	if !preserved {
+		if err := os.WriteFile(originalPath, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	for _, step := range steps {
+		data, err = step(data)
+		if err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// OriginalPath returns where the config file at path is preserved once hwc
+// rewrites it, e.g. Web.hwc-original.config for Web.config
+func OriginalPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".hwc-original" + ext
+}
+
+// Transform returns a Step that applies the XDT transform Web.<name>.config
+// in rootPath, writing warnings about transforms that matched nothing to
+// writer
+func Transform(rootPath, name string, writer io.Writer) Step {
+	return func(data []byte) ([]byte, error) {
+		if strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("Invalid Web.config transform name %q", name)
+		}
+
+		transformPath := filepath.Join(rootPath, "Web."+name+".config")
+		transform, err := os.ReadFile(transformPath)
+		if err != nil {
+			return nil, err
+		}
+
+		result, warnings, err := xdt.Apply(data, transform)
+		for _, warning := range warnings {
+			fmt.Fprintf(writer, "Warning: %s: %s\n", filepath.Base(transformPath), warning)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Applying %s: %v", transformPath, err)
+		}
+		return result, nil
+	}
+}
+
+// SubstituteTokens returns a Step that replaces #{NAME} and ${NAME} tokens
+// with the values lookup returns. Unresolved tokens are left in place for
+// validator.ValidateTokens to report.
+func SubstituteTokens(lookup func(name string) (string, bool)) Step {
+	return func(data []byte) ([]byte, error) {
+		result, _ := tokens.Replace(data, lookup)
+		return result, nil
+	}
+}
+
+// ConfigFiles resolves a comma or semicolon separated list of config files
+// relative to rootPath. Files must have a .config extension and lie within
+// rootPath. The root Web.config is rejected, since Rewrite already
+// substitutes its tokens and rewriting it again would discard a transform.
+func ConfigFiles(rootPath, list string) ([]string, error) {
+	var paths []string
+	for _, name := range strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ';' }) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !strings.EqualFold(filepath.Ext(name), ".config") {
+			return nil, fmt.Errorf("%s is not a .config file", name)
+		}
+
+		path := filepath.Join(rootPath, filepath.FromSlash(name))
+		rel, err := filepath.Rel(rootPath, path)
+		if err != nil || filepath.IsAbs(name) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s is outside the app root", name)
+		}
+		if strings.EqualFold(rel, "Web.config") {
+			return nil, fmt.Errorf("%s is the app's Web.config, whose tokens HWC_CONFIG_TOKENS already substitutes", name)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,222 @@
+package webconfig_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	"code.cloudfoundry.org/hwc/webconfig"
+)
+
+const shipped = `<configuration>
+  <system.web>
+    <compilation debug="true" />
+  </system.web>
+</configuration>`
+
+const releaseTransform = `<configuration xmlns:xdt="http://schemas.microsoft.com/XML-Document-Transform">
+  <system.web>
+    <compilation xdt:Transform="RemoveAttributes(debug)" />
+    <customErrors mode="Off" xdt:Transform="Remove" />
+  </system.web>
+</configuration>`
+
+var _ = Describe("Rewrite", func() {
+	var (
+		rootPath      string
+		webConfigPath string
+		originalPath  string
+		output        *gbytes.Buffer
+	)
+
+	readFile := func(path string) string {
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		return string(data)
+	}
+
+	BeforeEach(func() {
+		var err error
+		rootPath, err = os.MkdirTemp("", "webconfig")
+		Expect(err).ToNot(HaveOccurred())
+
+		webConfigPath = filepath.Join(rootPath, "Web.config")
+		originalPath = filepath.Join(rootPath, webconfig.OriginalName)
+		output = gbytes.NewBuffer()
+
+		Expect(os.WriteFile(webConfigPath, []byte(shipped), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(rootPath, "Web.Release.config"), []byte(releaseTransform), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(rootPath)).To(Succeed())
+	})
+
+	It("leaves Web.config alone without steps", func() {
+		Expect(webconfig.Rewrite(rootPath)).To(Succeed())
+		Expect(readFile(webConfigPath)).To(Equal(shipped))
+		Expect(originalPath).ToNot(BeAnExistingFile())
+	})
+
+	It("succeeds without steps when there is no Web.config", func() {
+		Expect(os.Remove(webConfigPath)).To(Succeed())
+		Expect(webconfig.Rewrite(rootPath)).To(Succeed())
+	})
+
+	It("preserves the shipped Web.config and writes the transformed one", func() {
+		Expect(webconfig.Rewrite(rootPath, webconfig.Transform(rootPath, "Release", output))).To(Succeed())
+
+		Expect(readFile(originalPath)).To(Equal(shipped))
+		Expect(readFile(webConfigPath)).To(ContainSubstring(`<compilation />`))
+		Expect(output).To(gbytes.Say(`Warning: Web.Release.config: No element in the source document matches /configuration/system.web/customErrors`))
+	})
+
+	It("transforms the shipped Web.config on every start", func() {
+		step := func(data []byte) ([]byte, error) {
+			return append(data, "<!-- rewritten -->"...), nil
+		}
+		Expect(webconfig.Rewrite(rootPath, step)).To(Succeed())
+		Expect(webconfig.Rewrite(rootPath, step)).To(Succeed())
+
+		Expect(readFile(webConfigPath)).To(Equal(shipped + "<!-- rewritten -->"))
+		Expect(readFile(originalPath)).To(Equal(shipped))
+	})
+
+	It("restores the shipped Web.config when the steps are removed", func() {
+		Expect(webconfig.Rewrite(rootPath, webconfig.Transform(rootPath, "Release", output))).To(Succeed())
+		Expect(webconfig.Rewrite(rootPath)).To(Succeed())
+
+		Expect(readFile(webConfigPath)).To(Equal(shipped))
+		Expect(originalPath).ToNot(BeAnExistingFile())
+	})
+
+	It("fails when a step fails", func() {
+		step := func(data []byte) ([]byte, error) {
+			return nil, errors.New("step failed")
+		}
+		Expect(webconfig.Rewrite(rootPath, step)).To(MatchError("step failed"))
+		Expect(readFile(webConfigPath)).To(Equal(shipped))
+	})
+
+	It("fails with steps when there is no Web.config", func() {
+		Expect(os.Remove(webConfigPath)).To(Succeed())
+		Expect(webconfig.Rewrite(rootPath, webconfig.Transform(rootPath, "Release", output))).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Transform", func() {
+	var rootPath string
+
+	BeforeEach(func() {
+		var err error
+		rootPath, err = os.MkdirTemp("", "webconfig")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(rootPath)).To(Succeed())
+	})
+
+	It("fails when the transform does not exist", func() {
+		_, err := webconfig.Transform(rootPath, "Cloud", gbytes.NewBuffer())([]byte(shipped))
+		Expect(err).To(HaveOccurred())
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("rejects names containing path separators", func() {
+		_, err := webconfig.Transform(rootPath, `..\Cloud`, gbytes.NewBuffer())([]byte(shipped))
+		Expect(err).To(MatchError(`Invalid Web.config transform name "..\\Cloud"`))
+	})
+
+	It("fails on an invalid transform", func() {
+		Expect(os.WriteFile(filepath.Join(rootPath, "Web.Cloud.config"), []byte("<configuration>"), 0644)).To(Succeed())
+		_, err := webconfig.Transform(rootPath, "Cloud", gbytes.NewBuffer())([]byte(shipped))
+		Expect(err).To(MatchError(ContainSubstring("Web.Cloud.config: parsing transform document")))
+	})
+})
+
+var _ = Describe("SubstituteTokens", func() {
+	var rootPath string
+
+	BeforeEach(func() {
+		var err error
+		rootPath, err = os.MkdirTemp("", "webconfig")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(rootPath)).To(Succeed())
+	})
+
+	lookup := func(name string) (string, bool) {
+		if name == "REGION" {
+			return "eu & us", true
+		}
+		return "", false
+	}
+
+	It("substitutes tokens in any config file and keeps the original", func() {
+		path := filepath.Join(rootPath, "App_Config", "settings.config")
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(`<appSettings><add key="Region" value="#{REGION}" /><add key="Zone" value="${ZONE}" /></appSettings>`), 0644)).To(Succeed())
+
+		Expect(webconfig.RewriteFile(path, webconfig.SubstituteTokens(lookup))).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(Equal(`<appSettings><add key="Region" value="eu &amp; us" /><add key="Zone" value="${ZONE}" /></appSettings>`))
+		Expect(filepath.Join(rootPath, "App_Config", "settings.hwc-original.config")).To(BeAnExistingFile())
+	})
+
+	It("substitutes tokens introduced by a transform", func() {
+		Expect(os.WriteFile(filepath.Join(rootPath, "Web.config"), []byte(shipped), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(rootPath, "Web.Cloud.config"), []byte(`<configuration xmlns:xdt="http://schemas.microsoft.com/XML-Document-Transform">
+  <appSettings xdt:Transform="Insert"><add key="Region" value="#{REGION}" /></appSettings>
+</configuration>`), 0644)).To(Succeed())
+
+		Expect(webconfig.Rewrite(rootPath,
+			webconfig.Transform(rootPath, "Cloud", gbytes.NewBuffer()),
+			webconfig.SubstituteTokens(lookup),
+		)).To(Succeed())
+
+		data, err := os.ReadFile(filepath.Join(rootPath, "Web.config"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`<add key="Region" value="eu &amp; us" />`))
+	})
+})
+
+var _ = Describe("ConfigFiles", func() {
+	It("resolves files relative to the app root", func() {
+		paths, err := webconfig.ConfigFiles("/app", "connectionStrings.config; App_Config/settings.config,")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(paths).To(Equal([]string{
+			filepath.Join("/app", "connectionStrings.config"),
+			filepath.Join("/app", "App_Config", "settings.config"),
+		}))
+	})
+
+	It("rejects files that are not .config files", func() {
+		_, err := webconfig.ConfigFiles("/app", "appsettings.json")
+		Expect(err).To(MatchError("appsettings.json is not a .config file"))
+	})
+
+	It("rejects files outside the app root", func() {
+		_, err := webconfig.ConfigFiles("/app", "../other/Web.config")
+		Expect(err).To(MatchError("../other/Web.config is outside the app root"))
+	})
+
+	It("rejects the app's Web.config", func() {
+		_, err := webconfig.ConfigFiles("/app", "connectionStrings.config,web.CONFIG")
+		Expect(err).To(MatchError("web.CONFIG is the app's Web.config, whose tokens HWC_CONFIG_TOKENS already substitutes"))
+	})
+
+	It("accepts the Web.config of a subdirectory", func() {
+		paths, err := webconfig.ConfigFiles("/app", "Views/Web.config")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(paths).To(Equal([]string{filepath.Join("/app", "Views", "Web.config")}))
+	})
+})
@@ -8,8 +8,21 @@ import (
 	"os"
 	"syscall"
 	"unsafe"
+
+	"code.cloudfoundry.org/hwc/logger"
 )
 
+// Error is returned when a call into hwebcore.dll fails, carrying the code
+// it returned
+type Error struct {
+	message string
+	Code    uintptr
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
 type WebCore struct {
 	activated bool
 	Handle    syscall.Handle
@@ -52,13 +65,13 @@ func (w *WebCore) Activate(appHostConfigPath, rootWebConfigPath, instanceName st
 			uintptr(unsafe.Pointer(rootWebConfigPathPtr)),
 			uintptr(unsafe.Pointer(instanceNamePtr)))
 		if exitCode != 0 {
-			return fmt.Errorf("WebCoreActivate returned exit code: %d", exitCode)
+			return &Error{message: fmt.Sprintf("WebCoreActivate returned exit code: %d", exitCode), Code: uintptr(exitCode)}
 		}
 		if r1 != 0 {
-			return fmt.Errorf("HWC Failed to start: return code: 0x%02x", r1)
+			return &Error{message: fmt.Sprintf("HWC Failed to start: return code: 0x%02x", r1), Code: r1}
 		}
 
-		fmt.Printf("Server Started for %+v\n", instanceName)
+		logger.Infof("server_started", nil, "Server Started for %+v", instanceName)
 		w.activated = true
 	}
 
@@ -75,9 +88,9 @@ func (w *WebCore) Shutdown(immediate int, instanceName string) error {
 		_, _, exitCode := syscall.SyscallN(uintptr(webCoreShutdown),
 			uintptr(unsafe.Pointer(&immediate)), 0, 0)
 		if exitCode != 0 {
-			return fmt.Errorf("WebCoreShutdown returned exit code: %d", exitCode)
+			return &Error{message: fmt.Sprintf("WebCoreShutdown returned exit code: %d", exitCode), Code: uintptr(exitCode)}
 		}
-		fmt.Printf("Server Shutdown for %+v\n", instanceName)
+		logger.Infof("server_shutdown", nil, "Server Shutdown for %+v", instanceName)
 	}
 
 	return nil
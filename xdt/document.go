@@ -0,0 +1,296 @@
+package xdt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type nodeKind int
+
+const (
+	documentNode nodeKind = iota
+	elementNode
+	textNode
+	commentNode
+	procInstNode
+	directiveNode
+)
+
+type attr struct {
+	name  string
+	value string
+}
+
+// node is a minimal DOM that keeps prefixes, comments and whitespace so that
+// a transformed document differs from its source only where it was changed
+type node struct {
+	kind   nodeKind
+	name   string
+	attrs  []attr
+	text   string
+	parent *node
+
+	children []*node
+	// selfClosing records that an element was written as <name />
+	selfClosing bool
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+func parse(data []byte) (*node, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	doc := &node{kind: documentNode}
+	current := doc
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := &node{kind: elementNode, name: qualifiedName(t.Name)}
+			for _, a := range t.Attr {
+				element.attrs = append(element.attrs, attr{name: qualifiedName(a.Name), value: a.Value})
+			}
+			offset := decoder.InputOffset()
+			element.selfClosing = offset >= 2 && string(data[offset-2:offset]) == "/>"
+			current.appendChild(element)
+			current = element
+		case xml.EndElement:
+			if current.kind != elementNode || current.name != qualifiedName(t.Name) {
+				return nil, fmt.Errorf("unexpected end element </%s>", qualifiedName(t.Name))
+			}
+			current = current.parent
+		case xml.CharData:
+			current.appendChild(&node{kind: textNode, text: string(t)})
+		case xml.Comment:
+			current.appendChild(&node{kind: commentNode, text: string(t)})
+		case xml.ProcInst:
+			current.appendChild(&node{kind: procInstNode, name: t.Target, text: string(t.Inst)})
+		case xml.Directive:
+			current.appendChild(&node{kind: directiveNode, text: string(t)})
+		}
+	}
+
+	if current != doc {
+		return nil, fmt.Errorf("element <%s> is not closed", current.name)
+	}
+	if doc.root() == nil {
+		return nil, fmt.Errorf("document has no root element")
+	}
+	return doc, nil
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// root returns the document element
+func (n *node) root() *node {
+	for _, child := range n.children {
+		if child.kind == elementNode {
+			return child
+		}
+	}
+	return nil
+}
+
+func (n *node) elements() []*node {
+	var elements []*node
+	for _, child := range n.children {
+		if child.kind == elementNode {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+func (n *node) attr(name string) (string, bool) {
+	for _, a := range n.attrs {
+		if a.name == name {
+			return a.value, true
+		}
+	}
+	return "", false
+}
+
+func (n *node) setAttr(name, value string) {
+	for i := range n.attrs {
+		if n.attrs[i].name == name {
+			n.attrs[i].value = value
+			return
+		}
+	}
+	n.attrs = append(n.attrs, attr{name: name, value: value})
+}
+
+func (n *node) removeAttr(name string) bool {
+	for i := range n.attrs {
+		if n.attrs[i].name == name {
+			n.attrs = append(n.attrs[:i], n.attrs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (n *node) appendChild(child *node) {
+	child.parent = n
+	n.children = append(n.children, child)
+}
+
+func (n *node) insertChildren(i int, children ...*node) {
+	for _, child := range children {
+		child.parent = n
+	}
+	n.children = append(n.children[:i], append(children, n.children[i:]...)...)
+}
+
+func (n *node) index() int {
+	for i, sibling := range n.parent.children {
+		if sibling == n {
+			return i
+		}
+	}
+	return -1
+}
+
+// replaceWith puts replacement in the place of n
+func (n *node) replaceWith(replacement *node) {
+	replacement.parent = n.parent
+	n.parent.children[n.index()] = replacement
+	n.parent = nil
+}
+
+// remove detaches n along with the indentation preceding it
+func (n *node) remove() {
+	parent := n.parent
+	i := n.index()
+	start := i
+	if i > 0 && isWhitespace(parent.children[i-1]) {
+		start--
+	}
+	parent.children = append(parent.children[:start], parent.children[i+1:]...)
+	n.parent = nil
+}
+
+// appendElement adds child after the last child of n, indenting it like its
+// siblings
+func (n *node) appendElement(child *node) {
+	elements := n.elements()
+	if len(elements) > 0 {
+		last := elements[len(elements)-1]
+		i := last.index()
+		var nodes []*node
+		if i > 0 && isWhitespace(n.children[i-1]) {
+			nodes = append(nodes, &node{kind: textNode, text: n.children[i-1].text})
+		}
+		n.insertChildren(i+1, append(nodes, child)...)
+		return
+	}
+
+	indent := ""
+	if n.parent != nil {
+		if i := n.index(); i > 0 && isWhitespace(n.parent.children[i-1]) && strings.Contains(n.parent.children[i-1].text, "\n") {
+			indent = n.parent.children[i-1].text
+		}
+	}
+	if indent == "" || len(n.children) > 0 && !(len(n.children) == 1 && isWhitespace(n.children[0])) {
+		n.appendChild(child)
+		return
+	}
+
+	n.children = nil
+	n.appendChild(&node{kind: textNode, text: indent + "  "})
+	n.appendChild(child)
+	n.appendChild(&node{kind: textNode, text: indent})
+	n.selfClosing = false
+}
+
+func (n *node) clone() *node {
+	c := &node{kind: n.kind, name: n.name, text: n.text, selfClosing: n.selfClosing}
+	c.attrs = append(c.attrs, n.attrs...)
+	for _, child := range n.children {
+		c.appendChild(child.clone())
+	}
+	return c
+}
+
+func isWhitespace(n *node) bool {
+	return n.kind == textNode && strings.TrimSpace(n.text) == ""
+}
+
+func (n *node) bytes() []byte {
+	var buf bytes.Buffer
+	n.write(&buf)
+	return buf.Bytes()
+}
+
+func (n *node) write(buf *bytes.Buffer) {
+	switch n.kind {
+	case documentNode:
+		for _, child := range n.children {
+			child.write(buf)
+		}
+	case elementNode:
+		buf.WriteString("<" + n.name)
+		for _, a := range n.attrs {
+			buf.WriteString(" " + a.name + `="` + escapeAttr(a.value) + `"`)
+		}
+		if len(n.children) == 0 && n.selfClosing {
+			buf.WriteString(" />")
+			return
+		}
+		buf.WriteString(">")
+		for _, child := range n.children {
+			child.write(buf)
+		}
+		buf.WriteString("</" + n.name + ">")
+	case textNode:
+		buf.WriteString(escapeText(n.text))
+	case commentNode:
+		buf.WriteString("<!--" + n.text + "-->")
+	case procInstNode:
+		buf.WriteString("<?" + n.name)
+		if n.text != "" {
+			buf.WriteString(" " + n.text)
+		}
+		buf.WriteString("?>")
+	case directiveNode:
+		buf.WriteString("<!" + n.text + ">")
+	}
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+var attrEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	`"`, "&quot;",
+	"\n", "&#xA;",
+	"\r", "&#xD;",
+	"\t", "&#x9;",
+)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
@@ -0,0 +1,284 @@
+package xdt
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// locator selects which of the source elements with the same name as a
+// transform element it applies to
+type locator struct {
+	description string
+	matches     func(*node) bool
+}
+
+// parseLocator parses an xdt:Locator value for the transform element el. Only
+// Match and Condition are supported; XPath locators need a full XPath engine.
+func parseLocator(value string, el *node) (*locator, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	name, arg, err := splitCall(value)
+	if err != nil {
+		return nil, fmt.Errorf("xdt:Locator %q: %v", value, err)
+	}
+
+	switch name {
+	case "Match":
+		names := splitArgs(arg)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("xdt:Locator %q: Match requires at least one attribute", value)
+		}
+
+		var predicates []string
+		want := map[string]string{}
+		for _, attrName := range names {
+			attrValue, ok := el.attr(attrName)
+			if !ok {
+				return nil, fmt.Errorf("xdt:Locator %q: <%s> has no %s attribute to match", value, el.name, attrName)
+			}
+			want[attrName] = attrValue
+			predicates = append(predicates, fmt.Sprintf("@%s='%s'", attrName, attrValue))
+		}
+
+		return &locator{
+			description: "[" + strings.Join(predicates, " and ") + "]",
+			matches: func(n *node) bool {
+				for attrName, attrValue := range want {
+					if v, ok := n.attr(attrName); !ok || v != attrValue {
+						return false
+					}
+				}
+				return true
+			},
+		}, nil
+	case "Condition":
+		condition, err := parseCondition(arg)
+		if err != nil {
+			return nil, fmt.Errorf("xdt:Locator %q: %v", value, err)
+		}
+		return &locator{description: "[" + strings.TrimSpace(arg) + "]", matches: condition}, nil
+	default:
+		return nil, fmt.Errorf("xdt:Locator %q: unsupported locator %s", value, name)
+	}
+}
+
+// splitCall splits Name(args) into its name and argument text
+func splitCall(value string) (string, string, error) {
+	value = strings.TrimSpace(value)
+	open := strings.Index(value, "(")
+	if open < 0 {
+		return value, "", nil
+	}
+	if !strings.HasSuffix(value, ")") {
+		return "", "", fmt.Errorf("missing closing parenthesis")
+	}
+	return strings.TrimSpace(value[:open]), value[open+1 : len(value)-1], nil
+}
+
+func splitArgs(arg string) []string {
+	var args []string
+	for _, a := range strings.Split(arg, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+// parseCondition compiles the subset of XPath predicates that Condition
+// locators use in practice: attribute existence and (in)equality with string
+// literals, combined with and, or, not() and parentheses.
+func parseCondition(expr string) (func(*node) bool, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &conditionParser{tokens: tokens}
+	condition, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q in condition", p.peek())
+	}
+	return condition, nil
+}
+
+type conditionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *conditionParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *conditionParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *conditionParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *conditionParser) expect(token string) error {
+	if got := p.next(); got != token {
+		if got == "" {
+			return fmt.Errorf("expected %q at end of condition", token)
+		}
+		return fmt.Errorf("expected %q in condition, got %q", token, got)
+	}
+	return nil
+}
+
+func (p *conditionParser) parseOr() (func(*node) bool, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(n *node) bool { return l(n) || right(n) }
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (func(*node) bool, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(n *node) bool { return l(n) && right(n) }
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseUnary() (func(*node) bool, error) {
+	switch token := p.next(); token {
+	case "not":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return func(n *node) bool { return !inner(n) }, nil
+	case "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case "@":
+		return p.parseComparison()
+	case "":
+		return nil, fmt.Errorf("unexpected end of condition")
+	default:
+		return nil, fmt.Errorf("unsupported expression %q in condition", token)
+	}
+}
+
+func (p *conditionParser) parseComparison() (func(*node) bool, error) {
+	name := p.next()
+	if !isNameToken(name) {
+		return nil, fmt.Errorf("expected attribute name after @, got %q", name)
+	}
+
+	op := p.peek()
+	if op != "=" && op != "!=" {
+		return func(n *node) bool {
+			_, ok := n.attr(name)
+			return ok
+		}, nil
+	}
+	p.next()
+
+	literal := p.next()
+	if len(literal) < 2 || (literal[0] != '\'' && literal[0] != '"') {
+		return nil, fmt.Errorf("expected string literal after %s, got %q", op, literal)
+	}
+	want := literal[1 : len(literal)-1]
+
+	if op == "=" {
+		return func(n *node) bool {
+			v, ok := n.attr(name)
+			return ok && v == want
+		}, nil
+	}
+	return func(n *node) bool {
+		v, ok := n.attr(name)
+		return ok && v != want
+	}, nil
+}
+
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '@' || c == '(' || c == ')' || c == '=' || c == ',':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '!':
+			if i+1 >= len(expr) || expr[i+1] != '=' {
+				return nil, fmt.Errorf("unexpected ! in condition")
+			}
+			tokens = append(tokens, "!=")
+			i += 2
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string literal in condition")
+			}
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		case isNameChar(rune(c)):
+			start := i
+			for i < len(expr) && isNameChar(rune(expr[i])) {
+				i++
+			}
+			tokens = append(tokens, expr[start:i])
+		default:
+			return nil, fmt.Errorf("unsupported character %q in condition", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isNameChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' || r == ':'
+}
+
+func isNameToken(token string) bool {
+	return token != "" && isNameChar(rune(token[0]))
+}
@@ -0,0 +1,226 @@
+// Package xdt applies XML Document Transforms, the Web.<Configuration>.config
+// files Visual Studio applies to Web.config when publishing an app.
+package xdt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Namespace is the XML namespace of the xdt:Transform and xdt:Locator
+// attributes
+const Namespace = "http://schemas.microsoft.com/XML-Document-Transform"
+
+// Apply transforms source with the XDT document transform. It supports the
+// Replace, Insert, InsertIfMissing, Remove, RemoveAll, SetAttributes and
+// RemoveAttributes transforms and the Match and Condition locators. Transforms
+// whose target is missing from source are reported as warnings, as Visual
+// Studio does, rather than failing.
+func Apply(source, transform []byte) ([]byte, []string, error) {
+	src, err := parse(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing source document: %v", err)
+	}
+	tr, err := parse(transform)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing transform document: %v", err)
+	}
+
+	t := &transformer{prefixes: xdtPrefixes(tr)}
+	if err := t.apply(tr.root(), []*node{src}, ""); err != nil {
+		return nil, t.warnings, err
+	}
+
+	result := src.bytes()
+	if bytes.HasPrefix(source, utf8BOM) {
+		result = append(append([]byte{}, utf8BOM...), result...)
+	}
+	return result, t.warnings, nil
+}
+
+type transformer struct {
+	// prefixes are the namespace prefixes bound to Namespace in the transform
+	prefixes map[string]bool
+	warnings []string
+}
+
+func xdtPrefixes(doc *node) map[string]bool {
+	prefixes := map[string]bool{}
+	var walk func(*node)
+	walk = func(n *node) {
+		for _, a := range n.attrs {
+			if strings.HasPrefix(a.name, "xmlns:") && a.value == Namespace {
+				prefixes[strings.TrimPrefix(a.name, "xmlns:")] = true
+			}
+		}
+		for _, child := range n.elements() {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return prefixes
+}
+
+// isXdtAttr reports whether name is an xdt attribute or declares the xdt
+// namespace, neither of which belong in the transformed document
+func (t *transformer) isXdtAttr(a attr) bool {
+	if prefix, _, ok := strings.Cut(a.name, ":"); ok && t.prefixes[prefix] {
+		return true
+	}
+	return strings.HasPrefix(a.name, "xmlns:") && a.value == Namespace
+}
+
+func (t *transformer) xdtAttr(el *node, local string) string {
+	for _, a := range el.attrs {
+		if prefix, name, ok := strings.Cut(a.name, ":"); ok && t.prefixes[prefix] && name == local {
+			return a.value
+		}
+	}
+	return ""
+}
+
+// content returns a copy of the transform element el without xdt attributes
+func (t *transformer) content(el *node) *node {
+	c := el.clone()
+	var strip func(*node)
+	strip = func(n *node) {
+		attrs := n.attrs[:0]
+		for _, a := range n.attrs {
+			if !t.isXdtAttr(a) {
+				attrs = append(attrs, a)
+			}
+		}
+		n.attrs = attrs
+		for _, child := range n.elements() {
+			strip(child)
+		}
+	}
+	strip(c)
+	return c
+}
+
+func (t *transformer) warn(format string, args ...interface{}) {
+	t.warnings = append(t.warnings, fmt.Sprintf(format, args...))
+}
+
+// apply applies the transform element el to the children of parents that it
+// selects, then descends into its children
+func (t *transformer) apply(el *node, parents []*node, parentPath string) error {
+	loc, err := parseLocator(t.xdtAttr(el, "Locator"), el)
+	if err != nil {
+		return err
+	}
+
+	path := parentPath + "/" + el.name
+	if loc != nil {
+		path += loc.description
+	}
+
+	selected := func(parent *node) []*node {
+		var targets []*node
+		for _, child := range parent.elements() {
+			if child.name == el.name && (loc == nil || loc.matches(child)) {
+				targets = append(targets, child)
+			}
+		}
+		return targets
+	}
+
+	var targets []*node
+	for _, parent := range parents {
+		targets = append(targets, selected(parent)...)
+	}
+
+	transform, arg, err := splitCall(t.xdtAttr(el, "Transform"))
+	if err != nil {
+		return fmt.Errorf("xdt:Transform on %s: %v", path, err)
+	}
+
+	switch transform {
+	case "":
+	case "Replace":
+		if len(targets) == 0 {
+			t.warn("No element in the source document matches %s", path)
+			return nil
+		}
+		targets[0].replaceWith(t.content(el))
+		return nil
+	case "Insert":
+		if len(parents) == 0 {
+			t.warn("No element in the source document matches %s", parentPath)
+		}
+		for _, parent := range parents {
+			parent.appendElement(t.content(el))
+		}
+		return nil
+	case "InsertIfMissing":
+		if len(parents) == 0 {
+			t.warn("No element in the source document matches %s", parentPath)
+		}
+		for _, parent := range parents {
+			if len(selected(parent)) == 0 {
+				parent.appendElement(t.content(el))
+			}
+		}
+		return nil
+	case "Remove":
+		if len(targets) == 0 {
+			t.warn("No element in the source document matches %s", path)
+			return nil
+		}
+		targets[0].remove()
+		return nil
+	case "RemoveAll":
+		if len(targets) == 0 {
+			t.warn("No element in the source document matches %s", path)
+		}
+		for _, target := range targets {
+			target.remove()
+		}
+		return nil
+	case "SetAttributes":
+		if len(targets) == 0 {
+			t.warn("No element in the source document matches %s", path)
+		}
+		names := splitArgs(arg)
+		if len(names) == 0 {
+			for _, a := range el.attrs {
+				if !t.isXdtAttr(a) {
+					names = append(names, a.name)
+				}
+			}
+		}
+		for _, name := range names {
+			value, ok := el.attr(name)
+			if !ok {
+				return fmt.Errorf("xdt:Transform on %s: SetAttributes names %s, which the transform element does not set", path, name)
+			}
+			for _, target := range targets {
+				target.setAttr(name, value)
+			}
+		}
+	case "RemoveAttributes":
+		names := splitArgs(arg)
+		if len(names) == 0 {
+			return fmt.Errorf("xdt:Transform on %s: RemoveAttributes requires at least one attribute", path)
+		}
+		if len(targets) == 0 {
+			t.warn("No element in the source document matches %s", path)
+		}
+		for _, target := range targets {
+			for _, name := range names {
+				target.removeAttr(name)
+			}
+		}
+	default:
+		return fmt.Errorf("xdt:Transform on %s: unsupported transform %s", path, transform)
+	}
+
+	for _, child := range el.elements() {
+		if err := t.apply(child, targets, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
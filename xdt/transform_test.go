@@ -0,0 +1,343 @@
+package xdt_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/hwc/xdt"
+)
+
+const source = `<?xml version="1.0" encoding="utf-8"?>
+<configuration>
+  <!-- app settings -->
+  <appSettings>
+    <add key="Environment" value="Development" />
+    <add key="Debug" value="true" />
+  </appSettings>
+  <connectionStrings>
+    <add name="Orders" connectionString="Server=localhost;Database=orders" providerName="System.Data.SqlClient" />
+  </connectionStrings>
+  <system.web>
+    <compilation debug="true" targetFramework="4.8" />
+    <customErrors mode="Off" />
+  </system.web>
+</configuration>`
+
+func transform(body string) string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<configuration xmlns:xdt="http://schemas.microsoft.com/XML-Document-Transform">` + body + `</configuration>`
+}
+
+func apply(body string) (string, []string) {
+	result, warnings, err := xdt.Apply([]byte(source), []byte(transform(body)))
+	Expect(err).ToNot(HaveOccurred())
+	return string(result), warnings
+}
+
+var _ = Describe("Apply", func() {
+	It("leaves the source unchanged by an empty transform", func() {
+		result, warnings := apply("")
+		Expect(result).To(Equal(source))
+		Expect(warnings).To(BeEmpty())
+	})
+
+	Describe("Replace", func() {
+		It("replaces the matched element without xdt attributes", func() {
+			result, _ := apply(`
+  <system.web>
+    <customErrors mode="RemoteOnly" defaultRedirect="error.html" xdt:Transform="Replace" />
+  </system.web>`)
+			Expect(result).To(ContainSubstring(`    <customErrors mode="RemoteOnly" defaultRedirect="error.html" />`))
+			Expect(result).ToNot(ContainSubstring(`mode="Off"`))
+			Expect(result).ToNot(ContainSubstring("xdt"))
+		})
+
+		It("replaces only the first of several matches", func() {
+			result, _ := apply(`
+  <appSettings>
+    <add key="Replaced" value="x" xdt:Transform="Replace" />
+  </appSettings>`)
+			Expect(result).To(ContainSubstring(`<add key="Replaced" value="x" />`))
+			Expect(result).ToNot(ContainSubstring(`key="Environment"`))
+			Expect(result).To(ContainSubstring(`<add key="Debug" value="true" />`))
+		})
+
+		It("warns when nothing matches", func() {
+			result, warnings := apply(`
+  <system.webServer xdt:Transform="Replace" />`)
+			Expect(result).To(Equal(source))
+			Expect(warnings).To(ConsistOf("No element in the source document matches /configuration/system.webServer"))
+		})
+	})
+
+	Describe("Insert", func() {
+		It("appends the element after its siblings with the same indentation", func() {
+			result, _ := apply(`
+  <appSettings>
+    <add key="Region" value="eu" xdt:Transform="Insert" />
+  </appSettings>`)
+			Expect(result).To(ContainSubstring(`    <add key="Debug" value="true" />
+    <add key="Region" value="eu" />
+  </appSettings>`))
+		})
+
+		It("inserts nested content", func() {
+			result, _ := apply(`
+  <system.webServer xdt:Transform="Insert"><httpErrors errorMode="Custom" /></system.webServer>`)
+			Expect(result).To(ContainSubstring(`  </system.web>
+  <system.webServer><httpErrors errorMode="Custom" /></system.webServer>
+</configuration>`))
+		})
+
+		It("indents the first child of an empty element", func() {
+			result, _, err := xdt.Apply([]byte("<configuration>\n  <appSettings />\n</configuration>"), []byte(transform(`
+  <appSettings><add key="A" value="1" xdt:Transform="Insert" /></appSettings>`)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(result)).To(Equal("<configuration>\n  <appSettings>\n    <add key=\"A\" value=\"1\" />\n  </appSettings>\n</configuration>"))
+		})
+
+		It("warns when the parent does not exist", func() {
+			_, warnings := apply(`
+  <system.webServer><handlers><add name="x" xdt:Transform="Insert" /></handlers></system.webServer>`)
+			Expect(warnings).To(ConsistOf("No element in the source document matches /configuration/system.webServer/handlers"))
+		})
+	})
+
+	Describe("InsertIfMissing", func() {
+		It("inserts an element that is not there", func() {
+			result, _ := apply(`
+  <appSettings>
+    <add key="Region" value="eu" xdt:Transform="InsertIfMissing" xdt:Locator="Match(key)" />
+  </appSettings>`)
+			Expect(result).To(ContainSubstring(`<add key="Region" value="eu" />`))
+		})
+
+		It("does nothing when the element is there", func() {
+			result, _ := apply(`
+  <appSettings>
+    <add key="Debug" value="false" xdt:Transform="InsertIfMissing" xdt:Locator="Match(key)" />
+  </appSettings>`)
+			Expect(result).To(Equal(source))
+		})
+	})
+
+	Describe("Remove", func() {
+		It("removes the first matched element and its indentation", func() {
+			result, _ := apply(`
+  <appSettings>
+    <add xdt:Transform="Remove" />
+  </appSettings>`)
+			Expect(result).To(ContainSubstring(`  <appSettings>
+    <add key="Debug" value="true" />
+  </appSettings>`))
+		})
+
+		It("warns when nothing matches", func() {
+			_, warnings := apply(`
+  <appSettings>
+    <add key="Missing" xdt:Transform="Remove" xdt:Locator="Match(key)" />
+  </appSettings>`)
+			Expect(warnings).To(ConsistOf("No element in the source document matches /configuration/appSettings/add[@key='Missing']"))
+		})
+	})
+
+	Describe("RemoveAll", func() {
+		It("removes every matched element", func() {
+			result, _ := apply(`
+  <appSettings>
+    <add xdt:Transform="RemoveAll" />
+  </appSettings>`)
+			Expect(result).To(ContainSubstring("  <appSettings>\n  </appSettings>"))
+		})
+	})
+
+	Describe("SetAttributes", func() {
+		It("sets the named attributes", func() {
+			result, _ := apply(`
+  <system.web>
+    <compilation debug="false" targetFramework="4.7" xdt:Transform="SetAttributes(debug)" />
+  </system.web>`)
+			Expect(result).To(ContainSubstring(`<compilation debug="false" targetFramework="4.8" />`))
+		})
+
+		It("sets every attribute of the transform element when none are named", func() {
+			result, _ := apply(`
+  <system.web>
+    <compilation debug="false" batch="false" xdt:Transform="SetAttributes" />
+  </system.web>`)
+			Expect(result).To(ContainSubstring(`<compilation debug="false" targetFramework="4.8" batch="false" />`))
+		})
+
+		It("escapes attribute values", func() {
+			result, _ := apply(`
+  <connectionStrings>
+    <add name="Orders" connectionString="Server=db;Password=&quot;a&amp;b&lt;c&quot;" xdt:Transform="SetAttributes(connectionString)" xdt:Locator="Match(name)" />
+  </connectionStrings>`)
+			Expect(result).To(ContainSubstring(`connectionString="Server=db;Password=&quot;a&amp;b&lt;c&quot;"`))
+		})
+
+		It("fails when a named attribute is not set on the transform element", func() {
+			_, _, err := xdt.Apply([]byte(source), []byte(transform(`
+  <system.web>
+    <compilation xdt:Transform="SetAttributes(debug)" />
+  </system.web>`)))
+			Expect(err).To(MatchError(ContainSubstring("SetAttributes names debug")))
+		})
+	})
+
+	Describe("RemoveAttributes", func() {
+		It("removes the named attributes", func() {
+			result, _ := apply(`
+  <system.web>
+    <compilation xdt:Transform="RemoveAttributes(debug, batch)" />
+  </system.web>`)
+			Expect(result).To(ContainSubstring(`<compilation targetFramework="4.8" />`))
+		})
+
+		It("fails without attribute names", func() {
+			_, _, err := xdt.Apply([]byte(source), []byte(transform(`
+  <system.web>
+    <compilation xdt:Transform="RemoveAttributes" />
+  </system.web>`)))
+			Expect(err).To(MatchError(ContainSubstring("RemoveAttributes requires at least one attribute")))
+		})
+	})
+
+	Describe("Match locator", func() {
+		It("selects elements whose attributes match the transform element", func() {
+			result, _ := apply(`
+  <appSettings>
+    <add key="Debug" value="false" xdt:Transform="SetAttributes" xdt:Locator="Match(key)" />
+  </appSettings>`)
+			Expect(result).To(ContainSubstring(`<add key="Environment" value="Development" />`))
+			Expect(result).To(ContainSubstring(`<add key="Debug" value="false" />`))
+		})
+
+		It("matches on several attributes", func() {
+			result, _ := apply(`
+  <connectionStrings>
+    <add name="Orders" providerName="Npgsql" connectionString="x" xdt:Transform="Replace" xdt:Locator="Match(name, providerName)" />
+  </connectionStrings>`)
+			Expect(result).To(Equal(source))
+		})
+
+		It("fails when the transform element lacks the matched attribute", func() {
+			_, _, err := xdt.Apply([]byte(source), []byte(transform(`
+  <appSettings>
+    <add value="false" xdt:Transform="Replace" xdt:Locator="Match(key)" />
+  </appSettings>`)))
+			Expect(err).To(MatchError(ContainSubstring("<add> has no key attribute to match")))
+		})
+	})
+
+	Describe("Condition locator", func() {
+		DescribeTable("selects the elements the condition holds for",
+			func(condition string, expected []string) {
+				result, _ := apply(`
+  <appSettings>
+    <add value="changed" xdt:Transform="SetAttributes(value)" xdt:Locator="Condition(` + condition + `)" />
+  </appSettings>`)
+				for _, key := range []string{"Environment", "Debug"} {
+					changed := false
+					for _, e := range expected {
+						changed = changed || e == key
+					}
+					line := `<add key="` + key + `" value="changed" />`
+					if changed {
+						Expect(result).To(ContainSubstring(line))
+					} else {
+						Expect(result).ToNot(ContainSubstring(line))
+					}
+				}
+			},
+			Entry("equality", "@key='Debug'", []string{"Debug"}),
+			Entry("double quoted literal", `@key=&quot;Debug&quot;`, []string{"Debug"}),
+			Entry("inequality", "@key!='Debug'", []string{"Environment"}),
+			Entry("or", "@key='Debug' or @key='Environment'", []string{"Debug", "Environment"}),
+			Entry("and", "@key='Debug' and @value='true'", []string{"Debug"}),
+			Entry("not", "not(@key='Debug')", []string{"Environment"}),
+			Entry("parentheses", "(@key='Debug' or @key='Nope') and @value='true'", []string{"Debug"}),
+			Entry("attribute existence", "@value", []string{"Debug", "Environment"}),
+			Entry("missing attribute", "@missing", []string{}),
+		)
+
+		DescribeTable("rejects unsupported conditions",
+			func(condition, message string) {
+				_, _, err := xdt.Apply([]byte(source), []byte(transform(`
+  <appSettings>
+    <add xdt:Transform="Remove" xdt:Locator="Condition(`+condition+`)" />
+  </appSettings>`)))
+				Expect(err).To(MatchError(ContainSubstring(message)))
+			},
+			Entry("functions", "contains(@key, 'D')", `unsupported expression "contains"`),
+			Entry("unterminated literals", "@key='Debug", "unterminated string literal"),
+			Entry("unbalanced parentheses", "(@key='Debug'", `expected ")" at end of condition`),
+			Entry("trailing tokens", "@key='Debug' @value", `unexpected "@"`),
+		)
+	})
+
+	It("applies Locators on ancestors to their descendants", func() {
+		src := `<configuration>
+  <location path="admin"><system.web><authorization deny="*" /></system.web></location>
+  <location path="public"><system.web><authorization deny="?" /></system.web></location>
+</configuration>`
+		result, _, err := xdt.Apply([]byte(src), []byte(transform(`
+  <location path="public" xdt:Locator="Match(path)">
+    <system.web><authorization allow="*" xdt:Transform="Replace" /></system.web>
+  </location>`)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(ContainSubstring(`<location path="admin"><system.web><authorization deny="*" /></system.web></location>`))
+		Expect(string(result)).To(ContainSubstring(`<location path="public"><system.web><authorization allow="*" /></system.web></location>`))
+	})
+
+	It("honours a prefix other than xdt", func() {
+		result, _, err := xdt.Apply([]byte(source), []byte(`<configuration xmlns:t="http://schemas.microsoft.com/XML-Document-Transform">
+  <system.web><customErrors t:Transform="Remove" /></system.web>
+</configuration>`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).ToNot(ContainSubstring("customErrors"))
+	})
+
+	It("preserves prefixed names and the default namespace", func() {
+		src := `<configuration xmlns="urn:config" xmlns:asm="urn:asm">
+  <runtime><asm:assemblyBinding><asm:dependentAssembly /></asm:assemblyBinding></runtime>
+</configuration>`
+		result, _, err := xdt.Apply([]byte(src), []byte(transform(`
+  <runtime><asm:assemblyBinding xmlns:asm="urn:asm"><asm:probing privatePath="bin" xdt:Transform="Insert" /></asm:assemblyBinding></runtime>`)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(Equal(`<configuration xmlns="urn:config" xmlns:asm="urn:asm">
+  <runtime><asm:assemblyBinding><asm:dependentAssembly /><asm:probing privatePath="bin" /></asm:assemblyBinding></runtime>
+</configuration>`))
+	})
+
+	It("keeps a byte order mark", func() {
+		result, _, err := xdt.Apply([]byte("\xef\xbb\xbf"+source), []byte(transform("")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(Equal("\xef\xbb\xbf" + source))
+	})
+
+	It("keeps elements written with separate end tags", func() {
+		src := "<configuration><appSettings></appSettings></configuration>"
+		result, _, err := xdt.Apply([]byte(src), []byte(transform("")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(result)).To(Equal(src))
+	})
+
+	It("fails on an unsupported transform", func() {
+		_, _, err := xdt.Apply([]byte(source), []byte(transform(`<appSettings xdt:Transform="Merge" />`)))
+		Expect(err).To(MatchError("xdt:Transform on /configuration/appSettings: unsupported transform Merge"))
+	})
+
+	It("fails on an XPath locator", func() {
+		_, _, err := xdt.Apply([]byte(source), []byte(transform(`<appSettings xdt:Transform="Remove" xdt:Locator="XPath(//appSettings)" />`)))
+		Expect(err).To(MatchError(ContainSubstring("unsupported locator XPath")))
+	})
+
+	It("fails on malformed documents", func() {
+		_, _, err := xdt.Apply([]byte("<configuration>"), []byte(transform("")))
+		Expect(err).To(MatchError(ContainSubstring("parsing source document")))
+
+		_, _, err = xdt.Apply([]byte(source), []byte("<configuration><a></b></configuration>"))
+		Expect(err).To(MatchError(ContainSubstring("parsing transform document")))
+	})
+})
@@ -0,0 +1,13 @@
+package xdt_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestXdt(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Xdt Suite")
+}